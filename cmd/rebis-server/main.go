@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pmpavl/rebis"
+	"github.com/pmpavl/rebis/metrics"
+	"github.com/pmpavl/rebis/rest"
+	"github.com/pmpavl/rebis/server"
+)
+
+func main() {
+	addr := flag.String("addr", ":6379", "TCP address to listen on")
+	httpAddr := flag.String("http", "", "TCP address of the HTTP/JSON API and /metrics, disabled if empty")
+	confPath := flag.String("config", "", "path to the yaml config of the cache, default config if empty")
+	flag.Parse()
+
+	rebisConfig := &rebis.Config{
+		Size:              rebis.DefaultSize,
+		Shards:            rebis.DefaultShards,
+		DefaultExpiration: rebis.DefaultDefaultExpiration,
+		CleanupInterval:   rebis.DefaultCleanupInterval,
+	}
+
+	if *confPath != "" {
+		var err error
+		if rebisConfig, err = rebis.ConfigFrom(*confPath); err != nil {
+			log.Fatalf(err.Error())
+		}
+	}
+
+	rebisCache, err := rebis.NewCache(rebisConfig)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
+	srv := server.New(rebisCache)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.New(rebisCache))
+	mux.Handle("/", rest.New(rebisCache))
+	httpSrv := &http.Server{Addr: *httpAddr, Handler: mux}
+
+	if *httpAddr != "" {
+		go func() {
+			if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf(err.Error())
+			}
+		}()
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		httpSrv.Close()
+		srv.Close()
+	}()
+
+	err = srv.ListenAndServe(*addr)
+
+	if err := rebisCache.Close(context.Background()); err != nil {
+		log.Printf("close cache: %s", err)
+	}
+
+	if err != nil && !errors.Is(err, server.ErrServerClosed) {
+		log.Fatalf(err.Error())
+	}
+}
@@ -0,0 +1,201 @@
+/*
+	Package metrics serves stats of the rebis cache in the Prometheus text
+	exposition format, so the cache embedded in a service can be scraped
+	without the Prometheus client library.
+
+		http.Handle("/metrics", metrics.New(rebisCache))
+
+	Gauges of items and memory, counters of Stats, the histogram of
+	DeleteExpired durations and the time of the last saved backup are
+	exported with the "rebis" namespace.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmpavl/rebis"
+)
+
+const (
+	DefaultNamespace = "rebis"
+
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+/*
+	Handler serves metrics of the cache.
+*/
+type Handler struct {
+	cache     *rebis.Cache
+	logger    rebis.Logger
+	namespace string
+	labels    string
+}
+
+/*
+	New create handler for the cache with default logger (stdout).
+*/
+func New(c *rebis.Cache) *Handler {
+	return &Handler{
+		cache:     c,
+		logger:    rebis.DefaultLogger(),
+		namespace: DefaultNamespace,
+	}
+}
+
+/*
+	ChangeLogger override the logger of the handler if it is not nil.
+*/
+func (h *Handler) ChangeLogger(custom rebis.Logger) {
+	if custom != nil {
+		h.logger = custom
+	}
+}
+
+/*
+	ChangeNamespace set the prefix of metric names, metrics are named
+	namespace_name.
+*/
+func (h *Handler) ChangeNamespace(namespace string) {
+	h.namespace = namespace
+}
+
+/*
+	ChangeLabels set labels added to every metric, they distinguish several
+	caches in one process.
+*/
+func (h *Handler) ChangeLabels(labels map[string]string) {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escape(labels[name]) + `"`
+	}
+
+	h.labels = strings.Join(pairs, ",")
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	bw := bufio.NewWriter(w)
+	h.write(bw, h.cache.Stats())
+
+	if err := bw.Flush(); err != nil {
+		h.logger.Printf("rebis metrics write response: %s", err)
+	}
+}
+
+/*
+	Write all metrics of the stats.
+*/
+func (h *Handler) write(w *bufio.Writer, st rebis.Stats) {
+	h.metric(w, "items", "gauge", "Items in the cache, including expired ones.", float64(st.Items))
+	h.metric(w, "memory_used_bytes", "gauge", "Bytes used by items.", float64(st.MemoryUsed))
+	h.metric(w, "memory_limit_bytes", "gauge", "Maximum bytes for items.", float64(st.MemoryLimit))
+	h.metric(w, "hits_total", "counter", "Reads of existing items.", float64(st.Hits))
+	h.metric(w, "misses_total", "counter", "Reads of missing or expired items.", float64(st.Misses))
+	h.metric(w, "sets_total", "counter", "Items written by Set, Add, Replace and increments.", float64(st.Sets))
+	h.metric(w, "deletes_total", "counter", "Items deleted by Delete.", float64(st.Deletes))
+	h.metric(w, "expirations_total", "counter", "Expired items deleted by DeleteExpired.", float64(st.Expirations))
+	h.metric(w, "evictions_total", "counter", "Items evicted by the eviction policy.", float64(st.Evictions))
+	h.metric(w, "rejected_total", "counter", "Writes rejected because there is no memory.", float64(st.Rejected))
+	h.metric(w, "backups_total", "counter", "Saved backups.", float64(st.Backups))
+	h.metric(w, "backup_failures_total", "counter", "Backups failed to save.", float64(st.BackupFailures))
+
+	if !st.LastBackup.IsZero() {
+		h.metric(w, "backup_duration_seconds", "gauge", "Duration of the last saved backup.", st.BackupDuration.Seconds())
+		h.metric(w, "backup_last_success_timestamp_seconds", "gauge", "Time of the last saved backup.",
+			float64(st.LastBackup.UnixNano())/1e9)
+	}
+
+	h.histogram(w, "cleanup_duration_seconds", "Duration of DeleteExpired passes.", st.Cleanups)
+}
+
+func (h *Handler) metric(w *bufio.Writer, name, kind, help string, v float64) {
+	name = h.name(name)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	h.sample(w, name, "", v)
+}
+
+func (h *Handler) histogram(w *bufio.Writer, name, help string, hist rebis.Histogram) {
+	name = h.name(name)
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	// buckets of the exposition format are cumulative
+	var n uint64
+	for i, bound := range rebis.CleanupBuckets {
+		n += hist.Buckets[i]
+		h.sample(w, name+"_bucket", `le="`+format(bound.Seconds())+`"`, float64(n))
+	}
+
+	h.sample(w, name+"_bucket", `le="+Inf"`, float64(hist.Count))
+	h.sample(w, name+"_sum", "", hist.Sum.Seconds())
+	h.sample(w, name+"_count", "", float64(hist.Count))
+}
+
+/*
+	Write one sample line with the labels of the handler and the extra label.
+*/
+func (h *Handler) sample(w *bufio.Writer, name, label string, v float64) {
+	labels := h.labels
+	if label != "" {
+		if labels != "" {
+			labels += ","
+		}
+
+		labels += label
+	}
+
+	w.WriteString(name)
+
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+
+	w.WriteString(" " + format(v) + "\n")
+}
+
+func (h *Handler) name(name string) string {
+	if h.namespace == "" {
+		return name
+	}
+
+	return h.namespace + "_" + name
+}
+
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+/*
+	Escape the label value, backslash, double quote and line feed are escaped
+	in the exposition format.
+*/
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
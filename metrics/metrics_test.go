@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmpavl/rebis"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Printf(format string, v ...interface{}) {
+	l.t.Logf(format, v...)
+}
+
+func newHandler(t *testing.T) (*Handler, *rebis.Cache) {
+	c, err := rebis.NewCache(&rebis.Config{Size: rebis.DefaultSize})
+	if err != nil {
+		t.Fatal("err with config:", err)
+	}
+
+	h := New(c)
+	h.ChangeLogger(testLogger{t})
+
+	return h, c
+}
+
+func scrape(t *testing.T, h http.Handler) string {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatal("scrape:", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != contentType {
+		t.Error("content type is wrong:", ct)
+	}
+
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	h, c := newHandler(t)
+
+	c.Set("a", "a", rebis.DefaultExpiration)
+	c.Set("b", "b", rebis.DefaultExpiration)
+	c.Get("a")
+	c.Get("missing")
+	c.Delete("b")
+	c.DeleteExpired()
+
+	body := scrape(t, h)
+	for _, line := range []string{
+		"# TYPE rebis_items gauge",
+		"rebis_items 1",
+		"rebis_memory_used_bytes " + format(float64(c.MemoryUsed())),
+		"rebis_memory_limit_bytes " + format(float64(c.MemoryLimit())),
+		"# TYPE rebis_hits_total counter",
+		"rebis_hits_total 1",
+		"rebis_misses_total 1",
+		"rebis_sets_total 2",
+		"rebis_deletes_total 1",
+		"rebis_expirations_total 0",
+		"rebis_evictions_total 0",
+		"# TYPE rebis_cleanup_duration_seconds histogram",
+		`rebis_cleanup_duration_seconds_bucket{le="+Inf"} 1`,
+		`rebis_cleanup_duration_seconds_bucket{le="5"} 1`,
+		"rebis_cleanup_duration_seconds_count 1",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics have not %q:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "backup_last_success") {
+		t.Error("last backup is exported without backups")
+	}
+
+	if err := c.BackupSaveFile(filepath.Join(t.TempDir(), "test.rdb")); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+	body = scrape(t, h)
+	for _, line := range []string{"rebis_backups_total 1", "rebis_backup_last_success_timestamp_seconds "} {
+		if !strings.Contains(body, line) {
+			t.Errorf("metrics have not %q:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsLabels(t *testing.T) {
+	h, _ := newHandler(t)
+	h.ChangeNamespace("app_cache")
+	h.ChangeLabels(map[string]string{"name": `sessions "eu"`, "app": "api"})
+
+	body := scrape(t, h)
+	for _, line := range []string{
+		`app_cache_items{app="api",name="sessions \"eu\""} 0`,
+		`app_cache_cleanup_duration_seconds_bucket{app="api",name="sessions \"eu\"",le="0.0001"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("metrics have not %q:\n%s", line, body)
+		}
+	}
+	if strings.Contains(body, "rebis_") {
+		t.Error("namespace is not changed")
+	}
+}
+
+func TestMetricsMethod(t *testing.T) {
+	h, _ := newHandler(t)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Error("POST of metrics:", w.Code)
+	}
+}
@@ -1,21 +1,28 @@
 package rebis
 
 import (
+	"bufio"
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
-
-	"github.com/pquerna/ffjson/ffjson"
 )
 
 // Item is element of cache.
 type Item struct {
 	Value      interface{}
 	Expiration int64
+	size       uintptr
+	meta       *itemMeta
+	tags       []string // sorted
+	slide      int64    // sliding time of life in nanoseconds, 0 if the item is not sliding
+	deadline   int64    // maximum expiration of the sliding item in unix nano, 0 if there is none
+	version    uint64   // changed by every write of the value
 }
 
 // Cache is wrapper over hidden cache.
@@ -24,15 +31,38 @@ type Cache struct {
 }
 
 type cache struct {
+	// 64-bit atomic fields first, so they are aligned on 32-bit platforms
+	evictions         uint64 // atomic
+	created           uint64 // atomic
+	expirations       uint64 // atomic
+	rejected          uint64 // atomic
+	version           uint64 // atomic, the last version of written items
+	backups           uint64 // atomic
+	backupFailures    uint64 // atomic
+	backupDuration    int64  // atomic, nanoseconds of the last saved backup
+	lastBackup        int64  // atomic, unix nano of the last saved backup
+	cleanups          histogram
+	tags              tagIndex
+	events            eventBus
+	waits             keyWaits
+	closed            uint32 // atomic
 	maxSize           uintptr
-	size              uintptr
-	mu                sync.RWMutex
-	items             map[string]Item
+	size              uintptr // atomic
+	shards            []*shard
+	shardMask         uint64
 	defaultExpiration time.Duration
+	sliding           bool
+	maxLifetime       time.Duration
 	janitor           *janitor
 	backup            *backup
+	aof               *aof
+	saveOnClose       bool
+	saving            sync.RWMutex // held for reading by backup saves, Close waits for them
+	loads             loadGroup
 	logger            Logger
 	logAll            bool
+	evictionPolicy    EvictionPolicy
+	evictionSamples   int
 	onEvicted         func(string, interface{})
 }
 
@@ -46,7 +76,6 @@ const (
 	NoExpiration time.Duration = -1
 	// if expiration in Set func = 0, then element expiration = config.defaultExpiration.
 	DefaultExpiration time.Duration = 0
-	sizeItem          uintptr       = unsafe.Sizeof(Item{})
 )
 
 /*
@@ -57,7 +86,7 @@ func NewCache(config *Config) (*Cache, error) {
 }
 
 /*
-	NewCacheFrom create new rebis cache from config struct and reuse map items.
+	NewCacheFrom create new rebis cache from config struct and fill it with map items.
 */
 func NewCacheFrom(config *Config, items map[string]Item) (*Cache, error) {
 	return newCache(config, items)
@@ -66,24 +95,77 @@ func NewCacheFrom(config *Config, items map[string]Item) (*Cache, error) {
 /*
 	Init cache struct with default logger (stdout).
 
+	Replay and open the append-only file if aof = true in config file.
+
 	Run backup if inUse = true in config file with backup interval
 
 	Run janitor, if CleanupInterval <= 0 janitor does not start.
 */
 func newCache(config *Config, items map[string]Item) (*Cache, error) {
 	c := &cache{
-		maxSize:           config.Size * DefaultSize,
+		maxSize:           config.MaxMemory,
 		size:              0,
+		shards:            newShards(config.Shards),
 		defaultExpiration: config.DefaultExpiration,
-		items:             items,
+		sliding:           config.SlidingExpiration,
+		maxLifetime:       config.MaxLifetime,
 		logger:            DefaultLogger(),
 		logAll:            config.LogAll,
+		evictionPolicy:    config.EvictionPolicy,
+		evictionSamples:   config.EvictionSamples,
+		tags:              tagIndex{keys: make(map[string]map[string]struct{})},
+		loads: loadGroup{
+			calls:              make(map[string]*loadCall),
+			negative:           make(map[string]negativeResult),
+			negativeExpiration: config.NegativeExpiration,
+		},
+	}
+	c.shardMask = uint64(len(c.shards) - 1)
+
+	if c.maxSize == 0 {
+		c.maxSize = config.Size * DefaultSize
+	}
+
+	if c.evictionPolicy == "" {
+		c.evictionPolicy = DefaultEvictionPolicy
 	}
+
+	if !c.evictionPolicy.valid() {
+		return nil, fmt.Errorf("unknown eviction policy %s", c.evictionPolicy)
+	}
+
+	if c.evictionSamples <= 0 {
+		c.evictionSamples = DefaultEvictionSamples
+	}
+
+	for k, v := range items {
+		v.Value = detach(v.Value)
+		v.tags = uniqueTags(v.tags)
+		v.size = sizeOf(k, v.Value) + tagsSize(v.tags)
+		if !c.reserve(v.size) {
+			return nil, memoryError("no empty slot, for next items")
+		}
+
+		if v.version == 0 {
+			v.version = c.nextVersion()
+		} else {
+			c.seeVersion(v.version)
+		}
+
+		v.meta = c.newMeta()
+		c.tags.retag(k, nil, v.tags)
+		s := c.shard(k)
+		s.items[k] = v
+		s.scan.add(k)
+	}
+
 	C := &Cache{c}
-	c.logIf("initialize new cache with defaul expiration duration: %s, items count: %d, max count: %d",
+	c.logIf("initialize new cache with defaul expiration duration: %s, items count: %d, max memory: %d bytes, shards: %d, eviction policy: %s",
 		c.defaultExpiration,
-		len(c.items),
-		c.maxSize/sizeItem,
+		len(items),
+		c.maxSize,
+		len(c.shards),
+		c.evictionPolicy,
 	)
 
 	if config.Evicted {
@@ -92,16 +174,33 @@ func newCache(config *Config, items map[string]Item) (*Cache, error) {
 		}
 	}
 
+	if config.Backup.SaveOnClose && !config.Backup.InUse {
+		return nil, fmt.Errorf("backup on close requires backup in use")
+	}
+
+	c.saveOnClose = config.Backup.SaveOnClose
+
+	if config.Backup.AOF {
+		if err := runAOF(c, config.Backup, len(items)); err != nil {
+			return nil, err
+		}
+	}
+
 	if config.Backup.InUse {
 		runBackup(c, config.Backup.Path, config.Backup.Interval)
 	}
 
 	if ci := config.CleanupInterval; ci > 0 {
 		runJanitor(c, ci)
+		// the janitor refers to the hidden cache, so the wrapper can be
+		// collected, other goroutines are stopped only by Close
+		runtime.SetFinalizer(C, func(C *Cache) {
+			if !C.isClosed() {
+				stopJanitor(C.cache)
+			}
+		})
 	}
 
-	runtime.SetFinalizer(C, nil)
-
 	return C, nil
 }
 
@@ -109,31 +208,44 @@ func newCache(config *Config, items map[string]Item) (*Cache, error) {
 	Custom function onEvicted.
 */
 func (c *cache) OnEvicted(f func(string, interface{})) {
-	c.mu.Lock()
+	c.lockAll()
 	c.onEvicted = f
-	c.mu.Unlock()
+	c.unlockAll()
 }
 
 /*
-	Delete all expired items from the cache.
+	Delete all expired items from the cache. Shards are locked one by one,
+	so readers of other shards are not stalled.
 */
 func (c *cache) DeleteExpired() {
 	c.logIf("delete expired")
 
 	var evictedItems []keyAndValue
 
-	now := time.Now().UnixNano()
+	start := time.Now()
+	now := start.UnixNano()
+
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if c.isClosed() {
+			s.mu.Unlock()
 
-	c.mu.Lock()
-	for k, v := range c.items {
-		if v.Expiration > 0 && now > v.Expiration {
-			ov, evicted := c.delete(k)
-			if evicted {
-				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			break
+		}
+		for k, v := range s.items {
+			if v.Expiration > 0 && now > v.Expiration {
+				atomic.AddUint64(&c.expirations, 1)
+				ov, evicted := c.remove(s, k, EventExpired)
+				if evicted {
+					evictedItems = append(evictedItems, keyAndValue{k, ov})
+				}
 			}
 		}
+		s.mu.Unlock()
 	}
-	c.mu.Unlock()
+
+	c.loads.deleteExpired(now)
+	c.cleanups.observe(time.Since(start))
 
 	for _, v := range evictedItems {
 		c.onEvicted(v.key, v.value)
@@ -144,9 +256,19 @@ func (c *cache) DeleteExpired() {
 	Delete an item from the cache. Does nothing if the key is not in the cache.
 */
 func (c *cache) Delete(k string) {
-	c.mu.Lock()
-	v, evicted := c.delete(k)
-	c.mu.Unlock()
+	s := c.shard(k)
+	s.mu.Lock()
+	if c.isClosed() {
+		s.mu.Unlock()
+
+		return
+	}
+	if _, found := s.items[k]; found {
+		atomic.AddUint64(&s.deletes, 1)
+	}
+	v, evicted := c.delete(s, k)
+	s.mu.Unlock()
+	c.awaitAOF()
 
 	if evicted {
 		c.onEvicted(k, v)
@@ -156,69 +278,174 @@ func (c *cache) Delete(k string) {
 }
 
 /*
-	Delete item by key, return his value and if have evicted function
-	then true else false.
+	Delete item by key from the locked shard, return his value and if have
+	evicted function then true else false.
 */
-func (c *cache) delete(k string) (interface{}, bool) {
-	defer func() {
-		c.size -= sizeItem
-	}()
-
-	if c.onEvicted != nil {
-		if v, found := c.items[k]; found {
-			delete(c.items, k)
+func (c *cache) delete(s *shard, k string) (interface{}, bool) {
+	return c.remove(s, k, EventDelete)
+}
 
-			return v.Value, true
-		}
+/*
+	Delete item by key from the locked shard like delete, subscriptions get
+	the event of type t.
+*/
+func (c *cache) remove(s *shard, k string, t EventType) (interface{}, bool) {
+	v, found := s.items[k]
+	if !found {
+		return nil, false
 	}
 
-	delete(c.items, k)
+	delete(s.items, k)
+	s.scan.remove(k)
+	c.tags.retag(k, v.tags, nil)
+	c.shrink(v.size)
+	c.logDelete(k)
+	c.publish(t, k, v.Value)
+
+	if c.onEvicted != nil {
+		return v.Value, true
+	}
 
 	return nil, false
 }
 
 /*
-	Delete all items from the cache.
+	Delete all items from the cache. All shards are locked, so the flush is
+	atomic for other operations.
 */
 func (c *cache) Flush() {
-	c.mu.Lock()
-	c.items = map[string]Item{}
-	c.mu.Unlock()
+	c.lockAll()
+
+	if c.isClosed() {
+		c.unlockAll()
+
+		return
+	}
+
+	for _, s := range c.shards {
+		for _, v := range s.items {
+			c.shrink(v.size)
+		}
+		s.items = map[string]Item{}
+		s.scan = scanIndex{}
+	}
+
+	c.tags.reset()
+	c.loads.flush()
+	c.logFlush()
+	c.publish(EventFlush, "", nil)
+	c.unlockAll()
+	c.awaitAOF()
 }
 
 /*
-	Saving backup to the path defined in the structure.
+	Saving backup to the path defined in the structure, returns an error if
+	backup is not in use.
 */
 func (c *cache) BackupSave() error {
+	if c.backup == nil {
+		return fmt.Errorf("backup is not in use")
+	}
+
 	return c.BackupSaveFile(c.backup.Path)
 }
 
 /*
-	Saving backup by filename path.
+	Saving backup by filename path in the binary snapshot format, expired
+	items are skipped. Items of types which are not registered by
+	RegisterType are skipped and logged. The snapshot is written to a
+	temporary file which replaces the file only when it is complete.
 */
 func (c *cache) BackupSaveFile(filename string) error {
-	c.mu.Lock()
-	buf, err := ffjson.Marshal(&c.items)
-	c.mu.Unlock()
+	c.saving.RLock()
+	defer c.saving.RUnlock()
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	return c.saveSnapshot(filename)
+}
+
+/*
+	Save the snapshot and count it in stats.
+*/
+func (c *cache) saveSnapshot(filename string) error {
+	start := time.Now()
+
+	if err := c.writeSnapshot(filename); err != nil {
+		atomic.AddUint64(&c.backupFailures, 1)
 
-	if err != nil {
 		return err
 	}
 
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755) // nolint
+	atomic.AddUint64(&c.backups, 1)
+	atomic.StoreInt64(&c.backupDuration, int64(time.Since(start)))
+	atomic.StoreInt64(&c.lastBackup, time.Now().UnixNano())
+
+	return nil
+}
+
+func (c *cache) writeSnapshot(filename string) error {
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
 	if err != nil {
 		return err
 	}
 
+	defer os.Remove(file.Name())
 	defer file.Close()
 
-	if _, err := file.Write(buf); err != nil {
+	bw := bufio.NewWriter(file)
+	sw := newSnapshotWriter(bw)
+	now := time.Now().UnixNano()
+
+	// every entry is encoded apart, so an item which can't be encoded is
+	// skipped without the rest of the snapshot
+	var entry bytes.Buffer
+
+	ew := &snapshotWriter{w: &entry}
+	skipped := 0
+
+	for _, s := range c.shards {
+		s.mu.RLock()
+		items := make(map[string]Item, len(s.items))
+		for k, v := range s.items {
+			if v.Expiration <= 0 || v.Expiration > now {
+				v.Value = detach(v.Value)
+				items[k] = v
+			}
+		}
+		s.mu.RUnlock()
+
+		for k, v := range items {
+			entry.Reset()
+
+			if err := ew.entry(k, v); err != nil {
+				c.logger.Printf("backup %s: item %s is skipped: %s", filename, k, err)
+				skipped++
+
+				continue
+			}
+
+			sw.write(entry.Bytes())
+		}
+	}
+
+	sw.close()
+
+	if err := bw.Flush(); err != nil {
 		return err
 	}
 
-	c.logIf("backup save in file: %s", filename)
+	if err := file.Close(); err != nil {
+		return err
+	}
 
-	ffjson.Pool(buf)
+	if err := os.Rename(file.Name(), filename); err != nil {
+		return err
+	}
+
+	c.logIf("backup save in file: %s, skipped items: %d", filename, skipped)
 
 	return nil
 }
@@ -227,42 +454,73 @@ func (c *cache) BackupSaveFile(filename string) error {
 	Recovery backup by path defined in the structure.
 */
 func (c *cache) BackupRecovery() error {
+	if c.backup == nil {
+		return fmt.Errorf("backup is not in use")
+	}
+
 	return c.BackupRecoveryFile(c.backup.Path)
 }
 
 /*
-	Recovery backup by filename path.
+	Recovery backup by filename path, values are restored with the same Go
+	type as they were saved.
 */
 func (c *cache) BackupRecoveryFile(filename string) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
 	buf, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
 
-	items := map[string]Item{}
-	err = ffjson.Unmarshal(buf, &items)
-	ffjson.Pool(buf)
+	sr, err := newSnapshotReader(buf)
+	if err != nil {
+		return err
+	}
 
+	items, err := sr.items()
 	if err != nil {
 		return err
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	if err := c.recoverItems(items); err != nil {
+		return err
+	}
+
+	c.logIf("backup load from file: %s", filename)
+
+	return nil
+}
 
+/*
+	Put recovered items into the cache, items that are already in the cache
+	and not expired are kept.
+*/
+func (c *cache) recoverItems(items map[string]Item) error {
 	for k, v := range items {
-		ov, found := c.items[k]
+		s := c.shard(k)
+		s.mu.Lock()
+
+		if c.isClosed() {
+			s.mu.Unlock()
+
+			return ErrClosed
+		}
+
+		ov, found := s.items[k]
 		if !found || ov.Expired() {
-			if !c.haveSlot() {
-				return fmt.Errorf("no empty slot, for next items")
-			}
+			v.size = sizeOf(k, v.Value) + tagsSize(v.tags)
+			if !c.store(s, k, v) {
+				s.mu.Unlock()
 
-			c.items[k] = v
-			c.size += sizeItem
+				return memoryError("no empty slot, for next items")
+			}
 		}
-	}
 
-	c.logIf("backup load from file: %s", filename)
+		s.mu.Unlock()
+	}
 
 	return nil
 }
@@ -272,9 +530,14 @@ func (c *cache) BackupRecoveryFile(filename string) error {
 	expired, but have not yet been cleaned up.
 */
 func (c *cache) ItemCount() int {
-	c.mu.RLock()
-	n := len(c.items)
-	c.mu.RUnlock()
+	n := 0
+
+	for _, s := range c.shards {
+		s.mu.RLock()
+		n += len(s.items)
+		s.mu.RUnlock()
+	}
+
 	c.logIf("all items count: %d", n)
 
 	return n
@@ -284,19 +547,22 @@ func (c *cache) ItemCount() int {
 	Copies all unexpired items in the cache into a new map and returns it.
 */
 func (c *cache) Items() map[string]Item {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	m := make(map[string]Item, len(c.items))
+	m := make(map[string]Item)
 	now := time.Now().UnixNano()
 
-	for k, v := range c.items {
-		if v.Expiration > 0 {
-			if now > v.Expiration {
-				continue
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k, v := range s.items {
+			if v.Expiration > 0 {
+				if now > v.Expiration {
+					continue
+				}
 			}
-		}
 
-		m[k] = v
+			v.Value = detach(v.Value)
+			m[k] = v
+		}
+		s.mu.RUnlock()
 	}
 
 	c.logIf("unexpired items count: %d", len(m))
@@ -304,40 +570,15 @@ func (c *cache) Items() map[string]Item {
 	return m
 }
 
-func (c *cache) haveSlot() bool {
-	return c.maxSize-c.size > sizeItem
-}
-
 /*
 	Add an item to the cache, replacing any existing item. If the duration is 0
 	(DefaultExpiration), the cache's default expiration time is used. If it is -1
 	(NoExpiration), the item never expires.
 */
 func (c *cache) Set(k string, x interface{}, d time.Duration) error {
-	if !c.haveSlot() {
-		return fmt.Errorf("no empty slot, wait for janitor")
-	}
-
-	var e int64
-
-	if d == DefaultExpiration {
-		d = c.defaultExpiration
-	}
-
-	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
-	}
-
-	c.mu.Lock()
-	if _, ok := c.get(k); !ok {
-		c.size += sizeItem
-	}
-
-	c.items[k] = Item{
-		Value:      x,
-		Expiration: e,
+	if err := c.put(c.shard(k), k, c.newItem(k, x, d), nil); err != nil {
+		return err
 	}
-	c.mu.Unlock()
 
 	c.logIf("set %s -> %v <- %s", k, x, d)
 
@@ -356,55 +597,61 @@ func (c *cache) SetDefault(k string, x interface{}) {
 	key, or if the existing item has expired. Returns an error otherwise.
 */
 func (c *cache) Add(k string, x interface{}, d time.Duration) error {
-	if !c.haveSlot() {
-		return fmt.Errorf("no empty slot, wait for janitor")
-	}
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	err := c.put(c.shard(k), k, c.newItem(k, x, d), func(old Item, found bool) error {
+		if found && !old.Expired() {
+			return fmt.Errorf("item %s already exists", k)
+		}
 
-	if _, found := c.get(k); found {
-		return fmt.Errorf("item %s already exists", k)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	c.set(k, x, d)
 	c.logIf("add %s -> %v <- %s", k, x, d)
 
 	return nil
 }
 
-func (c *cache) get(k string) (interface{}, bool) {
-	item, found := c.items[k]
-	if !found {
-		return nil, false
+/*
+	Create new item for the key, expiration and size of the item are calculated.
+*/
+func (c *cache) newItem(k string, x interface{}, d time.Duration) Item {
+	item := Item{
+		Value:      detach(x),
+		Expiration: c.expiration(d),
+		size:       sizeOf(k, x),
 	}
 
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			return nil, false
-		}
+	if c.sliding && item.Expiration > 0 {
+		c.setSliding(&item, d, c.maxLifetime)
 	}
 
-	return item.Value, true
+	return item
 }
 
-func (c *cache) set(k string, x interface{}, d time.Duration) {
-	var e int64
-
+/*
+	Returns expiration time in unix nano for the duration, 0 if the item
+	never expires.
+*/
+func (c *cache) expiration(d time.Duration) int64 {
 	if d == DefaultExpiration {
 		d = c.defaultExpiration
 	}
 
 	if d > 0 {
-		e = time.Now().Add(d).UnixNano()
+		return time.Now().Add(d).UnixNano()
 	}
 
-	c.items[k] = Item{
-		Value:      x,
-		Expiration: e,
-	}
+	return 0
+}
 
-	c.size += sizeItem
+/*
+	Set item to the locked shard without eviction. Returns false if there is
+	no memory for the item.
+*/
+func (c *cache) set(s *shard, k string, x interface{}, d time.Duration) bool {
+	return c.store(s, k, c.newItem(k, x, d))
 }
 
 /*
@@ -412,21 +659,11 @@ func (c *cache) set(k string, x interface{}, d time.Duration) {
 	whether the key was found.
 */
 func (c *cache) Get(k string) (interface{}, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	item, found := c.items[k]
-
+	item, found := c.get(k)
 	if !found {
 		return nil, false
 	}
 
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			return nil, false
-		}
-	}
-
 	c.logIf("get %s -> %v", k, item.Value)
 
 	return item.Value, true
@@ -439,39 +676,66 @@ func (c *cache) Get(k string) (interface{}, bool) {
 	whether the key was found.
 */
 func (c *cache) GetWithExpiration(k string) (interface{}, time.Time, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	item, found := c.items[k]
-
+	item, found := c.get(k)
 	if !found {
 		return nil, time.Time{}, false
 	}
 
-	if item.Expiration > 0 {
-		if time.Now().UnixNano() > item.Expiration {
-			return nil, time.Time{}, false
-		}
-	}
-
 	c.logIf("get with exp %s -> %v <- %s", k, item.Value, time.Unix(0, item.Expiration))
 
 	return item.Value, time.Unix(0, item.Expiration), true
 }
 
+/*
+	Returns the unexpired item and counts the read, the closed cache has no
+	items. Only sliding items are read under the write lock, their
+	expiration is moved forward.
+*/
+func (c *cache) get(k string) (Item, bool) {
+	if c.isClosed() {
+		return Item{}, false
+	}
+
+	s := c.shard(k)
+	s.mu.RLock()
+	item, found := s.items[k]
+	if found && item.slide == 0 {
+		item.Value = detach(item.Value)
+	}
+	s.mu.RUnlock()
+
+	if !found || item.Expired() {
+		atomic.AddUint64(&s.misses, 1)
+
+		return Item{}, false
+	}
+
+	if item.slide > 0 {
+		return c.slide(s, k)
+	}
+
+	atomic.AddUint64(&s.hits, 1)
+	item.meta.touch()
+
+	return item, true
+}
+
 /*
 	Set a new value for the cache key only if it already exists, and the existing
 	item hasn't expired. Returns an error otherwise.
 */
 func (c *cache) Replace(k string, x interface{}, d time.Duration) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	err := c.put(c.shard(k), k, c.newItem(k, x, d), func(old Item, found bool) error {
+		if !found || old.Expired() {
+			return fmt.Errorf("item %s doesn't exist", k)
+		}
 
-	if _, found := c.get(k); !found {
-		return fmt.Errorf("item %s doesn't exist", k)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	c.set(k, x, d)
 	c.logIf("replace %s -> %v <- %s", k, x, d)
 
 	return nil
@@ -0,0 +1,892 @@
+package rebis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	FsyncPolicy defines when the append-only file is synced to disk.
+*/
+type FsyncPolicy string
+
+const (
+	// writes return after the sync, the slowest and the safest policy.
+	FsyncAlways FsyncPolicy = "always"
+	// flush and sync once per second, a crash loses at most one second of writes.
+	FsyncEverySec FsyncPolicy = "everysec"
+	// flush once per second and let the operating system decide when to sync.
+	FsyncNo FsyncPolicy = "no"
+)
+
+const (
+	DefaultFsync                = FsyncEverySec
+	DefaultAOFFile              = "appendonly.aof"
+	DefaultAOFRewriteMinSize    = 64 * 1024 * 1024
+	DefaultAOFRewritePercentage = 100
+)
+
+/*
+	Append-only file layout:
+
+		magic "REBISAOF" | version byte
+		record*          | length, payload, crc32 (Castagnoli) of payload
+
+	Payload is op and its arguments encoded like in snapshots. Set records
+	hold the final state of the key, change records hold the operation of
+	the data type with versions of the item before and after it. The change
+	is skipped if the item already has the version after it, so replaying
+	of a record twice gives the same result.
+*/
+const (
+	aofMagic      = "REBISAOF"
+	aofVersion    = 2 // version 1 with records of tags is not read
+	aofSync       = time.Second
+	maxRecordSize = 1 << 32
+)
+
+const (
+	aofSet byte = iota + 1 // key, expiration, value
+	aofDel                 // key
+	aofFlush
+	_            // not used
+	aofExpire    // key, expiration
+	aofSetFields // key, expiration, fields, value
+	aofChange    // key, expiration, base version, version, op, arguments
+)
+
+type aof struct {
+	appended   uint64     // atomic, count of appended records
+	synced     uint64     // atomic, count of records synced to disk
+	syncMu     sync.Mutex // held by the writer which syncs the file, taken before mu
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	w          *bufio.Writer
+	fsync      FsyncPolicy
+	payload    bytes.Buffer
+	sw         snapshotWriter
+	size       int64 // size of the file
+	baseSize   int64 // size of the file after the last rewrite
+	minSize    int64
+	percentage int
+	rewriting  bool
+	rewrites   sync.WaitGroup // rewrites started by appendAOF
+	closed     bool
+	rewriteBuf []byte // records appended while the file is rewritten
+	stop       chan bool
+	done       chan bool
+}
+
+func (p FsyncPolicy) valid() bool {
+	switch p {
+	case FsyncAlways, FsyncEverySec, FsyncNo:
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+	Replay the append-only file and open it for appending. Items passed to
+	NewCacheFrom are written to the file by rewrite.
+*/
+func runAOF(c *cache, config Backup, items int) error {
+	a := &aof{
+		path:       config.AOFPath,
+		fsync:      config.Fsync,
+		minSize:    config.AOFRewriteMinSize,
+		percentage: config.AOFRewritePercentage,
+		stop:       make(chan bool),
+		done:       make(chan bool),
+	}
+	a.sw.w = &a.payload
+
+	if a.path == "" {
+		a.path = filepath.Join(config.Path, DefaultAOFFile)
+	}
+
+	if a.fsync == "" {
+		a.fsync = DefaultFsync
+	}
+
+	if !a.fsync.valid() {
+		return fmt.Errorf("unknown fsync policy %s", a.fsync)
+	}
+
+	if a.minSize == 0 {
+		a.minSize = DefaultAOFRewriteMinSize
+	}
+
+	if a.percentage == 0 {
+		a.percentage = DefaultAOFRewritePercentage
+	}
+
+	file, err := os.OpenFile(a.path, os.O_RDWR|os.O_CREATE, 0644) // nolint
+	if err != nil {
+		return err
+	}
+
+	size, err := c.replayAOF(file)
+	if err != nil {
+		file.Close()
+
+		return fmt.Errorf("append only file %s: %w", a.path, err)
+	}
+
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	a.file, a.w, a.size, a.baseSize = file, bufio.NewWriter(file), size, size
+
+	if size == 0 {
+		a.w.WriteString(aofMagic)
+		a.w.WriteByte(aofVersion)
+		a.size = int64(len(aofMagic) + 1)
+	}
+
+	c.aof = a
+
+	if items > 0 {
+		if err := c.RewriteAOF(); err != nil {
+			return err
+		}
+	}
+
+	go a.run(c)
+
+	return nil
+}
+
+func stopAOF(c *cache) {
+	close(c.aof.stop)
+	<-c.aof.done
+}
+
+/*
+	Flush the file every second, sync it if the policy is everysec.
+*/
+func (a *aof) run(c *cache) {
+	ticker := time.NewTicker(aofSync)
+	c.logIf("start append only file %s with fsync %s", a.path, a.fsync)
+
+	defer close(a.done)
+
+	for {
+		select {
+		case <-ticker.C:
+			a.mu.Lock()
+			if err := a.sync(a.fsync != FsyncNo); err != nil {
+				c.logger.Printf("append only file %s: %s", a.path, err)
+			}
+			a.mu.Unlock()
+		case <-a.stop:
+			ticker.Stop()
+
+			a.syncMu.Lock()
+			a.mu.Lock()
+			if err := a.sync(true); err != nil {
+				c.logger.Printf("append only file %s: %s", a.path, err)
+			}
+			a.file.Close()
+			a.closed = true
+			a.mu.Unlock()
+			a.syncMu.Unlock()
+
+			c.logIf("stop append only file")
+
+			return
+		}
+	}
+}
+
+/*
+	Flush buffer to the file and sync it to disk if full is true.
+*/
+func (a *aof) sync(full bool) error {
+	if err := a.w.Flush(); err != nil {
+		return err
+	}
+
+	if full {
+		return a.file.Sync()
+	}
+
+	return nil
+}
+
+/*
+	Append the record encoded by f, called under the shard lock of the key,
+	so records of one key are in the same order as changes of the cache.
+	The record is only written to the buffer, with fsync always the writer
+	waits for the sync by awaitAOF after the shard lock is released.
+*/
+func (c *cache) appendAOF(f func(sw *snapshotWriter) error) {
+	a := c.aof
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return
+	}
+
+	a.payload.Reset()
+
+	// values are checked by checkAOF before the write, so only encoding of
+	// registered types by gob can fail here
+	if err := f(&a.sw); err != nil {
+		c.logger.Printf("append only file %s: %s", a.path, err)
+
+		return
+	}
+
+	a.size += writeRecord(a, a.payload.Bytes())
+	atomic.AddUint64(&a.appended, 1)
+
+	if !a.rewriting && a.percentage > 0 && a.size >= a.minSize && a.size >= a.baseSize*int64(100+a.percentage)/100 {
+		a.rewriting = true
+		a.rewrites.Add(1)
+
+		go func() {
+			defer a.rewrites.Done()
+
+			if err := c.rewriteAOF(); err != nil {
+				c.logger.Printf("append only file %s: rewrite: %s", a.path, err)
+			}
+		}()
+	}
+}
+
+/*
+	Wait until records appended so far are synced to disk if fsync is
+	always, called by writers after the shard lock is released. Records of
+	writers which come during the sync are synced together by the next
+	writer, so concurrent writers share one sync.
+*/
+func (c *cache) awaitAOF() {
+	a := c.aof
+	if a == nil || a.fsync != FsyncAlways {
+		return
+	}
+
+	target := atomic.LoadUint64(&a.appended)
+
+	a.syncMu.Lock()
+	defer a.syncMu.Unlock()
+
+	if atomic.LoadUint64(&a.synced) >= target {
+		return
+	}
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+
+		return
+	}
+
+	appended := atomic.LoadUint64(&a.appended)
+	err := a.w.Flush()
+	file := a.file
+	a.mu.Unlock()
+
+	// other writers append to the buffer meanwhile, the file is not
+	// switched by rewrite while syncMu is held
+	if err == nil {
+		err = file.Sync()
+	}
+
+	if err != nil {
+		c.logger.Printf("append only file %s: %s", a.path, err)
+
+		return
+	}
+
+	atomic.StoreUint64(&a.synced, appended)
+}
+
+/*
+	Check that the value can be written to the append-only file, so the
+	write which could not be replayed is rejected before it is applied.
+*/
+func (c *cache) checkAOF(k string, x interface{}) error {
+	if c.aof == nil {
+		return nil
+	}
+
+	if err := encodable(x); err != nil {
+		return fmt.Errorf("item %s: %w", k, err)
+	}
+
+	return nil
+}
+
+/*
+	Write to the file buffer, while the file is rewritten the data is also
+	kept for the new file.
+*/
+func (a *aof) Write(p []byte) (int, error) {
+	if a.rewriting {
+		a.rewriteBuf = append(a.rewriteBuf, p...)
+	}
+
+	return a.w.Write(p)
+}
+
+/*
+	Write length, payload and checksum of the record, returns count of
+	written bytes.
+*/
+func writeRecord(w io.Writer, payload []byte) int64 {
+	var buf [binary.MaxVarintLen64]byte
+
+	n := binary.PutUvarint(buf[:], uint64(len(payload)))
+	w.Write(buf[:n])
+	w.Write(payload)
+	binary.LittleEndian.PutUint32(buf[:], crc32.Checksum(payload, crcTable))
+	w.Write(buf[:4])
+
+	return int64(n + len(payload) + 4)
+}
+
+/*
+	Log the new state of the key, if the append-only file is in use.
+*/
+func (c *cache) logSet(k string, item Item) {
+	if c.aof == nil {
+		return
+	}
+
+	c.appendAOF(func(sw *snapshotWriter) error {
+		return writeSet(sw, k, item)
+	})
+}
+
+/*
+	Log the change of the data type made on the base version of the item, if
+	the append-only file is in use.
+*/
+func (c *cache) logChange(k string, item Item, base uint64, change *Change) {
+	if c.aof == nil {
+		return
+	}
+
+	c.appendAOF(func(sw *snapshotWriter) error {
+		sw.byte(aofChange)
+		sw.string(k)
+		sw.varint(item.Expiration)
+		sw.uvarint(base)
+		sw.uvarint(item.version)
+		sw.string(change.Op)
+		sw.strings(change.Args)
+
+		return nil
+	})
+}
+
+/*
+	Write the payload of the record which sets the item.
+*/
+func writeSet(sw *snapshotWriter, k string, item Item) error {
+	if !hasFields(item) {
+		sw.byte(aofSet)
+		sw.string(k)
+		sw.varint(item.Expiration)
+	} else {
+		sw.byte(aofSetFields)
+		sw.string(k)
+		sw.varint(item.Expiration)
+		sw.fields(item)
+	}
+
+	return sw.value(item.Value)
+}
+
+/*
+	Log the new expiration of the key, if the append-only file is in use.
+*/
+func (c *cache) logExpire(k string, e int64) {
+	if c.aof == nil {
+		return
+	}
+
+	c.appendAOF(func(sw *snapshotWriter) error {
+		sw.byte(aofExpire)
+		sw.string(k)
+		sw.varint(e)
+
+		return nil
+	})
+}
+
+/*
+	Log the deletion of the key, if the append-only file is in use.
+*/
+func (c *cache) logDelete(k string) {
+	if c.aof == nil {
+		return
+	}
+
+	c.appendAOF(func(sw *snapshotWriter) error {
+		sw.byte(aofDel)
+		sw.string(k)
+
+		return nil
+	})
+}
+
+/*
+	Log the flush of the cache, if the append-only file is in use.
+*/
+func (c *cache) logFlush() {
+	if c.aof == nil {
+		return
+	}
+
+	c.appendAOF(func(sw *snapshotWriter) error {
+		sw.byte(aofFlush)
+
+		return nil
+	})
+}
+
+/*
+	RewriteAOF replaces the append-only file with minimal log of the current
+	items. Writers are not blocked while the items are written, changes made
+	meanwhile are appended to the new file at the end. Rewrite is also started
+	automatically when the file grows by AOFRewritePercentage since the last
+	rewrite.
+*/
+func (c *cache) RewriteAOF() error {
+	if c.aof == nil {
+		return fmt.Errorf("append only file is not in use")
+	}
+
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	c.aof.mu.Lock()
+	if c.aof.rewriting {
+		c.aof.mu.Unlock()
+
+		return fmt.Errorf("append only file rewrite is already in progress")
+	}
+	c.aof.rewriting = true
+	c.aof.mu.Unlock()
+
+	return c.rewriteAOF()
+}
+
+func (c *cache) rewriteAOF() error {
+	a := c.aof
+
+	c.saving.RLock()
+	defer c.saving.RUnlock()
+
+	if c.isClosed() {
+		a.abortRewrite()
+
+		return ErrClosed
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(a.path), filepath.Base(a.path)+".tmp*")
+	if err != nil {
+		a.abortRewrite()
+
+		return err
+	}
+
+	if err := c.writeAOF(file); err != nil {
+		a.abortRewrite()
+		file.Close()
+		os.Remove(file.Name())
+
+		return err
+	}
+
+	a.syncMu.Lock()
+	defer a.syncMu.Unlock()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	size, err := a.switchFile(file)
+	if err != nil {
+		a.rewriting, a.rewriteBuf = false, a.rewriteBuf[:0]
+		file.Close()
+		os.Remove(file.Name())
+
+		return err
+	}
+
+	c.logIf("append only file %s is rewritten, size %d bytes", a.path, size)
+
+	return nil
+}
+
+/*
+	Write header and the current items to the new file.
+*/
+func (c *cache) writeAOF(file *os.File) error {
+	w := bufio.NewWriter(file)
+	w.WriteString(aofMagic)
+	w.WriteByte(aofVersion)
+
+	var payload bytes.Buffer
+
+	sw := &snapshotWriter{w: &payload}
+	now := time.Now().UnixNano()
+
+	for _, s := range c.shards {
+		s.mu.RLock()
+		items := make(map[string]Item, len(s.items))
+		for k, v := range s.items {
+			if v.Expiration <= 0 || v.Expiration > now {
+				v.Value = detach(v.Value)
+				items[k] = v
+			}
+		}
+		s.mu.RUnlock()
+
+		for k, v := range items {
+			payload.Reset()
+
+			if err := writeSet(sw, k, v); err != nil {
+				return fmt.Errorf("item %s: %w", k, err)
+			}
+
+			writeRecord(w, payload.Bytes())
+		}
+	}
+
+	return w.Flush()
+}
+
+/*
+	Append records written during the rewrite to the new file and replace the
+	old file with it, called under the lock.
+*/
+func (a *aof) switchFile(file *os.File) (int64, error) {
+	if a.closed {
+		return 0, ErrClosed
+	}
+
+	if _, err := file.Write(a.rewriteBuf); err != nil {
+		return 0, err
+	}
+
+	if err := file.Sync(); err != nil {
+		return 0, err
+	}
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.Rename(file.Name(), a.path); err != nil {
+		return 0, err
+	}
+
+	// the buffer of the old file is already in the new one
+	a.file.Close()
+	a.file = file
+	a.w.Reset(file)
+	a.size, a.baseSize = size, size
+	a.rewriting, a.rewriteBuf = false, a.rewriteBuf[:0]
+	atomic.StoreUint64(&a.synced, atomic.LoadUint64(&a.appended))
+
+	return size, nil
+}
+
+func (a *aof) abortRewrite() {
+	a.mu.Lock()
+	a.rewriting, a.rewriteBuf = false, a.rewriteBuf[:0]
+	a.mu.Unlock()
+}
+
+/*
+	Apply records of the append-only file to the cache, returns the size of
+	the valid part of the file. Incomplete or damaged last record is left by
+	crash during write, it is dropped and the file is truncated.
+*/
+func (c *cache) replayAOF(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if info.Size() == 0 {
+		return 0, nil
+	}
+
+	r := bufio.NewReader(file)
+
+	header := make([]byte, len(aofMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(aofMagic)]) != aofMagic {
+		return 0, fmt.Errorf("invalid append only file")
+	}
+
+	if v := header[len(aofMagic)]; v != aofVersion {
+		return 0, fmt.Errorf("unsupported append only file version %d, version %d is required", v, aofVersion)
+	}
+
+	offset := int64(len(header))
+	records := 0
+
+	for {
+		payload, n, err := readRecord(r, info.Size()-offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.ErrUnexpectedEOF) && offset+n < info.Size() {
+				return 0, fmt.Errorf("record at offset %d: %w", offset, err)
+			}
+
+			c.logger.Printf("append only file: last record at offset %d is damaged (%s), it is dropped", offset, err)
+
+			if err := file.Truncate(offset); err != nil {
+				return 0, err
+			}
+
+			break
+		}
+
+		if err := c.applyRecord(payload); err != nil {
+			return 0, fmt.Errorf("record at offset %d: %w", offset, err)
+		}
+
+		offset += n
+		records++
+	}
+
+	c.logIf("append only file replayed, records: %d", records)
+
+	return offset, nil
+}
+
+/*
+	Read length, payload and checksum of the record, returns count of bytes
+	of the record. io.EOF is returned only at the end of the file,
+	io.ErrUnexpectedEOF if the record is incomplete or longer than remaining
+	bytes of the file.
+*/
+func readRecord(r *bufio.Reader, remaining int64) ([]byte, int64, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if l > maxRecordSize {
+		return nil, 0, fmt.Errorf("%w: record length %d", errSnapshotFormat, l)
+	}
+
+	var buf [binary.MaxVarintLen64]byte
+	n := int64(binary.PutUvarint(buf[:], l)) + int64(l) + 4
+
+	// the length of the damaged record is not trusted for the allocation
+	if n > remaining {
+		return nil, n, io.ErrUnexpectedEOF
+	}
+
+	record := make([]byte, l+4)
+	if _, err := io.ReadFull(r, record); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return nil, n, err
+	}
+
+	payload := record[:l]
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(record[l:]) {
+		return nil, n, fmt.Errorf("%w: checksum mismatch", errSnapshotFormat)
+	}
+
+	return payload, n, nil
+}
+
+/*
+	Apply one record of the append-only file to the cache.
+*/
+func (c *cache) applyRecord(payload []byte) error {
+	sr := &snapshotReader{r: bytes.NewReader(payload)}
+
+	op, err := sr.r.ReadByte()
+	if err != nil {
+		return sr.err(err)
+	}
+
+	switch op {
+	case aofSet, aofSetFields, aofDel, aofExpire:
+		k, err := sr.string()
+		if err != nil {
+			return err
+		}
+
+		s := c.shard(k)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if op == aofDel {
+			c.delete(s, k)
+
+			return nil
+		}
+
+		exp, err := binary.ReadVarint(sr.r)
+		if err != nil {
+			return sr.err(err)
+		}
+
+		if op == aofExpire {
+			if item, found := s.items[k]; found {
+				if exp > 0 && exp < time.Now().UnixNano() {
+					c.delete(s, k)
+				} else {
+					if exp == 0 {
+						item.slide, item.deadline = 0, 0
+					}
+
+					item.Expiration = exp
+					s.items[k] = item
+				}
+			}
+
+			return nil
+		}
+
+		item := Item{Expiration: exp}
+		if err := sr.itemFields(op, &item); err != nil {
+			return err
+		}
+
+		if item.Value, err = sr.value(); err != nil {
+			return err
+		}
+
+		if exp > 0 && exp < time.Now().UnixNano() {
+			c.delete(s, k)
+
+			return nil
+		}
+
+		item.size = sizeOf(k, item.Value) + tagsSize(item.tags)
+		if !c.store(s, k, item) {
+			return memoryError("no empty slot, for next items")
+		}
+	case aofChange:
+		return c.applyChange(sr)
+	case aofFlush:
+		c.Flush()
+	default:
+		return fmt.Errorf("%w: unknown op 0x%02x", errSnapshotFormat, op)
+	}
+
+	return nil
+}
+
+/*
+	Apply the change record by the method of the data type. The change made
+	on the new key is applied to the empty value, other changes only to the
+	base version of the item. The item gets the version and the expiration
+	of the record.
+*/
+func (c *cache) applyChange(sr *snapshotReader) error {
+	k, err := sr.string()
+	if err != nil {
+		return err
+	}
+
+	exp, err := binary.ReadVarint(sr.r)
+	if err != nil {
+		return sr.err(err)
+	}
+
+	base, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return sr.err(err)
+	}
+
+	version, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return sr.err(err)
+	}
+
+	op, err := sr.string()
+	if err != nil {
+		return err
+	}
+
+	args, err := sr.strings()
+	if err != nil {
+		return err
+	}
+
+	replay, found := changeReplays[op]
+	if !found {
+		return fmt.Errorf("%w: unknown change %s", errSnapshotFormat, op)
+	}
+
+	s := c.shard(k)
+	s.mu.Lock()
+
+	item, found := s.items[k]
+
+	switch {
+	case found && item.version >= version:
+		// the change is already in the rewritten file
+		s.mu.Unlock()
+
+		return nil
+	case exp > 0 && exp < time.Now().UnixNano():
+		c.delete(s, k)
+		s.mu.Unlock()
+
+		return nil
+	case base == 0:
+		c.delete(s, k)
+	case !found || item.version != base:
+		s.mu.Unlock()
+
+		return fmt.Errorf("%w: change %s of %s is made on version %d, the item has version %d", errSnapshotFormat, op, k, base, item.version)
+	default:
+		// the change is made on the live item
+		item.Expiration = exp
+		s.items[k] = item
+	}
+
+	s.mu.Unlock()
+
+	if err := replay(c, k, &changeReader{args: args}); err != nil {
+		return fmt.Errorf("change %s of %s: %w", op, k, err)
+	}
+
+	s.mu.Lock()
+	if item, found := s.items[k]; found {
+		item.Expiration, item.version = exp, version
+		s.items[k] = item
+		c.seeVersion(version)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
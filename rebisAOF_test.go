@@ -0,0 +1,353 @@
+package rebis
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func aofConfig(t *testing.T, fsync FsyncPolicy) *Config {
+	conf := configDefault()
+	conf.CleanupInterval = 0
+	conf.Backup = Backup{
+		AOF:     true,
+		AOFPath: filepath.Join(t.TempDir(), "test.aof"),
+		Fsync:   fsync,
+	}
+
+	return conf
+}
+
+func reopenAOF(t *testing.T, tc *Cache, conf *Config) *Cache {
+	tc.Close(context.Background())
+
+	tr, err := NewCache(conf)
+	if err != nil {
+		t.Fatal("Couldn't replay append only file:", err)
+	}
+
+	return tr
+}
+
+func TestAOFReplay(t *testing.T) {
+	for _, fsync := range []FsyncPolicy{FsyncAlways, FsyncEverySec, FsyncNo} {
+		conf := aofConfig(t, fsync)
+		tc, err := NewCache(conf)
+		if err != nil {
+			t.Fatal("err with aof config:", err)
+		}
+
+		tc.Set("a", 1, DefaultExpiration)
+		tc.Add("b", "b", DefaultExpiration)
+		tc.Replace("b", []byte("bb"), DefaultExpiration)
+		tc.Set("c", 1.5, time.Hour)
+		tc.Increment("a", 10)
+		tc.IncrementFloat("c", 1)
+		tc.Set("deleted", "x", DefaultExpiration)
+		tc.Delete("deleted")
+		tc.Set("expired", "x", time.Millisecond)
+		<-time.After(2 * time.Millisecond)
+		tc.DeleteExpired()
+		tc.Set("short", "x", 10*time.Millisecond)
+
+		tr := reopenAOF(t, tc, conf)
+		if n, err := tr.IncrementInt("a", 1); err != nil || n != 12 {
+			t.Errorf("%s: a is not 12 after replay: %d %v", fsync, n, err)
+		}
+		if b, _ := tr.Get("b"); !reflect.DeepEqual(b, []byte("bb")) {
+			t.Errorf("%s: b is not replaced after replay: %#v", fsync, b)
+		}
+		if c, exp, _ := tr.GetWithExpiration("c"); c != 2.5 || time.Until(exp) < 59*time.Minute {
+			t.Errorf("%s: c is wrong after replay: %v %s", fsync, c, exp)
+		}
+		for _, k := range []string{"deleted", "expired"} {
+			if _, found := tr.Get(k); found {
+				t.Errorf("%s: %s is found after replay", fsync, k)
+			}
+		}
+		<-time.After(10 * time.Millisecond)
+		if _, found := tr.Get("short"); found {
+			t.Errorf("%s: short is not expired after replay", fsync)
+		}
+
+		tr.Flush()
+		tr = reopenAOF(t, tr, conf)
+		if n := tr.ItemCount(); n != 0 {
+			t.Errorf("%s: item count after flush is not 0: %d", fsync, n)
+		}
+		tr.Close(context.Background())
+	}
+}
+
+func TestAOFDamaged(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.Set("a", "a", DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+	tc.Close(context.Background())
+
+	info, _ := os.Stat(conf.Backup.AOFPath)
+	size := info.Size()
+
+	// incomplete last record is dropped
+	f, _ := os.OpenFile(conf.Backup.AOFPath, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write([]byte{20, byte(aofSet), 1})
+	f.Close()
+
+	tr, err := NewCache(conf)
+	if err != nil {
+		t.Fatal("Couldn't replay file with incomplete record:", err)
+	}
+	if n := tr.ItemCount(); n != 2 {
+		t.Errorf("item count is not 2: %d", n)
+	}
+	tr.Close(context.Background())
+	if info, _ := os.Stat(conf.Backup.AOFPath); info.Size() != size {
+		t.Errorf("file is not truncated to %d: %d", size, info.Size())
+	}
+
+	// length of the last record beyond the end of the file is not allocated
+	var l [binary.MaxVarintLen64]byte
+	f, _ = os.OpenFile(conf.Backup.AOFPath, os.O_APPEND|os.O_WRONLY, 0644)
+	f.Write(l[:binary.PutUvarint(l[:], maxRecordSize-1)])
+	f.Close()
+
+	tr, err = NewCache(conf)
+	if err != nil {
+		t.Fatal("Couldn't replay file with too long record:", err)
+	}
+	tr.Close(context.Background())
+	if info, _ := os.Stat(conf.Backup.AOFPath); info.Size() != size {
+		t.Errorf("file is not truncated to %d: %d", size, info.Size())
+	}
+
+	// damaged record in the middle is an error
+	buf, _ := os.ReadFile(conf.Backup.AOFPath)
+	buf[len(aofMagic)+4] ^= 0xFF
+	os.WriteFile(conf.Backup.AOFPath, buf, 0644)
+	if _, err := NewCache(conf); err == nil {
+		t.Error("replayed file with damaged record")
+	}
+
+	os.WriteFile(conf.Backup.AOFPath, append([]byte(aofMagic), aofVersion-1), 0644)
+	if _, err := NewCache(conf); err == nil {
+		t.Error("replayed file of old version")
+	}
+
+	os.WriteFile(conf.Backup.AOFPath, []byte("not aof"), 0644)
+	if _, err := NewCache(conf); err == nil {
+		t.Error("replayed file without header")
+	}
+
+	conf.Backup.Fsync = "sometimes"
+	if _, err := NewCache(conf); err == nil {
+		t.Error("created cache with unknown fsync policy")
+	}
+}
+
+func TestAOFRewrite(t *testing.T) {
+	conf := aofConfig(t, FsyncNo)
+	tc, _ := NewCache(conf)
+	for i := 0; i < 1000; i++ {
+		tc.Set("a", i, DefaultExpiration)
+		tc.Set(key(i%10), i, DefaultExpiration)
+	}
+	tc.Set("deleted", 1, DefaultExpiration)
+	tc.Delete("deleted")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			tc.Set("concurrent"+strconv.Itoa(i%100), i, DefaultExpiration)
+		}
+	}()
+	if err := tc.RewriteAOF(); err != nil {
+		t.Fatal("Couldn't rewrite append only file:", err)
+	}
+	wg.Wait()
+
+	want := tc.Items()
+	if err := tc.RewriteAOF(); err != nil {
+		t.Fatal("Couldn't rewrite append only file:", err)
+	}
+	if info, _ := os.Stat(conf.Backup.AOFPath); info.Size() > 4*1024 {
+		t.Errorf("file is not compacted: %d bytes", info.Size())
+	}
+
+	tr := reopenAOF(t, tc, conf)
+	items := tr.Items()
+	if len(items) != len(want) {
+		t.Errorf("items count after rewrite is not %d: %d", len(want), len(items))
+	}
+	for k, v := range want {
+		if items[k].Value != v.Value {
+			t.Errorf("%s is not %v after rewrite: %v", k, v.Value, items[k].Value)
+		}
+	}
+	tr.Close(context.Background())
+
+	tc, _ = NewCache(configDefault())
+	if err := tc.RewriteAOF(); err == nil {
+		t.Error("rewrite without append only file")
+	}
+}
+
+func TestAOFAutoRewrite(t *testing.T) {
+	conf := aofConfig(t, FsyncNo)
+	conf.Backup.AOFRewriteMinSize = 1024
+	tc, _ := NewCache(conf)
+	for i := 0; i < 10000; i++ {
+		tc.Set("a", i, DefaultExpiration)
+		// writers do not wait for the rewrite, the test does
+		tc.aof.rewrites.Wait()
+	}
+
+	tc.aof.mu.Lock()
+	size := tc.aof.size
+	tc.aof.mu.Unlock()
+	// without rewrite the file has 10000 records of 12 bytes at least
+	if size > 60*1024 {
+		t.Errorf("file is not rewritten automatically: %d bytes", size)
+	}
+
+	tr := reopenAOF(t, tc, conf)
+	if a, _ := tr.Get("a"); a != 9999 {
+		t.Errorf("a is not 9999 after auto rewrite: %v", a)
+	}
+	tr.Close(context.Background())
+}
+
+func TestAOFFrom(t *testing.T) {
+	conf := aofConfig(t, FsyncEverySec)
+	tc, err := NewCacheFrom(conf, map[string]Item{"a": {Value: "a"}})
+	if err != nil {
+		t.Fatal("err with aof config:", err)
+	}
+
+	tr := reopenAOF(t, tc, conf)
+	if a, _ := tr.Get("a"); a != "a" {
+		t.Errorf("item of NewCacheFrom is not in append only file: %v", a)
+	}
+	tr.Close(context.Background())
+}
+
+func TestAOFNotRegistered(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+
+	if err := tc.Set("a", struct{ A int }{1}, DefaultExpiration); err == nil {
+		t.Error("set value of not registered type to append only file")
+	}
+	if err := tc.SetMulti(map[string]interface{}{"b": "b", "c": []interface{}{struct{}{}}}, DefaultExpiration); err == nil {
+		t.Error("set multi value of not registered type to append only file")
+	}
+	results, err := tc.Txn().Set("d", struct{ A int }{1}, DefaultExpiration).Exec()
+	if err != nil || results[0].Err == nil {
+		t.Error("transaction set value of not registered type to append only file:", err)
+	}
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if _, found := tc.Get(k); found {
+			t.Errorf("%s is set", k)
+		}
+	}
+	tc.Close(context.Background())
+}
+
+func TestAOFChangeSize(t *testing.T) {
+	conf := aofConfig(t, FsyncNo)
+	tc, _ := NewCache(conf)
+	for i := 0; i < 1000; i++ {
+		tc.RPush("l", key(i))
+	}
+
+	tc.aof.mu.Lock()
+	size := tc.aof.size
+	tc.aof.mu.Unlock()
+	// the whole list takes more than 14 kB
+	if size > 40*1000 {
+		t.Errorf("changes of the list take %d bytes", size)
+	}
+
+	tr := reopenAOF(t, tc, conf)
+	if n, _ := tr.LLen("l"); n != 1000 {
+		t.Errorf("list of 1000 elements is replayed with %d elements", n)
+	}
+	tr.Close(context.Background())
+}
+
+func TestAOFChangeReplayedOnce(t *testing.T) {
+	conf := aofConfig(t, FsyncNo)
+	tc, _ := NewCache(conf)
+	tc.HSet("h", map[string]string{"a": "1"})
+	tc.HSet("d", map[string]string{"a": "1"})
+	tc.RPush("l", "a", "b", "c")
+	tc.RPush("ld", "a")
+	tc.SAdd("s", "a", "b")
+	tc.ZAdd("z", 0, ZMember{"a", 1})
+	tc.XAdd("x", XAddArgs{Fields: map[string]string{"a": "1"}})
+
+	tc.aof.mu.Lock()
+	rewriteStart := tc.aof.size
+	tc.aof.mu.Unlock()
+
+	tc.HIncrBy("h", "a", 2)
+	tc.HDel("d", "a")
+	tc.HSet("d", map[string]string{"b": "2"})
+	tc.LPop("l")
+	tc.LPop("ld")
+	tc.RPush("ld", "b")
+	tc.SPop("s")
+	tc.ZIncrBy("z", 2, "a")
+	tc.XAdd("x", XAddArgs{Fields: map[string]string{"a": "2"}})
+
+	tr := reopenAOF(t, tc, conf)
+	want := dumpTypes(tr)
+
+	// the rewrite keeps records appended while the items are written, they
+	// follow items which already have their changes
+	records, err := os.ReadFile(conf.Backup.AOFPath)
+	if err != nil {
+		t.Fatal("Couldn't read append only file:", err)
+	}
+	file, err := os.Create(filepath.Join(t.TempDir(), "rewritten.aof"))
+	if err != nil {
+		t.Fatal("Couldn't create append only file:", err)
+	}
+	if err := tr.writeAOF(file); err != nil {
+		t.Fatal("Couldn't write append only file:", err)
+	}
+	file.Write(records[rewriteStart:])
+	file.Close()
+	tr.Close(context.Background())
+
+	conf.Backup.AOFPath = file.Name()
+	tr, err = NewCache(conf)
+	if err != nil {
+		t.Fatal("Couldn't replay rewritten append only file:", err)
+	}
+	if got := dumpTypes(tr); got != want {
+		t.Errorf("changes are replayed twice:\n%s\nwant\n%s", got, want)
+	}
+	tr.Close(context.Background())
+}
+
+func dumpTypes(tc *Cache) string {
+	h, _ := tc.HGetAll("h")
+	d, _ := tc.HGetAll("d")
+	l, _ := tc.LRange("l", 0, -1)
+	ld, _ := tc.LRange("ld", 0, -1)
+	s, _ := tc.SMembers("s")
+	z, _ := tc.ZRange("z", 0, -1)
+	x, _ := tc.XRange("x", "-", "+", 0)
+
+	return fmt.Sprintln(h, d, l, ld, s, z, x)
+}
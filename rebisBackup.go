@@ -14,21 +14,21 @@ type backup struct {
 
 func runBackup(c *cache, bp string, bi time.Duration) {
 	b := &backup{
-		Path:     bp + "/backup" + strconv.Itoa(int(time.Now().Unix())) + ".json",
+		Path:     bp + "/backup" + strconv.Itoa(int(time.Now().Unix())) + ".rdb",
 		Interval: bi,
 		stop:     make(chan bool),
 	}
 
 	if _, err := os.Create(b.Path); err != nil {
-		c.logger.Printf("can not open json file %s", err.Error())
+		c.logger.Printf("can not open backup file %s", err.Error())
 	}
 
 	c.backup = b
 	go b.run(c)
 }
 
-func stopBackup(c *Cache) {
-	c.backup.stop <- true
+func stopBackup(c *cache) {
+	close(c.backup.stop)
 }
 
 func (b *backup) run(c *cache) {
@@ -0,0 +1,318 @@
+package rebis
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+	Change is the change of the value of the data type made by its method,
+	it is the value of set events of data types and it is written to the
+	append-only file instead of the whole value. Op is the name of the
+	method and Args are its arguments after the key. Random and time
+	dependent arguments are resolved: SPop gets the popped member, XAdd the
+	ID of the entry, XGroupCreate the ID of "$", XReadGroup and XClaim get
+	the time of the delivery in unix nanoseconds after the consumer.
+*/
+type Change struct {
+	Op   string
+	Args []string
+}
+
+/*
+	Reads arguments of the change one by one, the first error is kept.
+*/
+type changeReader struct {
+	args []string
+	err  error
+}
+
+/*
+	Methods which replay changes of the append-only file by Op. The value
+	has the same version as when the change was made, so the method makes
+	the same change.
+*/
+var changeReplays = map[string]func(c *cache, k string, r *changeReader) error{
+	"HSet": func(c *cache, k string, r *changeReader) error {
+		args := r.rest()
+		if len(args)%2 != 0 {
+			return fmt.Errorf("%w: field without value", errSnapshotFormat)
+		}
+
+		fields := make(map[string]string, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			fields[args[i]] = args[i+1]
+		}
+
+		_, err := c.HSet(k, fields)
+
+		return err
+	},
+	"HDel": func(c *cache, k string, r *changeReader) error {
+		_, err := c.HDel(k, r.rest()...)
+
+		return err
+	},
+	"HIncrBy": func(c *cache, k string, r *changeReader) error {
+		field, n := r.string(), r.int()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.HIncrBy(k, field, n)
+
+		return err
+	},
+	"HIncrByFloat": func(c *cache, k string, r *changeReader) error {
+		field, n := r.string(), r.float()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.HIncrByFloat(k, field, n)
+
+		return err
+	},
+	"LPush": func(c *cache, k string, r *changeReader) error {
+		_, err := c.LPush(k, r.rest()...)
+
+		return err
+	},
+	"RPush": func(c *cache, k string, r *changeReader) error {
+		_, err := c.RPush(k, r.rest()...)
+
+		return err
+	},
+	"LPop": func(c *cache, k string, r *changeReader) error {
+		_, _, err := c.LPop(k)
+
+		return err
+	},
+	"RPop": func(c *cache, k string, r *changeReader) error {
+		_, _, err := c.RPop(k)
+
+		return err
+	},
+	"LTrim": func(c *cache, k string, r *changeReader) error {
+		start, stop := r.int(), r.int()
+		if r.err != nil {
+			return r.err
+		}
+
+		return c.LTrim(k, int(start), int(stop))
+	},
+	"LRem": func(c *cache, k string, r *changeReader) error {
+		count, v := r.int(), r.string()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.LRem(k, int(count), v)
+
+		return err
+	},
+	"SAdd": func(c *cache, k string, r *changeReader) error {
+		_, err := c.SAdd(k, r.rest()...)
+
+		return err
+	},
+	"SRem": func(c *cache, k string, r *changeReader) error {
+		_, err := c.SRem(k, r.rest()...)
+
+		return err
+	},
+	"SPop": func(c *cache, k string, r *changeReader) error {
+		_, err := c.SRem(k, r.rest()...)
+
+		return err
+	},
+	"ZAdd": func(c *cache, k string, r *changeReader) error {
+		flags := r.int()
+
+		var members []ZMember
+		for len(r.args) > 0 {
+			members = append(members, ZMember{Member: r.string(), Score: r.float()})
+		}
+
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.ZAdd(k, ZAddFlag(flags), members...)
+
+		return err
+	},
+	"ZAddIncr": func(c *cache, k string, r *changeReader) error {
+		flags, member, n := r.int(), r.string(), r.float()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, _, err := c.ZAddIncr(k, ZAddFlag(flags), member, n)
+
+		return err
+	},
+	"ZRem": func(c *cache, k string, r *changeReader) error {
+		_, err := c.ZRem(k, r.rest()...)
+
+		return err
+	},
+	"ZRemRangeByScore": func(c *cache, k string, r *changeReader) error {
+		min, max := r.string(), r.string()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.ZRemRangeByScore(k, min, max)
+
+		return err
+	},
+	"ZPopMin": func(c *cache, k string, r *changeReader) error {
+		count := r.int()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.ZPopMin(k, int(count))
+
+		return err
+	},
+	"ZPopMax": func(c *cache, k string, r *changeReader) error {
+		count := r.int()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.ZPopMax(k, int(count))
+
+		return err
+	},
+	"XAdd": func(c *cache, k string, r *changeReader) error {
+		id, maxLen := r.string(), r.int()
+
+		fields := make(map[string]string)
+		for len(r.args) > 0 {
+			f, v := r.string(), r.string()
+			fields[f] = v
+		}
+
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.XAdd(k, XAddArgs{ID: id, Fields: fields, MaxLen: int(maxLen)})
+
+		return err
+	},
+	"XGroupCreate": func(c *cache, k string, r *changeReader) error {
+		group, id, mkStream := r.string(), r.string(), r.bool()
+		if r.err != nil {
+			return r.err
+		}
+
+		return c.XGroupCreate(k, group, id, mkStream)
+	},
+	"XAck": func(c *cache, k string, r *changeReader) error {
+		group := r.string()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.XAck(k, group, r.rest()...)
+
+		return err
+	},
+	"XReadGroup": func(c *cache, k string, r *changeReader) error {
+		group, consumer, now, id, count := r.string(), r.string(), r.int(), r.string(), r.int()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.xreadGroup(k, group, consumer, now, id, int(count))
+
+		return err
+	},
+	"XClaim": func(c *cache, k string, r *changeReader) error {
+		group, consumer, now, minIdle := r.string(), r.string(), r.int(), r.int()
+		if r.err != nil {
+			return r.err
+		}
+
+		_, err := c.xclaim(k, group, consumer, now, time.Duration(minIdle), r.rest())
+
+		return err
+	},
+}
+
+/*
+	Returns a copy of the arguments, variadic arguments can be changed by
+	the caller after the method returns.
+*/
+func changeArgs(args ...string) []string {
+	return append([]string(nil), args...)
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func formatFloat(n float64) string {
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+func (r *changeReader) string() string {
+	if len(r.args) == 0 {
+		r.fail(fmt.Errorf("%w: missing argument", errSnapshotFormat))
+
+		return ""
+	}
+
+	s := r.args[0]
+	r.args = r.args[1:]
+
+	return s
+}
+
+func (r *changeReader) int() int64 {
+	n, err := strconv.ParseInt(r.string(), 10, 64)
+	if err != nil {
+		r.fail(fmt.Errorf("%w: %s", errSnapshotFormat, err))
+	}
+
+	return n
+}
+
+func (r *changeReader) float() float64 {
+	n, err := strconv.ParseFloat(r.string(), 64)
+	if err != nil {
+		r.fail(fmt.Errorf("%w: %s", errSnapshotFormat, err))
+	}
+
+	return n
+}
+
+func (r *changeReader) bool() bool {
+	b, err := strconv.ParseBool(r.string())
+	if err != nil {
+		r.fail(fmt.Errorf("%w: %s", errSnapshotFormat, err))
+	}
+
+	return b
+}
+
+/*
+	Returns the rest of arguments.
+*/
+func (r *changeReader) rest() []string {
+	args := r.args
+	r.args = nil
+
+	return args
+}
+
+func (r *changeReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
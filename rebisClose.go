@@ -0,0 +1,78 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrClosed is returned by operations of the closed cache.
+var ErrClosed = errors.New("rebis: cache is closed")
+
+/*
+	Close stops janitor, backup, append-only file and subscriptions of the
+	cache, blocked BLPop and BRPop return ErrClosed. It waits for the backup
+	and rewrite of the append-only file in progress and saves the final
+	backup if backup.saveOnClose is set in config. If ctx is done before,
+	the final backup is not saved and ctx error is returned.
+
+	After Close methods of the cache which return an error return ErrClosed,
+	Get methods report a miss and other changing methods do nothing. Close
+	must be called explicitly, the collected cache only stops its janitor.
+*/
+func (c *cache) Close(ctx context.Context) error {
+	if !atomic.CompareAndSwapUint32(&c.closed, 0, 1) {
+		return ErrClosed
+	}
+
+	// writers check the flag under the shard lock, wait for the started ones
+	c.lockAll()
+	c.unlockAll()
+
+	if c.janitor != nil {
+		stopJanitor(c)
+	}
+
+	if c.backup != nil {
+		stopBackup(c)
+	}
+
+	saved := make(chan struct{})
+
+	go func() {
+		c.saving.Lock()
+		close(saved)
+	}()
+
+	var err error
+
+	select {
+	case <-saved:
+		if c.saveOnClose {
+			err = c.saveSnapshot(c.backup.Path)
+		}
+
+		c.saving.Unlock()
+	case <-ctx.Done():
+		err = ctx.Err()
+
+		go func() {
+			<-saved
+			c.saving.Unlock()
+		}()
+	}
+
+	if c.aof != nil {
+		stopAOF(c)
+	}
+
+	c.events.closeAll()
+	c.waits.wakeAll()
+	c.logIf("cache is closed")
+
+	return err
+}
+
+func (c *cache) isClosed() bool {
+	return atomic.LoadUint32(&c.closed) == 1
+}
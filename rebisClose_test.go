@@ -0,0 +1,159 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func closeConfig(t *testing.T) *Config {
+	conf := configDefault()
+	conf.CleanupInterval = time.Millisecond
+	conf.Backup = Backup{
+		InUse:       true,
+		Interval:    time.Millisecond,
+		Path:        t.TempDir(),
+		SaveOnClose: true,
+	}
+
+	return conf
+}
+
+func TestClose(t *testing.T) {
+	tc, err := NewCache(closeConfig(t))
+	if err != nil {
+		t.Fatal("err with close config:", err)
+	}
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+
+	if err := tc.Close(context.Background()); err != nil {
+		t.Fatal("Couldn't close cache:", err)
+	}
+	if err := tc.Close(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Error("second Close returned:", err)
+	}
+
+	checks := map[string]error{
+		"Set":                tc.Set("c", 1, DefaultExpiration),
+		"Add":                tc.Add("c", 1, DefaultExpiration),
+		"Replace":            tc.Replace("a", 2, DefaultExpiration),
+		"Increment":          tc.Increment("a", 1),
+		"BackupSave":         tc.BackupSave(),
+		"BackupRecovery":     tc.BackupRecovery(),
+		"BackupSaveFile":     tc.BackupSaveFile("test.rdb"),
+		"BackupRecoveryFile": tc.BackupRecoveryFile("test.rdb"),
+	}
+	if _, err := tc.IncrementInt("a", 1); !errors.Is(err, ErrClosed) {
+		checks["IncrementInt"] = err
+	}
+	for name, err := range checks {
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("%s after Close returned: %v", name, err)
+		}
+	}
+
+	tc.Delete("a")
+	tc.Flush()
+	tc.DeleteExpired()
+	if n := tc.ItemCount(); n != 2 {
+		t.Errorf("items are changed after Close: %d", n)
+	}
+	if a, found := tc.Get("a"); found {
+		t.Errorf("a is found after Close: %v", a)
+	}
+	if values := tc.GetMulti([]string{"a", "b"}); len(values) != 0 {
+		t.Errorf("items are found after Close: %v", values)
+	}
+
+	// final backup is saved
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(tc.backup.Path); err != nil {
+		t.Fatal("Couldn't recover final backup:", err)
+	}
+	if n := tr.ItemCount(); n != 2 {
+		t.Errorf("final backup has not 2 items: %d", n)
+	}
+}
+
+func TestCloseWaitsBackup(t *testing.T) {
+	tc, _ := NewCache(closeConfig(t))
+
+	// backup in progress
+	tc.saving.RLock()
+
+	closed := make(chan error)
+	go func() {
+		closed <- tc.Close(context.Background())
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close did not wait for backup")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	tc.saving.RUnlock()
+	if err := <-closed; err != nil {
+		t.Error("Couldn't close cache:", err)
+	}
+}
+
+func TestCloseContext(t *testing.T) {
+	tc, _ := NewCache(closeConfig(t))
+	tc.saving.RLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := tc.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Close with expired context returned:", err)
+	}
+	if err := tc.Set("a", 1, DefaultExpiration); !errors.Is(err, ErrClosed) {
+		t.Error("Set after Close returned:", err)
+	}
+	tc.saving.RUnlock()
+}
+
+func TestCloseGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 10; i++ {
+		tc, _ := NewCache(closeConfig(t))
+		tc.Close(context.Background())
+	}
+
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		<-time.After(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines are leaked: %d > %d", n, before)
+	}
+}
+
+func TestCollectedCacheStopsJanitor(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	conf := configDefault()
+	conf.CleanupInterval = time.Millisecond
+	for i := 0; i < 10; i++ {
+		NewCache(conf)
+	}
+
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		runtime.GC()
+		<-time.After(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("janitors of collected caches are not stopped: %d > %d", n, before)
+	}
+}
+
+func TestSaveOnCloseConfig(t *testing.T) {
+	conf := configDefault()
+	conf.Backup.SaveOnClose = true
+	if _, err := NewCache(conf); err == nil {
+		t.Error("created cache with save on close without backup")
+	}
+}
@@ -21,33 +21,50 @@ const (
 	Config for create cache.
 */
 type Config struct {
-	Size              uintptr       `yaml:"size"`              // how many elements should fit into the cache
-	Backup            Backup        `yaml:"backup"`            // meta backup
-	DefaultExpiration time.Duration `yaml:"defaultExpiration"` // default time of life element
-	CleanupInterval   time.Duration `yaml:"cleanupInterval"`   // interval for cleanup
-	LogAll            bool          `yaml:"logAll"`            // log in standard out or not
-	Evicted           bool          `yaml:"evicted"`           // do standard function with expired item
+	Size               uintptr        `yaml:"size"`               // size of the cache in KB, used if MaxMemory is not set
+	MaxMemory          uintptr        `yaml:"maxMemory"`          // size of the cache in bytes
+	Shards             int            `yaml:"shards"`             // count of independently locked parts of the cache
+	Backup             Backup         `yaml:"backup"`             // meta backup
+	DefaultExpiration  time.Duration  `yaml:"defaultExpiration"`  // default time of life element
+	CleanupInterval    time.Duration  `yaml:"cleanupInterval"`    // interval for cleanup
+	NegativeExpiration time.Duration  `yaml:"negativeExpiration"` // time of life of loader errors in GetOrLoad, 0 does not keep them
+	SlidingExpiration  bool           `yaml:"slidingExpiration"`  // expiration of items is moved forward by reads
+	MaxLifetime        time.Duration  `yaml:"maxLifetime"`        // maximum time of life of sliding items, 0 is unlimited
+	LogAll             bool           `yaml:"logAll"`             // log in standard out or not
+	Evicted            bool           `yaml:"evicted"`            // do standard function with expired item
+	EvictionPolicy     EvictionPolicy `yaml:"evictionPolicy"`     // which items are evicted when the cache is full
+	EvictionSamples    int            `yaml:"evictionSamples"`    // how many items are sampled to select one for eviction
 }
 
 /*
 	Backup is configuration for backup logic.
 */
 type Backup struct {
-	Path     string        `yaml:"path,omitempty"`     // path to save backup, must be like "./backup"
-	Interval time.Duration `yaml:"interval,omitempty"` // interval for save backup, its hard operation
-	InUse    bool          `yaml:"inUse"`              // use backup save or not
+	Path                 string        `yaml:"path,omitempty"`                 // path to save backup, must be like "./backup"
+	Interval             time.Duration `yaml:"interval,omitempty"`             // interval for save backup, its hard operation
+	InUse                bool          `yaml:"inUse"`                          // use backup save or not
+	SaveOnClose          bool          `yaml:"saveOnClose,omitempty"`          // save backup when the cache is closed
+	AOF                  bool          `yaml:"aof"`                            // log every change to the append-only file and replay it on start
+	AOFPath              string        `yaml:"aofPath,omitempty"`              // path of the append-only file, "appendonly.aof" in Path by default
+	Fsync                FsyncPolicy   `yaml:"fsync,omitempty"`                // when the append-only file is synced: always, everysec or no
+	AOFRewriteMinSize    int64         `yaml:"aofRewriteMinSize,omitempty"`    // minimal size of the append-only file in bytes for automatic rewrite
+	AOFRewritePercentage int           `yaml:"aofRewritePercentage,omitempty"` // growth of the append-only file since the last rewrite in percents for automatic rewrite, negative disables it
 }
 
 func configDefault() *Config {
 	return &Config{
-		Size: DefaultSize,
+		Size:   DefaultSize,
+		Shards: DefaultShards,
 		Backup: Backup{
 			InUse: false,
+			AOF:   false,
 		},
 		DefaultExpiration: DefaultDefaultExpiration,
 		CleanupInterval:   DefaultCleanupInterval,
 		LogAll:            false,
 		Evicted:           false,
+		EvictionPolicy:    DefaultEvictionPolicy,
+		EvictionSamples:   DefaultEvictionSamples,
 	}
 }
 
@@ -0,0 +1,250 @@
+package rebis
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultEventBuffer is the buffer of subscriptions created with buffer 0.
+const DefaultEventBuffer = 128
+
+/*
+	EventType is a type of keyspace events, types can be combined to
+	subscribe to several of them.
+*/
+type EventType uint8
+
+const (
+	EventSet     EventType = 1 << iota // item is written by Set, Add, Replace and others
+	EventDelete                        // item is deleted
+	EventExpired                       // expired item is deleted by janitor or DeleteExpired
+	EventEvicted                       // item is evicted because the cache is full
+	EventIncr                          // item is incremented or decremented
+	EventExpire                        // expiration of the item is changed
+	EventFlush                         // all items are deleted by Flush, the key is empty
+
+	EventAll = EventSet | EventDelete | EventExpired | EventEvicted | EventIncr | EventExpire | EventFlush
+)
+
+var eventNames = []string{"set", "del", "expired", "evicted", "incr", "expire", "flush"}
+
+/*
+	Event is a change of the keyspace. Value is the new value for set and
+	incr events and the old value for del, expired and evicted events. Set
+	events of changes of data types by their methods have Change as Value
+	instead of the whole value.
+*/
+type Event struct {
+	Type  EventType
+	Key   string
+	Value interface{}
+	Time  time.Time
+}
+
+/*
+	Subscription receives events of the cache. Events are sent without
+	waiting, events which do not fit into the buffer are dropped and
+	counted, so slow subscribers never block writers.
+*/
+type Subscription struct {
+	dropped uint64 // atomic
+
+	C <-chan Event // events of the subscription, closed by Close
+
+	c       *cache
+	pattern string
+	types   EventType
+	mu      sync.RWMutex // held for reading by senders, Close waits for them
+	ch      chan Event
+	closed  bool
+}
+
+/*
+	eventBus keeps subscriptions of the cache. The slice is replaced on every
+	change, so writers read it without locks.
+*/
+type eventBus struct {
+	mu   sync.Mutex
+	subs atomic.Value // []*Subscription
+}
+
+/*
+	Returns names of the event types joined by "|".
+*/
+func (t EventType) String() string {
+	var names []string
+
+	for i, name := range eventNames {
+		if t&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+/*
+	Subscribe returns a subscription to events of the types for keys which
+	match the glob-style pattern, empty pattern matches all keys. Flush
+	events are sent to all subscriptions to them. If buffer is not positive,
+	DefaultEventBuffer is used.
+*/
+func (c *cache) Subscribe(pattern string, types EventType, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultEventBuffer
+	}
+
+	ch := make(chan Event, buffer)
+	sub := &Subscription{C: ch, c: c, pattern: pattern, types: types, ch: ch}
+
+	c.events.mu.Lock()
+	subs := c.events.load()
+	c.events.subs.Store(append(subs[:len(subs):len(subs)], sub))
+	c.events.mu.Unlock()
+
+	c.logIf("subscribe to %s events of %q", types, pattern)
+
+	return sub
+}
+
+/*
+	SubscribeFunc calls f for events like Subscribe. f is called from one
+	goroutine in the order of events, events are dropped while the buffer is
+	full.
+*/
+func (c *cache) SubscribeFunc(pattern string, types EventType, buffer int, f func(Event)) *Subscription {
+	sub := c.Subscribe(pattern, types, buffer)
+
+	go func() {
+		for e := range sub.C {
+			f(e)
+		}
+	}()
+
+	return sub
+}
+
+/*
+	Close stops the subscription and closes its channel, events in the
+	buffer can still be read.
+*/
+func (sub *Subscription) Close() {
+	c := sub.c
+
+	c.events.mu.Lock()
+	subs := c.events.load()
+	kept := make([]*Subscription, 0, len(subs))
+
+	for _, s := range subs {
+		if s != sub {
+			kept = append(kept, s)
+		}
+	}
+
+	c.events.subs.Store(kept)
+	c.events.mu.Unlock()
+
+	sub.close()
+}
+
+/*
+	Dropped returns the count of events which did not fit into the buffer.
+*/
+func (sub *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&sub.dropped)
+}
+
+func (sub *Subscription) close() {
+	sub.mu.Lock()
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+	sub.mu.Unlock()
+}
+
+/*
+	Returns true if the subscription wants events of the type for the key.
+*/
+func (sub *Subscription) wants(t EventType, k string) bool {
+	if sub.types&t == 0 {
+		return false
+	}
+
+	return t == EventFlush || sub.pattern == "" || match(sub.pattern, k)
+}
+
+/*
+	Send the event to the subscription if it wants it, never waits.
+*/
+func (sub *Subscription) send(e Event) {
+	if !sub.wants(e.Type, e.Key) {
+		return
+	}
+
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+
+	if sub.closed {
+		return
+	}
+
+	select {
+	case sub.ch <- e:
+	default:
+		atomic.AddUint64(&sub.dropped, 1)
+	}
+}
+
+/*
+	Publish the event to subscriptions, it is called under the shard lock of
+	the key, so events of the key come in order. The value is copied only if
+	a subscription wants the event and the value stays in the cache.
+*/
+func (c *cache) publish(t EventType, k string, v interface{}) {
+	subs := c.events.load()
+
+	wanted := false
+	for _, sub := range subs {
+		if sub.wants(t, k) {
+			wanted = true
+
+			break
+		}
+	}
+
+	if !wanted {
+		return
+	}
+
+	if t&(EventDelete|EventExpired|EventEvicted) == 0 {
+		v = detach(v)
+	}
+
+	e := Event{Type: t, Key: k, Value: v, Time: time.Now()}
+	for _, sub := range subs {
+		sub.send(e)
+	}
+}
+
+func (b *eventBus) load() []*Subscription {
+	subs, _ := b.subs.Load().([]*Subscription)
+
+	return subs
+}
+
+/*
+	Close all subscriptions, called by Close of the cache.
+*/
+func (b *eventBus) closeAll() {
+	b.mu.Lock()
+	subs := b.load()
+	b.subs.Store([]*Subscription(nil))
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+}
@@ -0,0 +1,176 @@
+package rebis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+
+	select {
+	case e := <-sub.C:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("event is not received")
+	}
+
+	return Event{}
+}
+
+func TestEvents(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 4096
+	conf.EvictionPolicy = EvictAllKeysLRU
+	tc, _ := NewCache(conf)
+	sub := tc.Subscribe("", EventAll, 0)
+	defer sub.Close()
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Increment("a", 2)
+	tc.Expire("a", time.Hour)
+	tc.Delete("a")
+	tc.Set("short", "x", time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	tc.DeleteExpired()
+	tc.Set("big", make([]byte, 3000), DefaultExpiration)
+	tc.Set("next", make([]byte, 3000), DefaultExpiration)
+	tc.Flush()
+
+	want := []struct {
+		t EventType
+		k string
+	}{
+		{EventSet, "a"}, {EventIncr, "a"}, {EventExpire, "a"}, {EventDelete, "a"},
+		{EventSet, "short"}, {EventExpired, "short"}, {EventSet, "big"},
+		{EventEvicted, "big"}, {EventSet, "next"}, {EventFlush, ""},
+	}
+	for _, w := range want {
+		if e := receive(t, sub); e.Type != w.t || e.Key != w.k {
+			t.Errorf("event is %s %q, want %s %q", e.Type, e.Key, w.t, w.k)
+		}
+	}
+	if sub.Dropped() != 0 {
+		t.Errorf("%d events are dropped", sub.Dropped())
+	}
+}
+
+func TestEventsValues(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	sub := tc.Subscribe("", EventSet|EventIncr|EventDelete, 0)
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.IncrementInt("a", 1)
+	tc.Delete("a")
+	for _, want := range []interface{}{1, 2, 2} {
+		if e := receive(t, sub); e.Value != want || e.Time.IsZero() {
+			t.Errorf("%s event value is %v, want %v", e.Type, e.Value, want)
+		}
+	}
+}
+
+func TestEventsChanges(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	sub := tc.Subscribe("", EventSet, 0)
+
+	values := []string{"a", "b"}
+	tc.RPush("l", values...)
+	values[0] = "c"
+	tc.SAdd("s", "a", "b")
+	member, _, _ := tc.SPop("s")
+	tc.ZIncrBy("z", 1.5, "a")
+
+	for _, want := range []Change{
+		{"RPush", []string{"a", "b"}},
+		{"SAdd", []string{"a", "b"}},
+		{"SPop", []string{member}},
+		{"ZAddIncr", []string{"0", "a", "1.5"}},
+	} {
+		if e := receive(t, sub); !reflect.DeepEqual(e.Value, want) {
+			t.Errorf("set event value of %s is %v, want %v", e.Key, e.Value, want)
+		}
+	}
+}
+
+func TestEventsFilter(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	sub := tc.Subscribe("user:*", EventDelete|EventFlush, 0)
+
+	tc.Set("user:1", 1, DefaultExpiration)
+	tc.Set("post:1", 1, DefaultExpiration)
+	tc.Delete("post:1")
+	tc.Delete("user:1")
+	tc.Flush()
+
+	if e := receive(t, sub); e.Type != EventDelete || e.Key != "user:1" {
+		t.Errorf("filtered event is %s %q", e.Type, e.Key)
+	}
+	if e := receive(t, sub); e.Type != EventFlush {
+		t.Errorf("flush event is %s", e.Type)
+	}
+	select {
+	case e := <-sub.C:
+		t.Errorf("unexpected event %s %q", e.Type, e.Key)
+	default:
+	}
+}
+
+func TestEventsDropped(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	sub := tc.Subscribe("", EventSet, 2)
+
+	for i := 0; i < 5; i++ {
+		tc.Set(key(i), i, DefaultExpiration)
+	}
+	if d := sub.Dropped(); d != 3 {
+		t.Errorf("dropped events are %d, not 3", d)
+	}
+
+	sub.Close()
+	tc.Set("after", 1, DefaultExpiration)
+	n := 0
+	for range sub.C {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("%d events are in the buffer after Close", n)
+	}
+	sub.Close()
+}
+
+func TestEventsFunc(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	got := make(chan Event, 10)
+	tc.SubscribeFunc("", EventSet, 0, func(e Event) {
+		got <- e
+	})
+
+	tc.Set("a", 1, DefaultExpiration)
+	select {
+	case e := <-got:
+		if e.Key != "a" {
+			t.Errorf("event of func is for %q", e.Key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("func is not called")
+	}
+}
+
+func TestEventsClose(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	sub := tc.Subscribe("", EventAll, 0)
+
+	tc.Close(context.Background())
+	if _, ok := <-sub.C; ok {
+		t.Error("event is received after Close")
+	}
+	sub.Close()
+}
+
+func TestEventTypeString(t *testing.T) {
+	if s := (EventSet | EventExpired).String(); s != "set|expired" {
+		t.Errorf("event type string is %q", s)
+	}
+}
@@ -0,0 +1,225 @@
+package rebis
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	EvictionPolicy defines which items are evicted when the cache is full.
+*/
+type EvictionPolicy string
+
+const (
+	NoEviction       EvictionPolicy = "noeviction"   // reject writes when the cache is full
+	EvictAllKeysLRU  EvictionPolicy = "allkeys-lru"  // evict the least recently used item
+	EvictAllKeysLFU  EvictionPolicy = "allkeys-lfu"  // evict the least frequently used item
+	EvictVolatileLRU EvictionPolicy = "volatile-lru" // evict the least recently used item with expiration
+	EvictVolatileTTL EvictionPolicy = "volatile-ttl" // evict the item with expiration nearest to now
+	EvictFIFO        EvictionPolicy = "fifo"         // evict the first added item of the sampled ones
+	EvictRandom      EvictionPolicy = "random"       // evict a random item
+
+	DefaultEvictionPolicy  = NoEviction
+	DefaultEvictionSamples = 5
+)
+
+/*
+	itemMeta is access information of the item used by eviction policies,
+	it is shared between copies of the Item so Get updates it under read lock.
+*/
+type itemMeta struct {
+	accessed int64  // atomic, unix nano of the last access
+	hits     uint32 // atomic, count of accesses
+	created  uint64 // number of the item in order of adding
+}
+
+/*
+	candidate is an item sampled for eviction.
+*/
+type candidate struct {
+	s    *shard
+	key  string
+	item Item
+}
+
+/*
+	Check that the policy is known.
+*/
+func (p EvictionPolicy) valid() bool {
+	switch p {
+	case NoEviction, EvictAllKeysLRU, EvictAllKeysLFU, EvictVolatileLRU,
+		EvictVolatileTTL, EvictFIFO, EvictRandom:
+		return true
+	}
+
+	return false
+}
+
+/*
+	Returns new access information for the item or nil if eviction is disabled.
+*/
+func (c *cache) newMeta() *itemMeta {
+	if c.evictionPolicy == NoEviction {
+		return nil
+	}
+
+	return &itemMeta{
+		accessed: time.Now().UnixNano(),
+		created:  atomic.AddUint64(&c.created, 1),
+	}
+}
+
+/*
+	Mark the item as used right now.
+*/
+func (m *itemMeta) touch() {
+	if m == nil {
+		return
+	}
+
+	atomic.StoreInt64(&m.accessed, time.Now().UnixNano())
+	atomic.AddUint32(&m.hits, 1)
+}
+
+/*
+	Evict one item selected by the policy. Policies are approximated like in
+	Redis: evictionSamples items are sampled from the shards, starting from a
+	random one, and the worst of them is evicted, so fifo evicts the oldest
+	sampled item rather than the oldest one of the cache. Expired items are
+	always evicted first. Returns false if there is no item to evict.
+*/
+func (c *cache) evict() bool {
+	if c.evictionPolicy == NoEviction {
+		return false
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		victim, found := c.sample()
+		if !found {
+			return false
+		}
+
+		s := victim.s
+		s.mu.Lock()
+
+		if item, found := s.items[victim.key]; !found || item.meta != victim.item.meta {
+			s.mu.Unlock()
+
+			continue
+		}
+
+		v, evicted := c.remove(s, victim.key, EventEvicted)
+		s.mu.Unlock()
+
+		atomic.AddUint64(&c.evictions, 1)
+		c.logIf("evict %s by %s", victim.key, c.evictionPolicy)
+
+		if evicted {
+			c.onEvicted(victim.key, v)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+/*
+	Sample items from the shards and return the best candidate for eviction.
+*/
+func (c *cache) sample() (candidate, bool) {
+	var (
+		best    candidate
+		found   bool
+		sampled int
+	)
+
+	now := time.Now().UnixNano()
+	start := rand.Intn(len(c.shards)) // nolint
+
+	for i := 0; i < len(c.shards) && sampled < c.evictionSamples; i++ {
+		s := c.shards[(start+i)%len(c.shards)]
+		s.mu.RLock()
+
+		for k, v := range s.items {
+			if sampled >= c.evictionSamples {
+				break
+			}
+
+			if !c.evictable(v) {
+				continue
+			}
+
+			sampled++
+
+			cand := candidate{s, k, v}
+			if !found || c.worse(cand, best, now) {
+				best, found = cand, true
+			}
+		}
+
+		s.mu.RUnlock()
+	}
+
+	return best, found
+}
+
+/*
+	Check that the item can be evicted by the policy.
+*/
+func (c *cache) evictable(v Item) bool {
+	switch c.evictionPolicy {
+	case EvictVolatileLRU, EvictVolatileTTL:
+		return v.Expiration > 0
+	default:
+		return true
+	}
+}
+
+/*
+	Returns true if candidate a should be evicted before candidate b.
+*/
+func (c *cache) worse(a, b candidate, now int64) bool {
+	aExpired := a.item.Expiration > 0 && now > a.item.Expiration
+	bExpired := b.item.Expiration > 0 && now > b.item.Expiration
+
+	if aExpired || bExpired {
+		return aExpired && !bExpired
+	}
+
+	am, bm := a.item.meta.load(), b.item.meta.load()
+
+	switch c.evictionPolicy {
+	case EvictAllKeysLRU, EvictVolatileLRU:
+		return am.accessed < bm.accessed
+	case EvictAllKeysLFU:
+		if am.hits != bm.hits {
+			return am.hits < bm.hits
+		}
+
+		return am.accessed < bm.accessed
+	case EvictVolatileTTL:
+		return a.item.Expiration < b.item.Expiration
+	case EvictFIFO:
+		return am.created < bm.created
+	default:
+		return false
+	}
+}
+
+/*
+	Returns a copy of the access information, the item without it is never
+	accessed and older than all others.
+*/
+func (m *itemMeta) load() itemMeta {
+	if m == nil {
+		return itemMeta{}
+	}
+
+	return itemMeta{
+		accessed: atomic.LoadInt64(&m.accessed),
+		hits:     atomic.LoadUint32(&m.hits),
+		created:  m.created,
+	}
+}
@@ -0,0 +1,162 @@
+package rebis
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newEvictionCache(t *testing.T, policy EvictionPolicy, slots int) *Cache {
+	conf := configDefault()
+	conf.Shards = 1
+	conf.EvictionPolicy = policy
+	conf.EvictionSamples = 16
+	tc, err := NewCache(conf)
+	if err != nil {
+		t.Fatalf("err with %s config: %s", policy, err)
+	}
+	tc.maxSize = uintptr(slots) * sizeOf("a", "a")
+
+	return tc
+}
+
+func setSlow(tc *Cache, k string, d time.Duration) {
+	tc.Set(k, k, d)
+	<-time.After(time.Millisecond)
+}
+
+func TestEvictionPolicyUnknown(t *testing.T) {
+	conf := configDefault()
+	conf.EvictionPolicy = "qwe"
+	if _, err := NewCache(conf); err == nil {
+		t.Error("not check unknown eviction policy")
+	}
+}
+
+func TestEvictionNo(t *testing.T) {
+	tc := newEvictionCache(t, NoEviction, 3)
+	setSlow(tc, "a", DefaultExpiration)
+	setSlow(tc, "b", DefaultExpiration)
+	setSlow(tc, "c", DefaultExpiration)
+	if err := tc.Set("d", "d", DefaultExpiration); err == nil {
+		t.Error("Set d in full cache without eviction")
+	}
+}
+
+func TestEvictionLRU(t *testing.T) {
+	tc := newEvictionCache(t, EvictAllKeysLRU, 3)
+	setSlow(tc, "a", DefaultExpiration)
+	setSlow(tc, "b", DefaultExpiration)
+	setSlow(tc, "c", DefaultExpiration)
+	tc.Get("a")
+	if err := tc.Set("d", "d", DefaultExpiration); err != nil {
+		t.Error("Couldn't set d with eviction:", err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("b was found, but it should have been evicted")
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("a was evicted, but it was used recently")
+	}
+	if tc.evictions != 1 {
+		t.Errorf("evictions is not 1: %d", tc.evictions)
+	}
+}
+
+func TestEvictionLFU(t *testing.T) {
+	tc := newEvictionCache(t, EvictAllKeysLFU, 3)
+	setSlow(tc, "a", DefaultExpiration)
+	setSlow(tc, "b", DefaultExpiration)
+	setSlow(tc, "c", DefaultExpiration)
+	tc.Get("a")
+	tc.Get("a")
+	tc.Get("b")
+	tc.Get("c")
+	tc.Get("c")
+	if err := tc.Set("d", "d", DefaultExpiration); err != nil {
+		t.Error("Couldn't set d with eviction:", err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("b was found, but it should have been evicted")
+	}
+}
+
+func TestEvictionFIFO(t *testing.T) {
+	tc := newEvictionCache(t, EvictFIFO, 3)
+	setSlow(tc, "a", DefaultExpiration)
+	setSlow(tc, "b", DefaultExpiration)
+	setSlow(tc, "c", DefaultExpiration)
+	tc.Get("a")
+	setSlow(tc, "a", DefaultExpiration)
+	if err := tc.Set("d", "d", DefaultExpiration); err != nil {
+		t.Error("Couldn't set d with eviction:", err)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("a was found, but it should have been evicted")
+	}
+}
+
+func TestEvictionVolatile(t *testing.T) {
+	tc := newEvictionCache(t, EvictVolatileTTL, 3)
+	setSlow(tc, "a", NoExpiration)
+	setSlow(tc, "b", time.Hour)
+	setSlow(tc, "c", time.Minute)
+	if err := tc.Set("d", "d", NoExpiration); err != nil {
+		t.Error("Couldn't set d with eviction:", err)
+	}
+	if _, found := tc.Get("c"); found {
+		t.Error("c was found, but it should have been evicted")
+	}
+	if err := tc.Set("e", "e", NoExpiration); err != nil {
+		t.Error("Couldn't set e with eviction:", err)
+	}
+	if err := tc.Set("f", "f", NoExpiration); !errors.Is(err, ErrNoMemory) {
+		t.Error("Set f without volatile items to evict:", err)
+	}
+
+	tc = newEvictionCache(t, EvictVolatileLRU, 2)
+	setSlow(tc, "a", time.Hour)
+	setSlow(tc, "b", time.Hour)
+	tc.Get("a")
+	if err := tc.Set("c", "c", time.Hour); err != nil {
+		t.Error("Couldn't set c with eviction:", err)
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("b was found, but it should have been evicted")
+	}
+}
+
+func TestEvictionExpiredFirst(t *testing.T) {
+	tc := newEvictionCache(t, EvictAllKeysLRU, 3)
+	setSlow(tc, "a", DefaultExpiration)
+	setSlow(tc, "b", DefaultExpiration)
+	setSlow(tc, "c", time.Millisecond)
+	tc.Get("a")
+	tc.Get("b")
+	if err := tc.Set("d", "d", DefaultExpiration); err != nil {
+		t.Error("Couldn't set d with eviction:", err)
+	}
+	if _, found := tc.Get("a"); !found {
+		t.Error("a was evicted before expired c")
+	}
+}
+
+func TestEvictionRandomOnEvicted(t *testing.T) {
+	tc := newEvictionCache(t, EvictRandom, 3)
+	evicted := 0
+	tc.OnEvicted(func(string, interface{}) {
+		evicted++
+	})
+	for i := 0; i < 10; i++ {
+		if err := tc.Set(strconv.Itoa(i), strconv.Itoa(i), DefaultExpiration); err != nil {
+			t.Error("Couldn't set with eviction:", err)
+		}
+	}
+	if n := tc.ItemCount(); n != 3 {
+		t.Errorf("Item count is not 3: %d", n)
+	}
+	if evicted != 7 || tc.evictions != 7 {
+		t.Errorf("evicted is not 7: %d, %d", evicted, tc.evictions)
+	}
+}
@@ -0,0 +1,324 @@
+package rebis
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+/*
+	Hash is a value of the hash data type, map of fields to their values.
+	Get returns a copy of the hash, it is changed only by H methods.
+*/
+type Hash map[string]string
+
+/*
+	Size of the hash is the size of its fields and values.
+*/
+func (h Hash) Size() uintptr {
+	var n uintptr
+	for f, v := range h {
+		n += uintptr(hashFieldSize(f, v))
+	}
+
+	return n
+}
+
+func (h Hash) length() int {
+	return len(h)
+}
+
+func (h Hash) clone() interface{} {
+	c := make(Hash, len(h))
+	for f, v := range h {
+		c[f] = v
+	}
+
+	return c
+}
+
+/*
+	HSet sets fields of the hash and returns the count of added fields. The
+	hash is created with the default expiration if the key is not found.
+*/
+func (c *cache) HSet(k string, fields map[string]string) (int, error) {
+	var added int
+
+	change := &Change{Op: "HSet", Args: make([]string, 0, 2*len(fields))}
+	for f, v := range fields {
+		change.Args = append(change.Args, f, v)
+	}
+
+	err := changeValue(c, k, change, func(h Hash, grow func(n int) bool) (Hash, error) {
+		if len(fields) == 0 {
+			return h, nil
+		}
+
+		var n int
+		for f, v := range fields {
+			if old, found := h[f]; found {
+				n += len(v) - len(old)
+			} else {
+				n += hashFieldSize(f, v)
+			}
+		}
+
+		if !grow(n) {
+			return h, errNoSlot
+		}
+
+		if h == nil {
+			h = make(Hash, len(fields))
+		}
+
+		for f, v := range fields {
+			if _, found := h[f]; !found {
+				added++
+			}
+
+			h[f] = v
+		}
+
+		return h, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("hset %s -> %v, added %d fields", k, fields, added)
+
+	return added, nil
+}
+
+/*
+	HGet returns the value of the field and a bool indicating whether the
+	field was found.
+*/
+func (c *cache) HGet(k, field string) (string, bool, error) {
+	var (
+		v     string
+		found bool
+	)
+
+	err := readValue(c, k, func(h Hash) {
+		v, found = h[field]
+	})
+
+	return v, found, err
+}
+
+/*
+	HMGet returns values of the fields, missing fields are not in the map.
+*/
+func (c *cache) HMGet(k string, fields ...string) (map[string]string, error) {
+	values := make(map[string]string, len(fields))
+
+	err := readValue(c, k, func(h Hash) {
+		for _, f := range fields {
+			if v, found := h[f]; found {
+				values[f] = v
+			}
+		}
+	})
+
+	return values, err
+}
+
+/*
+	HGetAll returns a copy of the hash, it is empty if the key is not found.
+*/
+func (c *cache) HGetAll(k string) (Hash, error) {
+	h := Hash{}
+
+	err := readValue(c, k, func(v Hash) {
+		h = v.clone().(Hash)
+	})
+
+	return h, err
+}
+
+/*
+	HLen returns the count of fields of the hash.
+*/
+func (c *cache) HLen(k string) (int, error) {
+	var n int
+
+	err := readValue(c, k, func(h Hash) {
+		n = len(h)
+	})
+
+	return n, err
+}
+
+/*
+	HExists returns true if the hash has the field.
+*/
+func (c *cache) HExists(k, field string) (bool, error) {
+	var found bool
+
+	err := readValue(c, k, func(h Hash) {
+		_, found = h[field]
+	})
+
+	return found, err
+}
+
+/*
+	HDel deletes fields of the hash and returns the count of deleted fields.
+	The key is deleted with its last field.
+*/
+func (c *cache) HDel(k string, fields ...string) (int, error) {
+	var deleted int
+
+	err := changeValue(c, k, &Change{Op: "HDel", Args: changeArgs(fields...)}, func(h Hash, grow func(n int) bool) (Hash, error) {
+		var n int
+		for _, f := range uniqueStrings(fields) {
+			if v, found := h[f]; found {
+				n -= hashFieldSize(f, v)
+			}
+		}
+
+		if n == 0 {
+			return h, nil
+		}
+
+		grow(n)
+
+		for _, f := range fields {
+			if _, found := h[f]; found {
+				delete(h, f)
+				deleted++
+			}
+		}
+
+		return h, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("hdel %s %v, deleted %d fields", k, fields, deleted)
+
+	return deleted, nil
+}
+
+/*
+	HIncrBy increments the integer value of the field by n and returns the
+	new value. The missing field is set to n.
+*/
+func (c *cache) HIncrBy(k, field string, n int64) (int64, error) {
+	var nv int64
+
+	change := &Change{Op: "HIncrBy", Args: []string{field, formatInt(n)}}
+
+	err := c.hChange(k, field, change, func(v string, found bool) (string, error) {
+		var x int64
+		if found {
+			var err error
+			if x, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return "", fmt.Errorf("hash value of %s is not an integer", field)
+			}
+		}
+
+		if (n > 0 && x > math.MaxInt64-n) || (n < 0 && x < math.MinInt64-n) {
+			return "", fmt.Errorf("increment of %s would overflow", field)
+		}
+
+		nv = x + n
+
+		return strconv.FormatInt(nv, 10), nil
+	})
+
+	return nv, err
+}
+
+/*
+	HIncrByFloat increments the float value of the field by n and returns
+	the new value. The missing field is set to n.
+*/
+func (c *cache) HIncrByFloat(k, field string, n float64) (float64, error) {
+	var nv float64
+
+	change := &Change{Op: "HIncrByFloat", Args: []string{field, formatFloat(n)}}
+
+	err := c.hChange(k, field, change, func(v string, found bool) (string, error) {
+		var x float64
+		if found {
+			var err error
+			if x, err = strconv.ParseFloat(v, 64); err != nil {
+				return "", fmt.Errorf("hash value of %s is not a float", field)
+			}
+		}
+
+		nv = x + n
+		if math.IsNaN(nv) || math.IsInf(nv, 0) {
+			return "", fmt.Errorf("increment of %s would produce NaN or Infinity", field)
+		}
+
+		return strconv.FormatFloat(nv, 'f', -1, 64), nil
+	})
+
+	return nv, err
+}
+
+/*
+	Change the value of one field of the hash, f returns the new value.
+*/
+func (c *cache) hChange(k, field string, change *Change, f func(v string, found bool) (string, error)) error {
+	err := changeValue(c, k, change, func(h Hash, grow func(n int) bool) (Hash, error) {
+		old, found := h[field]
+
+		v, err := f(old, found)
+		if err != nil {
+			return h, err
+		}
+
+		n := hashFieldSize(field, v)
+		if found {
+			n = len(v) - len(old)
+		}
+
+		if !grow(n) {
+			return h, errNoSlot
+		}
+
+		if h == nil {
+			h = make(Hash, 1)
+		}
+
+		h[field] = v
+
+		return h, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.logIf("hincr %s %s", k, field)
+
+	return nil
+}
+
+/*
+	Returns the count of bytes used by the field of the hash.
+*/
+func hashFieldSize(f, v string) int {
+	return 2*int(sizeString) + len(f) + len(v)
+}
+
+/*
+	Returns strings without duplicates, the order is not kept.
+*/
+func uniqueStrings(s []string) []string {
+	seen := make(map[string]struct{}, len(s))
+	unique := make([]string, 0, len(s))
+
+	for _, v := range s {
+		if _, found := seen[v]; !found {
+			seen[v] = struct{}{}
+			unique = append(unique, v)
+		}
+	}
+
+	return unique
+}
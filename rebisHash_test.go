@@ -0,0 +1,247 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHash(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	added, err := tc.HSet("h", map[string]string{"a": "1", "b": "2"})
+	if err != nil || added != 2 {
+		t.Fatalf("HSet added %d fields: %v", added, err)
+	}
+	if added, _ = tc.HSet("h", map[string]string{"b": "3", "c": "4"}); added != 1 {
+		t.Errorf("HSet of existing field is counted as added: %d", added)
+	}
+
+	if v, found, _ := tc.HGet("h", "b"); !found || v != "3" {
+		t.Errorf("HGet b = %q, %t", v, found)
+	}
+	if _, found, _ := tc.HGet("h", "x"); found {
+		t.Error("missing field x is found")
+	}
+	if m, _ := tc.HMGet("h", "a", "x"); !reflect.DeepEqual(m, map[string]string{"a": "1"}) {
+		t.Errorf("HMGet = %v", m)
+	}
+	if n, _ := tc.HLen("h"); n != 3 {
+		t.Errorf("HLen = %d", n)
+	}
+	if found, _ := tc.HExists("h", "c"); !found {
+		t.Error("HExists c = false")
+	}
+
+	if n, _ := tc.HDel("h", "a", "a", "x"); n != 1 {
+		t.Errorf("HDel deleted %d fields", n)
+	}
+	if h, _ := tc.HGetAll("h"); !reflect.DeepEqual(h, Hash{"b": "3", "c": "4"}) {
+		t.Errorf("HGetAll = %v", h)
+	}
+
+	tc.HDel("h", "b", "c")
+	if _, found := tc.Get("h"); found {
+		t.Error("hash without fields is not deleted")
+	}
+	if h, err := tc.HGetAll("h"); err != nil || h == nil || len(h) != 0 {
+		t.Errorf("HGetAll of missing key = %v, %v", h, err)
+	}
+	if n, _ := tc.HDel("h", "b"); n != 0 {
+		t.Errorf("HDel of missing key deleted %d fields", n)
+	}
+	if st := tc.Stats(); st.Items != 0 || st.Sets != 3 || st.Deletes != 1 {
+		t.Errorf("hash writes are counted wrong: %+v", st)
+	}
+}
+
+func TestHashIncr(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	if n, err := tc.HIncrBy("h", "a", 5); err != nil || n != 5 {
+		t.Fatalf("HIncrBy of missing field = %d, %v", n, err)
+	}
+	if n, _ := tc.HIncrBy("h", "a", -7); n != -2 {
+		t.Errorf("HIncrBy = %d", n)
+	}
+	if f, err := tc.HIncrByFloat("h", "a", 0.5); err != nil || f != -1.5 {
+		t.Errorf("HIncrByFloat = %g, %v", f, err)
+	}
+	if _, err := tc.HIncrBy("h", "a", 1); err == nil {
+		t.Error("float field is incremented by integer")
+	}
+
+	tc.HSet("h", map[string]string{"max": strconv.FormatInt(1<<63-1, 10), "s": "x"})
+	if _, err := tc.HIncrBy("h", "max", 1); err == nil {
+		t.Error("overflow of max is not detected")
+	}
+	if _, err := tc.HIncrByFloat("h", "s", 1); err == nil {
+		t.Error("not a number s is incremented")
+	}
+	if v, _, _ := tc.HGet("h", "max"); v != strconv.FormatInt(1<<63-1, 10) {
+		t.Errorf("failed increment changed max: %s", v)
+	}
+}
+
+func TestHashWrongType(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("s", "string", DefaultExpiration)
+
+	if _, err := tc.HSet("s", map[string]string{"a": "1"}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HSet of string: %v", err)
+	}
+	if _, _, err := tc.HGet("s", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HGet of string: %v", err)
+	}
+	if _, err := tc.HIncrBy("s", "a", 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("HIncrBy of string: %v", err)
+	}
+	if v, _ := tc.Get("s"); v != "string" {
+		t.Errorf("string is changed: %v", v)
+	}
+}
+
+func TestHashExpiration(t *testing.T) {
+	conf := configDefault()
+	conf.DefaultExpiration = time.Hour
+	tc, _ := NewCache(conf)
+
+	tc.HSet("h", map[string]string{"a": "1"})
+	if d := tc.TTL("h"); d <= 0 || d > time.Hour {
+		t.Errorf("new hash has no default expiration: %s", d)
+	}
+
+	tc.Expire("h", 30*time.Millisecond)
+	tc.HSet("h", map[string]string{"b": "2"})
+	tc.HIncrBy("h", "c", 1)
+	if d := tc.TTL("h"); d > 30*time.Millisecond {
+		t.Errorf("hash write changed expiration: %s", d)
+	}
+
+	<-time.After(40 * time.Millisecond)
+	if n, _ := tc.HLen("h"); n != 0 {
+		t.Errorf("expired hash has %d fields", n)
+	}
+	tc.HSet("h", map[string]string{"x": "1"})
+	if m, _ := tc.HGetAll("h"); len(m) != 1 {
+		t.Errorf("fields of expired hash are kept: %v", m)
+	}
+}
+
+func TestHashMemory(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 1024
+	tc, _ := NewCache(conf)
+
+	tc.HSet("h", map[string]string{"a": "1", "bb": "22"})
+	tc.HIncrBy("h", "a", 100)
+	tc.HDel("h", "bb")
+	h, _ := tc.HGetAll("h")
+	if used, want := tc.MemoryUsed(), sizeOf("h", h); used != want {
+		t.Errorf("memory of hash = %d, want %d", used, want)
+	}
+
+	big := string(make([]byte, 2048))
+	if _, err := tc.HSet("h", map[string]string{"big": big}); err == nil {
+		t.Error("field larger than the cache is set")
+	}
+	if used, want := tc.MemoryUsed(), sizeOf("h", h); used != want {
+		t.Errorf("memory is changed by rejected HSet: %d, want %d", used, want)
+	}
+
+	tc.HDel("h", "a")
+	if used := tc.MemoryUsed(); used != 0 {
+		t.Errorf("memory of deleted hash is not released: %d", used)
+	}
+}
+
+func TestHashClone(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.HSet("h", map[string]string{"a": "1"})
+
+	v, _ := tc.Get("h")
+	v.(Hash)["a"] = "changed"
+	all, _ := tc.HGetAll("h")
+	all["b"] = "2"
+
+	tc.Set("s", Hash{"a": "1"}, DefaultExpiration)
+	tc.HSet("s", map[string]string{"b": "2"})
+
+	if v, _, _ := tc.HGet("h", "a"); v != "1" {
+		t.Errorf("hash is changed through Get: %s", v)
+	}
+	if n, _ := tc.HLen("h"); n != 1 {
+		t.Errorf("hash is changed through HGetAll: %d fields", n)
+	}
+	if n, _ := tc.HLen("s"); n != 2 {
+		t.Errorf("hash set by Set is not changed by HSet: %d fields", n)
+	}
+}
+
+func TestHashConcurrent(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				tc.HIncrBy("h", "n", 1)
+				tc.Get("h")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, _, _ := tc.HGet("h", "n"); v != "800" {
+		t.Errorf("concurrent HIncrBy = %s", v)
+	}
+}
+
+func TestHashBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.HSet("h", map[string]string{"a": "1", "b": ""})
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if h, _ := tr.HGetAll("h"); !reflect.DeepEqual(h, Hash{"a": "1", "b": ""}) {
+		t.Errorf("hash is recovered as %v", h)
+	}
+	if tr.MemoryUsed() != tc.MemoryUsed() {
+		t.Errorf("memory of recovered hash = %d, want %d", tr.MemoryUsed(), tc.MemoryUsed())
+	}
+}
+
+func TestHashAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.HSet("h", map[string]string{"a": "1", "b": "2"})
+	tc.HIncrBy("h", "a", 2)
+	tc.HIncrByFloat("h", "f", 0.1)
+	tc.HIncrByFloat("h", "f", 0.2)
+	tc.HDel("h", "b")
+	tc.HSet("d", map[string]string{"a": "1"})
+	tc.HDel("d", "a")
+
+	tr := reopenAOF(t, tc, conf)
+	if h, _ := tr.HGetAll("h"); !reflect.DeepEqual(h, Hash{"a": "3", "f": "0.30000000000000004"}) {
+		t.Errorf("hash is replayed as %v", h)
+	}
+	if _, found := tr.Get("d"); found {
+		t.Error("deleted hash is replayed")
+	}
+	tr.Close(context.Background())
+}
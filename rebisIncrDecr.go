@@ -2,9 +2,20 @@ package rebis
 
 import (
 	"fmt"
+	"math"
+	"sync/atomic"
 	"time"
 )
 
+/*
+	Number is a constraint for all types that can be incremented.
+*/
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uintptr | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
 /*
 	Expired returns true if the item has expired.
 */
@@ -24,46 +35,75 @@ func (item Item) Expired() bool {
 	of the specialized methods, e.g. IncrementInt64.
 */
 func (c *cache) Increment(k string, n int64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return fmt.Errorf("item %s not found", k)
-	}
-	switch v.Value.(type) {
+	return c.increment(k, n, addInt)
+}
+
+/*
+	Replaces the number of an unexpired item with add of it and n under the
+	shard lock.
+*/
+func (c *cache) increment(k string, n int64, add func(x interface{}, n int64) (interface{}, bool)) error {
+	return c.update(k, func(x interface{}) (interface{}, error) {
+		v, ok := add(x, n)
+		if !ok {
+			return nil, fmt.Errorf("the value for %s is not an integer", k)
+		}
+
+		return v, nil
+	})
+}
+
+/*
+	Returns x incremented by n and true if x is a number.
+*/
+func addInt(x interface{}, n int64) (interface{}, bool) {
+	switch v := x.(type) {
 	case int:
-		v.Value = v.Value.(int) + int(n)
+		return v + int(n), true
 	case int8:
-		v.Value = v.Value.(int8) + int8(n)
+		return v + int8(n), true
 	case int16:
-		v.Value = v.Value.(int16) + int16(n)
+		return v + int16(n), true
 	case int32:
-		v.Value = v.Value.(int32) + int32(n)
+		return v + int32(n), true
 	case int64:
-		v.Value = v.Value.(int64) + int64(n)
+		return v + n, true
 	case uint:
-		v.Value = v.Value.(uint) + uint(n)
+		return v + uint(n), true
 	case uintptr:
-		v.Value = v.Value.(uintptr) + uintptr(n)
+		return v + uintptr(n), true
 	case uint8:
-		v.Value = v.Value.(uint8) + uint8(n)
+		return v + uint8(n), true
 	case uint16:
-		v.Value = v.Value.(uint16) + uint16(n)
+		return v + uint16(n), true
 	case uint32:
-		v.Value = v.Value.(uint32) + uint32(n)
+		return v + uint32(n), true
 	case uint64:
-		v.Value = v.Value.(uint64) + uint64(n)
+		return v + uint64(n), true
 	case float32:
-		v.Value = v.Value.(float32) + float32(n)
+		return v + float32(n), true
 	case float64:
-		v.Value = v.Value.(float64) + float64(n)
+		return v + float64(n), true
 	default:
-		c.mu.Unlock()
-		return fmt.Errorf("the value for %s is not an integer", k)
+		return x, false
 	}
-	c.items[k] = v
-	c.mu.Unlock()
-	return nil
+}
+
+/*
+	Returns x decremented by n and true if x is a number. -math.MinInt64
+	overflows, so it is added as math.MaxInt64 and 1.
+*/
+func subInt(x interface{}, n int64) (interface{}, bool) {
+	if n != math.MinInt64 {
+		return addInt(x, -n)
+	}
+
+	x, ok := addInt(x, math.MaxInt64)
+	if !ok {
+		return x, false
+	}
+
+	return addInt(x, 1)
 }
 
 /*
@@ -74,10 +114,15 @@ func (c *cache) Increment(k string, n int64) error {
  	e.g. IncrementFloat64.
 */
 func (c *cache) IncrementFloat(k string, n float64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
+	s := c.shard(k)
+	s.mu.Lock()
+	if c.isClosed() {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	v, found := s.items[k]
 	if !found || v.Expired() {
-		c.mu.Unlock()
+		s.mu.Unlock()
 		return fmt.Errorf("item %s not found", k)
 	}
 	switch v.Value.(type) {
@@ -86,11 +131,16 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 	case float64:
 		v.Value = v.Value.(float64) + float64(n)
 	default:
-		c.mu.Unlock()
+		s.mu.Unlock()
 		return fmt.Errorf("the value for %s does not have type float32 or float64", k)
 	}
-	c.items[k] = v
-	c.mu.Unlock()
+	v.version = c.nextVersion()
+	s.items[k] = v
+	atomic.AddUint64(&s.sets, 1)
+	c.logSet(k, v)
+	c.publish(EventIncr, k, v.Value)
+	s.mu.Unlock()
+	c.awaitAOF()
 	return nil
 }
 
@@ -100,22 +150,7 @@ func (c *cache) IncrementFloat(k string, n float64) error {
 	value is returned.
 */
 func (c *cache) IncrementInt(k string, n int) (int, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -124,22 +159,7 @@ func (c *cache) IncrementInt(k string, n int) (int, error) {
 	value is returned.
 */
 func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int8", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -148,22 +168,7 @@ func (c *cache) IncrementInt8(k string, n int8) (int8, error) {
 	value is returned.
 */
 func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int16", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -172,22 +177,7 @@ func (c *cache) IncrementInt16(k string, n int16) (int16, error) {
 	value is returned.
 */
 func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int32", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -196,22 +186,7 @@ func (c *cache) IncrementInt32(k string, n int32) (int32, error) {
 	value is returned.
 */
 func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int64", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -220,22 +195,7 @@ func (c *cache) IncrementInt64(k string, n int64) (int64, error) {
 	value is returned.
 */
 func (c *cache) IncrementUint(k string, n uint) (uint, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -244,22 +204,7 @@ func (c *cache) IncrementUint(k string, n uint) (uint, error) {
 	value is returned.
 */
 func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uintptr)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uintptr", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -268,22 +213,7 @@ func (c *cache) IncrementUintptr(k string, n uintptr) (uintptr, error) {
 	value is returned.
 */
 func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint8", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -292,22 +222,7 @@ func (c *cache) IncrementUint8(k string, n uint8) (uint8, error) {
 	value is returned.
 */
 func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint16", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -316,22 +231,7 @@ func (c *cache) IncrementUint16(k string, n uint16) (uint16, error) {
 	value is returned.
 */
 func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint32", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -340,22 +240,7 @@ func (c *cache) IncrementUint32(k string, n uint32) (uint32, error) {
 	value is returned.
 */
 func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint64", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -364,22 +249,7 @@ func (c *cache) IncrementUint64(k string, n uint64) (uint64, error) {
 	value is returned.
 */
 func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(float32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float32", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
 }
 
 /*
@@ -388,22 +258,18 @@ func (c *cache) IncrementFloat32(k string, n float32) (float32, error) {
 	value is returned.
 */
 func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(float64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float64", k)
-	}
-	nv := rv + n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return incrementNumber(c, k, n)
+}
+
+/*
+	IncrementFunc replaces the value of an unexpired item by f of it under the
+	shard lock, so the new value is checked before it is written. Returns an
+	error if the item was not found or the error of f, then the value is not
+	changed. The expiration of the item is kept and the change is published
+	like in Increment.
+*/
+func (c *cache) IncrementFunc(k string, f func(x interface{}) (interface{}, error)) error {
+	return c.update(k, f)
 }
 
 /*
@@ -414,46 +280,7 @@ func (c *cache) IncrementFloat64(k string, n float64) (float64, error) {
 	of the specialized methods, e.g. DecrementInt64.
 */
 func (c *cache) Decrement(k string, n int64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return fmt.Errorf("item not found")
-	}
-	switch v.Value.(type) {
-	case int:
-		v.Value = v.Value.(int) - int(n)
-	case int8:
-		v.Value = v.Value.(int8) - int8(n)
-	case int16:
-		v.Value = v.Value.(int16) - int16(n)
-	case int32:
-		v.Value = v.Value.(int32) - int32(n)
-	case int64:
-		v.Value = v.Value.(int64) - int64(n)
-	case uint:
-		v.Value = v.Value.(uint) - uint(n)
-	case uintptr:
-		v.Value = v.Value.(uintptr) - uintptr(n)
-	case uint8:
-		v.Value = v.Value.(uint8) - uint8(n)
-	case uint16:
-		v.Value = v.Value.(uint16) - uint16(n)
-	case uint32:
-		v.Value = v.Value.(uint32) - uint32(n)
-	case uint64:
-		v.Value = v.Value.(uint64) - uint64(n)
-	case float32:
-		v.Value = v.Value.(float32) - float32(n)
-	case float64:
-		v.Value = v.Value.(float64) - float64(n)
-	default:
-		c.mu.Unlock()
-		return fmt.Errorf("the value for %s is not an integer", k)
-	}
-	c.items[k] = v
-	c.mu.Unlock()
-	return nil
+	return c.increment(k, n, subInt)
 }
 
 /*
@@ -464,10 +291,15 @@ func (c *cache) Decrement(k string, n int64) error {
 	e.g. DecrementFloat64.
 */
 func (c *cache) DecrementFloat(k string, n float64) error {
-	c.mu.Lock()
-	v, found := c.items[k]
+	s := c.shard(k)
+	s.mu.Lock()
+	if c.isClosed() {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	v, found := s.items[k]
 	if !found || v.Expired() {
-		c.mu.Unlock()
+		s.mu.Unlock()
 		return fmt.Errorf("item %s not found", k)
 	}
 	switch v.Value.(type) {
@@ -476,11 +308,16 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 	case float64:
 		v.Value = v.Value.(float64) - n
 	default:
-		c.mu.Unlock()
+		s.mu.Unlock()
 		return fmt.Errorf("the value for %s does not have type float32 or float64", k)
 	}
-	c.items[k] = v
-	c.mu.Unlock()
+	v.version = c.nextVersion()
+	s.items[k] = v
+	atomic.AddUint64(&s.sets, 1)
+	c.logSet(k, v)
+	c.publish(EventIncr, k, v.Value)
+	s.mu.Unlock()
+	c.awaitAOF()
 	return nil
 }
 
@@ -490,22 +327,7 @@ func (c *cache) DecrementFloat(k string, n float64) error {
 	value is returned.
 */
 func (c *cache) DecrementInt(k string, n int) (int, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -514,22 +336,7 @@ func (c *cache) DecrementInt(k string, n int) (int, error) {
 	value is returned.
 */
 func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int8", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -538,22 +345,7 @@ func (c *cache) DecrementInt8(k string, n int8) (int8, error) {
 	value is returned.
 */
 func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int16", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -562,22 +354,7 @@ func (c *cache) DecrementInt16(k string, n int16) (int16, error) {
 	value is returned.
 */
 func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int32", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -586,22 +363,7 @@ func (c *cache) DecrementInt32(k string, n int32) (int32, error) {
 	value is returned.
 */
 func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(int64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an int64", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -610,22 +372,7 @@ func (c *cache) DecrementInt64(k string, n int64) (int64, error) {
 	value is returned.
 */
 func (c *cache) DecrementUint(k string, n uint) (uint, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -634,22 +381,7 @@ func (c *cache) DecrementUint(k string, n uint) (uint, error) {
 	value is returned.
 */
 func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uintptr)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uintptr", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -658,22 +390,7 @@ func (c *cache) DecrementUintptr(k string, n uintptr) (uintptr, error) {
 	value is returned.
 */
 func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint8)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint8", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -682,22 +399,7 @@ func (c *cache) DecrementUint8(k string, n uint8) (uint8, error) {
 	value is returned.
 */
 func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint16)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint16", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -706,22 +408,7 @@ func (c *cache) DecrementUint16(k string, n uint16) (uint16, error) {
 	value is returned.
 */
 func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint32", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -730,22 +417,7 @@ func (c *cache) DecrementUint32(k string, n uint32) (uint32, error) {
 	value is returned.
 */
 func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(uint64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an uint64", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -754,22 +426,7 @@ func (c *cache) DecrementUint64(k string, n uint64) (uint64, error) {
 	value is returned.
 */
 func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
-	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
-	}
-	rv, ok := v.Value.(float32)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float32", k)
-	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+	return decrementNumber(c, k, n)
 }
 
 /*
@@ -778,20 +435,95 @@ func (c *cache) DecrementFloat32(k string, n float32) (float32, error) {
 	value is returned.
 */
 func (c *cache) DecrementFloat64(k string, n float64) (float64, error) {
-	c.mu.Lock()
-	v, found := c.items[k]
+	return decrementNumber(c, k, n)
+}
+
+/*
+	Increment an item of type N by n under the shard lock. Returns an error if
+	the item's value is not an N, or if it was not found.
+*/
+func incrementNumber[N Number](c *cache, k string, n N) (N, error) {
+	return updateNumber(c, k, func(v N) N { return v + n })
+}
+
+/*
+	Decrement an item of type N by n under the shard lock. Returns an error if
+	the item's value is not an N, or if it was not found.
+*/
+func decrementNumber[N Number](c *cache, k string, n N) (N, error) {
+	return updateNumber(c, k, func(v N) N { return v - n })
+}
+
+func updateNumber[N Number](c *cache, k string, f func(N) N) (N, error) {
+	var nv N
+
+	err := c.update(k, func(x interface{}) (interface{}, error) {
+		rv, ok := x.(N)
+		if !ok {
+			return nil, fmt.Errorf("the value for %s is not an %T", k, rv)
+		}
+
+		nv = f(rv)
+
+		return nv, nil
+	})
+
+	return nv, err
+}
+
+/*
+	Update the value of an unexpired item under the shard lock, f returns the
+	new value or an error to keep the old one.
+*/
+func (c *cache) update(k string, f func(x interface{}) (interface{}, error)) error {
+	s := c.shard(k)
+	s.mu.Lock()
+
+	if c.isClosed() {
+		s.mu.Unlock()
+
+		return ErrClosed
+	}
+
+	err := c.modify(s, k, f)
+	s.mu.Unlock()
+
+	if err == nil {
+		c.awaitAOF()
+	}
+
+	return err
+}
+
+/*
+	Update the value of an unexpired item in the locked shard.
+*/
+func (c *cache) modify(s *shard, k string, f func(x interface{}) (interface{}, error)) error {
+	v, found := s.items[k]
 	if !found || v.Expired() {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("item %s not found", k)
+		return fmt.Errorf("item %s not found", k)
 	}
-	rv, ok := v.Value.(float64)
-	if !ok {
-		c.mu.Unlock()
-		return 0, fmt.Errorf("the value for %s is not an float64", k)
+
+	x, err := f(v.Value)
+	if err != nil {
+		return err
 	}
-	nv := rv - n
-	v.Value = nv
-	c.items[k] = v
-	c.mu.Unlock()
-	return nv, nil
+
+	size := sizeOf(k, x) + tagsSize(v.tags)
+	if !c.resize(v.size, size) {
+		atomic.AddUint64(&c.rejected, 1)
+
+		return errNoSlot
+	}
+
+	v.meta.touch()
+	v.Value = x
+	v.size = size
+	v.version = c.nextVersion()
+	s.items[k] = v
+	atomic.AddUint64(&s.sets, 1)
+	c.logSet(k, v)
+	c.publish(EventIncr, k, v.Value)
+
+	return nil
 }
@@ -1,6 +1,9 @@
 package rebis
 
 import (
+	"errors"
+	"math"
+	"strings"
 	"testing"
 	"time"
 )
@@ -1505,3 +1508,79 @@ func TestDecrementUnderflowUint(t *testing.T) {
 		t.Error("uint8 did not underflow as expected; value:", uint8)
 	}
 }
+
+func TestDecrementMinInt64(t *testing.T) {
+	tc, err := NewCache(config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	tc.Set("int64", int64(-1), DefaultExpiration)
+	err = tc.Decrement("int64", math.MinInt64)
+	if err != nil {
+		t.Error("Error decrementing int64:", err)
+	}
+	x, _ := tc.Get("int64")
+	if x.(int64) != math.MaxInt64 {
+		t.Error("int64 is not MaxInt64:", x)
+	}
+	tc.Set("float64", float64(0), DefaultExpiration)
+	err = tc.Decrement("float64", math.MinInt64)
+	if err != nil {
+		t.Error("Error decrementing float64:", err)
+	}
+	x, _ = tc.Get("float64")
+	if x.(float64) != -float64(math.MinInt64) {
+		t.Error("float64 is not -MinInt64:", x)
+	}
+}
+
+func TestDecrementNotFound(t *testing.T) {
+	tc, err := NewCache(config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	err = tc.Decrement("missing", 1)
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Error("Error of a missing item does not name its key:", err)
+	}
+}
+
+func TestIncrementFunc(t *testing.T) {
+	tc, err := NewCache(config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	tc.Set("int8", int8(120), time.Hour)
+	add := func(x interface{}) (interface{}, error) {
+		v := x.(int8)
+		if v > math.MaxInt8-10 {
+			return nil, errors.New("overflow")
+		}
+		return v + 10, nil
+	}
+	err = tc.IncrementFunc("int8", add)
+	if err == nil || err.Error() != "overflow" {
+		t.Error("Error of f is not returned:", err)
+	}
+	x, _ := tc.Get("int8")
+	if x.(int8) != 120 {
+		t.Error("int8 is changed by failed f:", x)
+	}
+	tc.Set("int8", int8(100), time.Hour)
+	_, exp, _ := tc.GetWithExpiration("int8")
+	err = tc.IncrementFunc("int8", add)
+	if err != nil {
+		t.Error("Error incrementing int8:", err)
+	}
+	x, exp2, _ := tc.GetWithExpiration("int8")
+	if x.(int8) != 110 {
+		t.Error("int8 is not 110:", x)
+	}
+	if !exp2.Equal(exp) {
+		t.Error("expiration is not kept:", exp, exp2)
+	}
+	err = tc.IncrementFunc("missing", add)
+	if err == nil {
+		t.Error("Missing item is incremented")
+	}
+}
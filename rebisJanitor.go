@@ -19,8 +19,8 @@ func runJanitor(c *cache, ci time.Duration) {
 	go j.run(c)
 }
 
-func stopJanitor(c *Cache) {
-	c.janitor.stop <- true
+func stopJanitor(c *cache) {
+	close(c.janitor.stop)
 }
 
 func (j *janitor) run(c *cache) {
@@ -0,0 +1,471 @@
+package rebis
+
+import (
+	"context"
+	"strconv"
+)
+
+const minListCap = 8
+
+/*
+	List is a value of the list data type, a double-ended queue of strings.
+	Get returns a copy of the list, it is changed only by L methods.
+*/
+type List struct {
+	buf  []string // ring buffer, len(buf) is 0 or a power of two
+	head int
+	n    int
+}
+
+/*
+	NewList returns the list of the values.
+*/
+func NewList(values ...string) *List {
+	l := &List{}
+	for _, v := range values {
+		l.pushBack(v)
+	}
+
+	return l
+}
+
+/*
+	Len returns the count of elements of the list.
+*/
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	return l.n
+}
+
+/*
+	Values returns elements of the list from head to tail.
+*/
+func (l *List) Values() []string {
+	values := make([]string, l.Len())
+	for i := range values {
+		values[i] = l.at(i)
+	}
+
+	return values
+}
+
+/*
+	Size of the list is the size of its elements.
+*/
+func (l *List) Size() uintptr {
+	var n uintptr
+	for i := 0; i < l.Len(); i++ {
+		n += uintptr(listElemSize(l.at(i)))
+	}
+
+	return n
+}
+
+func (l *List) length() int {
+	return l.Len()
+}
+
+func (l *List) clone() interface{} {
+	return NewList(l.Values()...)
+}
+
+func (l *List) at(i int) string {
+	return l.buf[(l.head+i)&(len(l.buf)-1)]
+}
+
+func (l *List) pushFront(v string) {
+	l.grow()
+	l.head = (l.head - 1) & (len(l.buf) - 1)
+	l.buf[l.head] = v
+	l.n++
+}
+
+func (l *List) pushBack(v string) {
+	l.grow()
+	l.buf[(l.head+l.n)&(len(l.buf)-1)] = v
+	l.n++
+}
+
+func (l *List) popFront() string {
+	v := l.buf[l.head]
+	l.buf[l.head] = ""
+	l.head = (l.head + 1) & (len(l.buf) - 1)
+	l.n--
+	l.shrink()
+
+	return v
+}
+
+func (l *List) popBack() string {
+	i := (l.head + l.n - 1) & (len(l.buf) - 1)
+	v := l.buf[i]
+	l.buf[i] = ""
+	l.n--
+	l.shrink()
+
+	return v
+}
+
+/*
+	Replace elements of the list by the values.
+*/
+func (l *List) reset(values []string) {
+	*l = List{}
+	for _, v := range values {
+		l.pushBack(v)
+	}
+}
+
+func (l *List) grow() {
+	if l.n < len(l.buf) {
+		return
+	}
+
+	size := 2 * len(l.buf)
+	if size == 0 {
+		size = minListCap
+	}
+
+	l.resize(size)
+}
+
+func (l *List) shrink() {
+	if len(l.buf) > minListCap && l.n < len(l.buf)/4 {
+		l.resize(len(l.buf) / 2)
+	}
+}
+
+func (l *List) resize(size int) {
+	buf := make([]string, size)
+	for i := 0; i < l.n; i++ {
+		buf[i] = l.at(i)
+	}
+
+	l.buf, l.head = buf, 0
+}
+
+/*
+	LPush inserts the values at the head of the list one by one, so the last
+	value becomes the first element. Returns the length of the list. The list
+	is created with the default expiration if the key is not found.
+*/
+func (c *cache) LPush(k string, values ...string) (int, error) {
+	return c.push(k, "LPush", values, (*List).pushFront)
+}
+
+/*
+	RPush appends the values to the tail of the list and returns the length
+	of the list.
+*/
+func (c *cache) RPush(k string, values ...string) (int, error) {
+	return c.push(k, "RPush", values, (*List).pushBack)
+}
+
+/*
+	LPop removes and returns the first element of the list and a bool
+	indicating whether the list was found. The key is deleted with its last
+	element.
+*/
+func (c *cache) LPop(k string) (string, bool, error) {
+	return c.pop(k, "LPop", (*List).popFront)
+}
+
+/*
+	RPop removes and returns the last element of the list.
+*/
+func (c *cache) RPop(k string) (string, bool, error) {
+	return c.pop(k, "RPop", (*List).popBack)
+}
+
+/*
+	BLPop pops the first element of the first non-empty list of the keys. If
+	all lists are empty, it waits for an element until ctx is done and
+	returns ctx error then. Returns the key and the element. Several waiters
+	of one key are not served in any particular order.
+*/
+func (c *cache) BLPop(ctx context.Context, keys ...string) (string, string, error) {
+	return c.blockingPop(ctx, keys, c.LPop)
+}
+
+/*
+	BRPop pops the last element like BLPop.
+*/
+func (c *cache) BRPop(ctx context.Context, keys ...string) (string, string, error) {
+	return c.blockingPop(ctx, keys, c.RPop)
+}
+
+/*
+	LLen returns the length of the list, 0 if the key is not found.
+*/
+func (c *cache) LLen(k string) (int, error) {
+	var n int
+
+	err := readValue(c, k, func(l *List) {
+		n = l.Len()
+	})
+
+	return n, err
+}
+
+/*
+	LIndex returns the element at the index and a bool indicating whether it
+	exists. Negative indexes count from the tail, -1 is the last element.
+*/
+func (c *cache) LIndex(k string, i int) (string, bool, error) {
+	var (
+		v     string
+		found bool
+	)
+
+	err := readValue(c, k, func(l *List) {
+		if i < 0 {
+			i += l.Len()
+		}
+
+		if i >= 0 && i < l.Len() {
+			v, found = l.at(i), true
+		}
+	})
+
+	return v, found, err
+}
+
+/*
+	LRange returns elements from start to stop inclusive. Negative indexes
+	count from the tail, out of range indexes are limited by the list.
+*/
+func (c *cache) LRange(k string, start, stop int) ([]string, error) {
+	values := []string{}
+
+	err := readValue(c, k, func(l *List) {
+		from, to := listRange(start, stop, l.Len())
+		for i := from; i < to; i++ {
+			values = append(values, l.at(i))
+		}
+	})
+
+	return values, err
+}
+
+/*
+	LTrim keeps only elements from start to stop inclusive, indexes are like
+	in LRange. The key is deleted if no element is kept.
+*/
+func (c *cache) LTrim(k string, start, stop int) error {
+	change := &Change{Op: "LTrim", Args: []string{strconv.Itoa(start), strconv.Itoa(stop)}}
+
+	err := changeValue(c, k, change, func(l *List, grow func(n int) bool) (*List, error) {
+		from, to := listRange(start, stop, l.Len())
+		if from == 0 && to == l.Len() {
+			return l, nil
+		}
+
+		var n int
+		for i := 0; i < l.Len(); i++ {
+			if i < from || i >= to {
+				n -= listElemSize(l.at(i))
+			}
+		}
+
+		grow(n)
+		l.reset(l.Values()[from:to])
+
+		return l, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.logIf("ltrim %s %d %d", k, start, stop)
+
+	return nil
+}
+
+/*
+	LRem removes elements equal to the value and returns the count of
+	removed elements. Positive count removes at most count elements from the
+	head, negative count from the tail, zero count removes all of them.
+*/
+func (c *cache) LRem(k string, count int, v string) (int, error) {
+	var removed int
+
+	change := &Change{Op: "LRem", Args: []string{strconv.Itoa(count), v}}
+
+	err := changeValue(c, k, change, func(l *List, grow func(n int) bool) (*List, error) {
+		values := l.Values()
+		kept := make([]string, 0, len(values))
+
+		if count < 0 {
+			for i := len(values) - 1; i >= 0; i-- {
+				if values[i] == v && removed < -count {
+					removed++
+				} else {
+					kept = append(kept, values[i])
+				}
+			}
+
+			for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+				kept[i], kept[j] = kept[j], kept[i]
+			}
+		} else {
+			for _, e := range values {
+				if e == v && (count == 0 || removed < count) {
+					removed++
+				} else {
+					kept = append(kept, e)
+				}
+			}
+		}
+
+		if removed == 0 {
+			return l, nil
+		}
+
+		grow(-removed * listElemSize(v))
+		l.reset(kept)
+
+		return l, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("lrem %s %d %s, removed %d elements", k, count, v, removed)
+
+	return removed, nil
+}
+
+/*
+	Push the values into the list one by one, op is the name of the method.
+*/
+func (c *cache) push(k, op string, values []string, f func(l *List, v string)) (int, error) {
+	var length int
+
+	err := changeValue(c, k, &Change{Op: op, Args: changeArgs(values...)}, func(l *List, grow func(n int) bool) (*List, error) {
+		length = l.Len()
+		if len(values) == 0 {
+			return l, nil
+		}
+
+		var n int
+		for _, v := range values {
+			n += listElemSize(v)
+		}
+
+		if !grow(n) {
+			return l, errNoSlot
+		}
+
+		if l == nil {
+			l = &List{}
+		}
+
+		for _, v := range values {
+			f(l, v)
+		}
+
+		length = l.Len()
+
+		return l, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("push %s %v, length %d", k, values, length)
+
+	return length, nil
+}
+
+/*
+	Pop one element of the list, op is the name of the method.
+*/
+func (c *cache) pop(k, op string, f func(l *List) string) (string, bool, error) {
+	var (
+		v     string
+		found bool
+	)
+
+	err := changeValue(c, k, &Change{Op: op}, func(l *List, grow func(n int) bool) (*List, error) {
+		if l.Len() == 0 {
+			return l, nil
+		}
+
+		v, found = f(l), true
+		grow(-listElemSize(v))
+
+		return l, nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if found {
+		c.logIf("pop %s -> %s", k, v)
+	}
+
+	return v, found, nil
+}
+
+/*
+	Pop the element of the first non-empty list of the keys, wait for writes
+	of the lists while all of them are empty.
+*/
+func (c *cache) blockingPop(ctx context.Context, keys []string, pop func(k string) (string, bool, error)) (string, string, error) {
+	var key, v string
+
+	err := c.block(ctx, keys, func() (bool, error) {
+		for _, k := range keys {
+			e, found, err := pop(k)
+			if err != nil || found {
+				key, v = k, e
+
+				return found, err
+			}
+		}
+
+		return false, nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, v, nil
+}
+
+/*
+	Returns the range [from, to) of elements from start to stop inclusive.
+*/
+func listRange(start, stop, n int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+
+	if stop < 0 {
+		stop += n
+	}
+
+	if start < 0 {
+		start = 0
+	}
+
+	if stop >= n {
+		stop = n - 1
+	}
+
+	if start > stop {
+		return 0, 0
+	}
+
+	return start, stop + 1
+}
+
+/*
+	Returns the count of bytes used by the element of the list.
+*/
+func listElemSize(v string) int {
+	return int(sizeString) + len(v)
+}
@@ -0,0 +1,260 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	if n, err := tc.RPush("l", "b", "c"); err != nil || n != 2 {
+		t.Fatalf("RPush = %d, %v", n, err)
+	}
+	if n, _ := tc.LPush("l", "a", "z"); n != 4 {
+		t.Errorf("LPush = %d", n)
+	}
+	if values, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"z", "a", "b", "c"}) {
+		t.Errorf("LRange = %v", values)
+	}
+	if values, _ := tc.LRange("l", -2, 10); !reflect.DeepEqual(values, []string{"b", "c"}) {
+		t.Errorf("LRange of negative start = %v", values)
+	}
+	if values, _ := tc.LRange("l", 3, 1); len(values) != 0 {
+		t.Errorf("LRange of empty range = %v", values)
+	}
+	if v, found, _ := tc.LIndex("l", -1); !found || v != "c" {
+		t.Errorf("LIndex -1 = %q, %t", v, found)
+	}
+	if _, found, _ := tc.LIndex("l", 4); found {
+		t.Error("LIndex out of range is found")
+	}
+
+	if v, found, _ := tc.LPop("l"); !found || v != "z" {
+		t.Errorf("LPop = %q, %t", v, found)
+	}
+	if v, found, _ := tc.RPop("l"); !found || v != "c" {
+		t.Errorf("RPop = %q, %t", v, found)
+	}
+	if n, _ := tc.LLen("l"); n != 2 {
+		t.Errorf("LLen = %d", n)
+	}
+
+	tc.LPop("l")
+	tc.LPop("l")
+	if _, found := tc.Get("l"); found {
+		t.Error("list without elements is not deleted")
+	}
+	if _, found, err := tc.LPop("l"); found || err != nil {
+		t.Errorf("LPop of missing list = %t, %v", found, err)
+	}
+}
+
+func TestListTrimRem(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.RPush("l", "a", "x", "b", "x", "c", "x")
+
+	if n, _ := tc.LRem("l", -2, "x"); n != 2 {
+		t.Errorf("LRem from tail removed %d", n)
+	}
+	if values, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"a", "x", "b", "c"}) {
+		t.Errorf("LRem from tail left %v", values)
+	}
+	tc.RPush("l", "x")
+	if n, _ := tc.LRem("l", 1, "x"); n != 1 {
+		t.Errorf("LRem from head removed %d", n)
+	}
+	if values, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"a", "b", "c", "x"}) {
+		t.Errorf("LRem from head left %v", values)
+	}
+	if n, _ := tc.LRem("l", 0, "x"); n != 1 {
+		t.Errorf("LRem of all removed %d", n)
+	}
+
+	tc.LTrim("l", 1, -1)
+	if values, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"b", "c"}) {
+		t.Errorf("LTrim left %v", values)
+	}
+	tc.LTrim("l", 5, 10)
+	if _, found := tc.Get("l"); found {
+		t.Error("list trimmed to nothing is not deleted")
+	}
+}
+
+func TestListRing(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	var want []string
+	for i := 0; i < 100; i++ {
+		v := strconv.Itoa(i)
+		if i%3 == 0 {
+			tc.LPush("l", v)
+			want = append([]string{v}, want...)
+		} else {
+			tc.RPush("l", v)
+			want = append(want, v)
+		}
+		if i%4 == 0 {
+			tc.LPop("l")
+			want = want[1:]
+		}
+	}
+	if values, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(values, want) {
+		t.Errorf("LRange = %v, want %v", values, want)
+	}
+
+	for len(want) > 1 {
+		tc.RPop("l")
+		want = want[:len(want)-1]
+	}
+	if values, _ := tc.LRange("l", 0, -1); !reflect.DeepEqual(values, want) {
+		t.Errorf("LRange after pops = %v, want %v", values, want)
+	}
+}
+
+func TestListWrongType(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.HSet("h", map[string]string{"a": "1"})
+
+	if _, err := tc.RPush("h", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("RPush of hash: %v", err)
+	}
+	if _, err := tc.LRange("h", 0, -1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("LRange of hash: %v", err)
+	}
+	if _, _, err := tc.BLPop(context.Background(), "h"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("BLPop of hash: %v", err)
+	}
+}
+
+func TestListMemory(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 1024
+	tc, _ := NewCache(conf)
+
+	tc.RPush("l", "a", "bb", "ccc")
+	tc.LPop("l")
+	tc.LRem("l", 0, "ccc")
+	v, _ := tc.Get("l")
+	if used, want := tc.MemoryUsed(), sizeOf("l", v); used != want {
+		t.Errorf("memory of list = %d, want %d", used, want)
+	}
+
+	if _, err := tc.RPush("l", string(make([]byte, 2048))); err == nil {
+		t.Error("element larger than the cache is pushed")
+	}
+	if n, _ := tc.LLen("l"); n != 1 {
+		t.Errorf("rejected RPush changed the list: %d elements", n)
+	}
+
+	tc.RPop("l")
+	if used := tc.MemoryUsed(); used != 0 {
+		t.Errorf("memory of deleted list is not released: %d", used)
+	}
+}
+
+func TestBLPop(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.RPush("b", "1")
+
+	if k, v, err := tc.BLPop(context.Background(), "a", "b"); err != nil || k != "b" || v != "1" {
+		t.Errorf("BLPop of non-empty list = %s %s %v", k, v, err)
+	}
+
+	go func() {
+		<-time.After(20 * time.Millisecond)
+		tc.RPush("a", "x", "y")
+	}()
+	if k, v, err := tc.BRPop(context.Background(), "a", "b"); err != nil || k != "a" || v != "y" {
+		t.Errorf("BRPop after push = %s %s %v", k, v, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := tc.BLPop(ctx, "c"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("BLPop of empty list is not cancelled: %v", err)
+	}
+}
+
+func TestBLPopQueue(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got = make(map[string]bool)
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				_, v, err := tc.BLPop(context.Background(), "q")
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				got[v] = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for i := 0; i < 200; i++ {
+		tc.RPush("q", strconv.Itoa(i))
+	}
+	for n := -1; n != 0; {
+		<-time.After(time.Millisecond)
+		n, _ = tc.LLen("q")
+	}
+
+	tc.Close(context.Background())
+	wg.Wait()
+	if len(got) != 200 {
+		t.Errorf("consumers got %d elements", len(got))
+	}
+}
+
+func TestListBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.RPush("l", "a", "", "c")
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if values, _ := tr.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"a", "", "c"}) {
+		t.Errorf("list is recovered as %v", values)
+	}
+	if tr.MemoryUsed() != tc.MemoryUsed() {
+		t.Errorf("memory of recovered list = %d, want %d", tr.MemoryUsed(), tc.MemoryUsed())
+	}
+}
+
+func TestListAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.RPush("l", "a", "b", "c")
+	tc.LPop("l")
+	tc.LPush("l", "z")
+	tc.RPush("l", "b", "d", "e")
+	tc.LRem("l", -1, "b")
+	tc.LTrim("l", 0, -2)
+
+	tr := reopenAOF(t, tc, conf)
+	if values, _ := tr.LRange("l", 0, -1); !reflect.DeepEqual(values, []string{"z", "b", "c", "d"}) {
+		t.Errorf("list is replayed as %v", values)
+	}
+	tr.Close(context.Background())
+}
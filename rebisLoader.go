@@ -0,0 +1,176 @@
+package rebis
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+	Loader returns the value of the key from the backend with its expiration,
+	the expiration has the same meaning as in Set.
+*/
+type Loader func(ctx context.Context) (interface{}, time.Duration, error)
+
+/*
+	loadGroup deduplicates concurrent loads of the same key and keeps loader
+	errors for negativeExpiration.
+*/
+type loadGroup struct {
+	mu                 sync.Mutex
+	calls              map[string]*loadCall
+	negative           map[string]negativeResult
+	negativeExpiration time.Duration
+}
+
+type loadCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+type negativeResult struct {
+	err        error
+	expiration int64
+}
+
+/*
+	loadContext keeps values of the context of the first caller, but not its
+	cancellation, because the result of the load is shared with other callers.
+*/
+type loadContext struct {
+	context.Context
+}
+
+func (loadContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (loadContext) Done() <-chan struct{} { return nil }
+
+func (loadContext) Err() error { return nil }
+
+/*
+	GetOrLoad returns the item from the cache, on miss the value is loaded by
+	loader and set with the returned expiration. Concurrent calls for the
+	same key wait for one load and get its result, the loader gets values of
+	ctx of the first caller but it is not cancelled with it. A caller stops
+	waiting when its ctx is done.
+
+	Loader error is returned to all waiters. If NegativeExpiration is set in
+	config the error is also returned for the key without loading until it
+	expires. If the loaded value can not be stored, it is returned with the
+	error of Set.
+*/
+func (c *cache) GetOrLoad(ctx context.Context, k string, loader Loader) (interface{}, error) {
+	if v, found := c.Get(k); found {
+		return v, nil
+	}
+
+	g := &c.loads
+	g.mu.Lock()
+
+	call, found := g.calls[k]
+	if !found {
+		if err := g.negativeErr(k); err != nil {
+			g.mu.Unlock()
+
+			return nil, err
+		}
+
+		// the key can be set by the load which was finished after the miss
+		if v, found := c.Get(k); found {
+			g.mu.Unlock()
+
+			return v, nil
+		}
+
+		call = &loadCall{done: make(chan struct{})}
+		g.calls[k] = call
+
+		go c.load(loadContext{ctx}, k, call, loader)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+/*
+	Call the loader, store the result and wake up the waiters.
+*/
+func (c *cache) load(ctx context.Context, k string, call *loadCall, loader Loader) {
+	g := &c.loads
+
+	defer func() {
+		if r := recover(); r != nil {
+			call.value, call.err = nil, fmt.Errorf("loader of %s panic: %v", k, r)
+		}
+
+		g.mu.Lock()
+		delete(g.calls, k)
+		if call.err != nil && call.value == nil && g.negativeExpiration > 0 {
+			g.negative[k] = negativeResult{call.err, time.Now().Add(g.negativeExpiration).UnixNano()}
+		}
+		g.mu.Unlock()
+
+		close(call.done)
+	}()
+
+	v, d, err := loader(ctx)
+	if err != nil {
+		call.err = err
+
+		return
+	}
+
+	call.value = v
+	if err := c.Set(k, v, d); err != nil {
+		c.logIf("loaded item %s is not stored: %s", k, err)
+		call.err = err
+	}
+}
+
+/*
+	Returns the error of the last load of the key if it is not expired,
+	called under the lock.
+*/
+func (g *loadGroup) negativeErr(k string) error {
+	n, found := g.negative[k]
+	if !found {
+		return nil
+	}
+
+	if time.Now().UnixNano() > n.expiration {
+		delete(g.negative, k)
+
+		return nil
+	}
+
+	return n.err
+}
+
+/*
+	Delete expired negative results, called by DeleteExpired.
+*/
+func (g *loadGroup) deleteExpired(now int64) {
+	g.mu.Lock()
+	for k, n := range g.negative {
+		if now > n.expiration {
+			delete(g.negative, k)
+		}
+	}
+	g.mu.Unlock()
+}
+
+/*
+	Delete all negative results, called by Flush.
+*/
+func (g *loadGroup) flush() {
+	g.mu.Lock()
+	g.negative = make(map[string]negativeResult)
+	g.mu.Unlock()
+}
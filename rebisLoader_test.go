@@ -0,0 +1,193 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		return "value", time.Hour, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := tc.GetOrLoad(context.Background(), "a", loader)
+			if err != nil {
+				t.Error("Couldn't load a:", err)
+			}
+			results[i] = v
+		}(i)
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader is called %d times", n)
+	}
+	for i, v := range results {
+		if v != "value" {
+			t.Errorf("caller %d got %v", i, v)
+		}
+	}
+
+	if a, exp, _ := tc.GetWithExpiration("a"); a != "value" || time.Until(exp) < 59*time.Minute {
+		t.Errorf("a is not set with loader expiration: %v %s", a, exp)
+	}
+
+	// the item is in the cache, loader is not called
+	if _, err := tc.GetOrLoad(context.Background(), "a", loader); err != nil || calls != 1 {
+		t.Errorf("a is loaded again: %d %v", calls, err)
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	errBackend := errors.New("backend is down")
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (interface{}, time.Duration, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+
+		return nil, 0, errBackend
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tc.GetOrLoad(context.Background(), "a", loader); !errors.Is(err, errBackend) {
+				t.Error("waiter got:", err)
+			}
+		}()
+	}
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("loader is called %d times", n)
+	}
+	if _, found := tc.Get("a"); found {
+		t.Error("a is set after loader error")
+	}
+
+	// without negative expiration the error is not kept
+	tc.GetOrLoad(context.Background(), "a", loader)
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("loader is not called again after error: %d", n)
+	}
+
+	v, err := tc.GetOrLoad(context.Background(), "b", func(ctx context.Context) (interface{}, time.Duration, error) {
+		panic("boom")
+	})
+	if v != nil || err == nil {
+		t.Errorf("loader panic is not an error: %v %v", v, err)
+	}
+}
+
+func TestGetOrLoadNegative(t *testing.T) {
+	conf := configDefault()
+	conf.NegativeExpiration = 20 * time.Millisecond
+	tc, _ := NewCache(conf)
+
+	errBackend := errors.New("not found")
+	var calls int32
+	loader := func(ctx context.Context) (interface{}, time.Duration, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, 0, errBackend
+		}
+
+		return "a", DefaultExpiration, nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := tc.GetOrLoad(context.Background(), "a", loader); !errors.Is(err, errBackend) {
+			t.Errorf("negative result is not returned: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader is called %d times with negative result", calls)
+	}
+
+	<-time.After(25 * time.Millisecond)
+	if v, err := tc.GetOrLoad(context.Background(), "a", loader); err != nil || v != "a" {
+		t.Errorf("a is not loaded after negative result expired: %v %v", v, err)
+	}
+
+	// flush forgets negative results
+	calls = 0
+	tc.GetOrLoad(context.Background(), "b", loader)
+	tc.Flush()
+	if v, err := tc.GetOrLoad(context.Background(), "b", loader); err != nil || v != "a" {
+		t.Errorf("negative result is kept after flush: %v %v", v, err)
+	}
+}
+
+func TestGetOrLoadContext(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	release := make(chan struct{})
+	loaded := make(chan error, 1)
+	loader := func(ctx context.Context) (interface{}, time.Duration, error) {
+		<-release
+		loaded <- ctx.Err()
+
+		return "a", DefaultExpiration, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tc.GetOrLoad(ctx, "a", loader); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("waiter with expired context got:", err)
+	}
+
+	// the load is not cancelled with the first caller
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Error("loader context is cancelled:", err)
+	}
+	if v, err := tc.GetOrLoad(context.Background(), "a", loader); err != nil || v != "a" {
+		t.Errorf("a is not loaded: %v %v", v, err)
+	}
+}
+
+func TestTypedGetOrLoad(t *testing.T) {
+	tc, _ := NewTypedCache[int, string](configDefault())
+
+	v, err := tc.GetOrLoad(context.Background(), 1, func(ctx context.Context) (string, time.Duration, error) {
+		return "one", DefaultExpiration, nil
+	})
+	if err != nil || v != "one" {
+		t.Errorf("1 is not loaded: %v %v", v, err)
+	}
+	if v, found := tc.Get(1); !found || v != "one" {
+		t.Errorf("1 is not in the cache: %v", v)
+	}
+
+	errBackend := errors.New("backend is down")
+	if _, err := tc.GetOrLoad(context.Background(), 2, func(ctx context.Context) (string, time.Duration, error) {
+		return "", 0, errBackend
+	}); !errors.Is(err, errBackend) {
+		t.Error("typed loader error is not returned:", err)
+	}
+}
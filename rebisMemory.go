@@ -0,0 +1,286 @@
+package rebis
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+/*
+	Sizer is implemented by values that know how many bytes they use,
+	it is used for custom types in the cache memory accounting.
+*/
+type Sizer interface {
+	Size() uintptr
+}
+
+// ErrNoMemory is matched by errors of writes which have no memory for the
+// value after eviction or which value is larger than the cache.
+var ErrNoMemory = errors.New("rebis: no memory for the value")
+
+const errNoSlot memoryError = "no empty slot, wait for janitor"
+
+/*
+	memoryError is an error of memory, it keeps its own message and is
+	ErrNoMemory for errors.Is.
+*/
+type memoryError string
+
+func (e memoryError) Error() string {
+	return string(e)
+}
+
+func (e memoryError) Is(target error) bool {
+	return target == ErrNoMemory
+}
+
+const (
+	sizeItem   uintptr = unsafe.Sizeof(Item{})
+	sizeTime   uintptr = unsafe.Sizeof(time.Time{})
+	sizeString uintptr = unsafe.Sizeof("")
+)
+
+/*
+	Returns the count of bytes used by the item with key k and value x.
+*/
+func sizeOf(k string, x interface{}) uintptr {
+	return sizeItem + uintptr(len(k)) + valueSize(x)
+}
+
+/*
+	Returns the count of bytes used by the value. Strings and byte slices are
+	counted by length, numbers by width, Sizer by its Size, other values are
+	estimated by reflection without following pointers of the nested values.
+*/
+func valueSize(x interface{}) uintptr {
+	switch v := x.(type) {
+	case nil:
+		return 0
+	case Sizer:
+		return v.Size()
+	case string:
+		return uintptr(len(v))
+	case []byte:
+		return uintptr(len(v))
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, uintptr, float64, complex64:
+		return 8
+	case complex128:
+		return 16
+	case time.Time:
+		return sizeTime
+	}
+
+	return reflectSize(reflect.ValueOf(x))
+}
+
+func reflectSize(v reflect.Value) uintptr {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v.Type().Size()
+		}
+
+		return v.Type().Size() + v.Elem().Type().Size()
+	case reflect.String:
+		return uintptr(v.Len())
+	case reflect.Slice, reflect.Array:
+		return v.Type().Size() + uintptr(v.Len())*v.Type().Elem().Size()
+	case reflect.Map:
+		t := v.Type()
+
+		return t.Size() + uintptr(v.Len())*(t.Key().Size()+t.Elem().Size())
+	default:
+		return v.Type().Size()
+	}
+}
+
+/*
+	Reserve n bytes of memory. Returns false if there is no memory for them.
+*/
+func (c *cache) reserve(n uintptr) bool {
+	for {
+		size := atomic.LoadUintptr(&c.size)
+		if size+n > c.maxSize {
+			return false
+		}
+
+		if atomic.CompareAndSwapUintptr(&c.size, size, size+n) {
+			return true
+		}
+	}
+}
+
+func (c *cache) grow(n uintptr) {
+	atomic.AddUintptr(&c.size, n)
+}
+
+func (c *cache) shrink(n uintptr) {
+	atomic.AddUintptr(&c.size, ^(n - 1))
+}
+
+/*
+	Change reserved memory of the item from old to n bytes. Returns false if
+	there is no memory for growing.
+*/
+func (c *cache) resize(old, n uintptr) bool {
+	if n > old {
+		return c.reserve(n - old)
+	}
+
+	c.shrink(old - n)
+
+	return true
+}
+
+/*
+	Store the item into the locked shard, the memory of the replaced item is
+	released and its access information is kept. Returns false if there is
+	no memory for the item.
+*/
+func (c *cache) store(s *shard, k string, item Item) bool {
+	old, found := s.items[k]
+	if !c.resize(old.size, item.size) {
+		return false
+	}
+
+	c.place(s, k, item, old, found, nil)
+
+	return true
+}
+
+/*
+	Place the item instead of the old one into the locked shard, the memory
+	must be already reserved. The new item gets the next version, recovered
+	items keep their versions. The change of the data type is logged and
+	published instead of the whole value if it is not nil.
+*/
+func (c *cache) place(s *shard, k string, item, old Item, found bool, change *Change) {
+	var base uint64
+	if change != nil && found && !old.Expired() {
+		base = old.version
+	}
+
+	if item.version == 0 {
+		item.version = c.nextVersion()
+	} else {
+		c.seeVersion(item.version)
+	}
+
+	if found {
+		item.meta = old.meta
+		item.meta.touch()
+	} else {
+		item.meta = c.newMeta()
+		s.scan.add(k)
+	}
+
+	c.tags.retag(k, old.tags, item.tags)
+	s.items[k] = item
+
+	if change != nil {
+		c.logChange(k, item, base, change)
+		c.publish(EventSet, k, *change)
+	} else {
+		c.logSet(k, item)
+		c.publish(EventSet, k, item.Value)
+	}
+
+	switch item.Value.(type) {
+	case *List, *Stream:
+		c.waits.wake(k)
+	}
+}
+
+/*
+	Store the item into the shard, items are evicted while there is no memory
+	for it. The check is called under the shard lock with the current item,
+	it can forbid the write by returning an error.
+*/
+func (c *cache) put(s *shard, k string, item Item, check func(old Item, found bool) error) error {
+	if item.size > c.maxSize {
+		atomic.AddUint64(&c.rejected, 1)
+
+		return memoryError(fmt.Sprintf("item %s is larger than the cache", k))
+	}
+
+	if err := c.checkAOF(k, item.Value); err != nil {
+		return err
+	}
+
+	for {
+		s.mu.Lock()
+
+		if c.isClosed() {
+			s.mu.Unlock()
+
+			return ErrClosed
+		}
+
+		if check != nil {
+			old, found := s.items[k]
+			if err := check(old, found); err != nil {
+				s.mu.Unlock()
+
+				return err
+			}
+		}
+
+		stored := c.store(s, k, item)
+		if stored {
+			atomic.AddUint64(&s.sets, 1)
+		}
+		s.mu.Unlock()
+
+		if stored {
+			c.awaitAOF()
+
+			return nil
+		}
+
+		if !c.evict() {
+			atomic.AddUint64(&c.rejected, 1)
+
+			return errNoSlot
+		}
+	}
+}
+
+/*
+	MemoryUsage returns the count of bytes used by the item and a bool
+	indicating whether the key was found.
+*/
+func (c *cache) MemoryUsage(k string) (uintptr, bool) {
+	s := c.shard(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, found := s.items[k]
+	if !found || item.Expired() {
+		return 0, false
+	}
+
+	return item.size, true
+}
+
+/*
+	MemoryUsed returns the count of bytes used by all items in the cache.
+*/
+func (c *cache) MemoryUsed() uintptr {
+	return atomic.LoadUintptr(&c.size)
+}
+
+/*
+	MemoryLimit returns the maximum count of bytes for items in the cache.
+*/
+func (c *cache) MemoryLimit() uintptr {
+	return c.maxSize
+}
@@ -0,0 +1,168 @@
+package rebis
+
+import (
+	"testing"
+	"time"
+)
+
+type sizedStruct struct {
+	Data []int64
+}
+
+func (s sizedStruct) Size() uintptr {
+	return uintptr(len(s.Data)) * 8
+}
+
+func TestValueSize(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		size  uintptr
+	}{
+		{nil, 0},
+		{"abc", 3},
+		{make([]byte, 1024), 1024},
+		{int8(1), 1},
+		{int16(1), 2},
+		{float32(1), 4},
+		{1, 8},
+		{uint64(1), 8},
+		{true, 1},
+		{time.Now(), sizeTime},
+		{sizedStruct{Data: make([]int64, 10)}, 80},
+		{[]int32{1, 2, 3}, 24 + 12},
+	}
+	for _, c := range cases {
+		if size := valueSize(c.value); size != c.size {
+			t.Errorf("size of %T is not %d: %d", c.value, c.size, size)
+		}
+	}
+	if size := sizeOf("key", "value"); size != sizeItem+8 {
+		t.Errorf("size of item is not %d: %d", sizeItem+8, size)
+	}
+}
+
+func TestMaxMemory(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 4096
+	tc, err := NewCache(conf)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	if limit := tc.MemoryLimit(); limit != 4096 {
+		t.Errorf("memory limit is not 4096: %d", limit)
+	}
+
+	if err := tc.Set("big", make([]byte, 4096), DefaultExpiration); err == nil {
+		t.Error("Set item larger than the cache")
+	}
+	if err := tc.Set("a", make([]byte, 2048), DefaultExpiration); err != nil {
+		t.Error("Couldn't set a:", err)
+	}
+	if err := tc.Add("b", make([]byte, 2048), DefaultExpiration); err == nil {
+		t.Error("Add b when there is no memory")
+	}
+	if err := tc.Add("b", make([]byte, 1024), DefaultExpiration); err != nil {
+		t.Error("Couldn't add b:", err)
+	}
+	if err := tc.Replace("a", make([]byte, 3000), DefaultExpiration); err == nil {
+		t.Error("Replace a with value larger than free memory")
+	}
+	if err := tc.Replace("a", make([]byte, 2880), DefaultExpiration); err != nil {
+		t.Error("Couldn't replace a:", err)
+	}
+
+	size, found := tc.MemoryUsage("a")
+	if !found || size != sizeOf("a", make([]byte, 2880)) {
+		t.Errorf("memory usage of a is wrong: %d", size)
+	}
+	if used := tc.MemoryUsed(); used != size+sizeOf("b", make([]byte, 1024)) {
+		t.Errorf("memory used is wrong: %d", used)
+	}
+	if _, found := tc.MemoryUsage("c"); found {
+		t.Error("memory usage of c found")
+	}
+
+	tc.Delete("b")
+	tc.Delete("a")
+	if used := tc.MemoryUsed(); used != 0 {
+		t.Errorf("memory used after delete is not 0: %d", used)
+	}
+}
+
+func TestMaxMemoryEviction(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 4096
+	conf.EvictionPolicy = EvictAllKeysLRU
+	tc, err := NewCache(conf)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	for i := 0; i < 10; i++ {
+		if err := tc.Set(key(i), make([]byte, 1024), DefaultExpiration); err != nil {
+			t.Error("Couldn't set with eviction:", err)
+		}
+	}
+	if used := tc.MemoryUsed(); used > 4096 {
+		t.Errorf("memory used is more than limit: %d", used)
+	}
+	if n := tc.ItemCount(); n != 3 {
+		t.Errorf("Item count is not 3: %d", n)
+	}
+}
+
+func TestMaxMemoryEvictionCollection(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 4096
+	conf.EvictionPolicy = EvictAllKeysLRU
+	tc, _ := NewCache(conf)
+	for i := 0; i < 3; i++ {
+		tc.Set(key(i), make([]byte, 1024), DefaultExpiration)
+	}
+
+	if _, err := tc.SAdd("s", string(make([]byte, 1024))); err != nil {
+		t.Error("Couldn't add member with eviction:", err)
+	}
+	if _, err := tc.RPush("l", string(make([]byte, 1024))); err != nil {
+		t.Error("Couldn't push element with eviction:", err)
+	}
+	if used := tc.MemoryUsed(); used > 4096 {
+		t.Errorf("memory used is more than limit: %d", used)
+	}
+	if n, _ := tc.SCard("s"); n != 1 {
+		t.Errorf("set has %d members", n)
+	}
+
+	if _, err := tc.SAdd("s", string(make([]byte, 4096))); err == nil {
+		t.Error("member larger than the cache is added")
+	}
+	if n, _ := tc.LLen("l"); n != 1 {
+		t.Error("items are evicted for member larger than the cache")
+	}
+}
+
+func TestMaxMemoryFrom(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 100
+	_, err := NewCacheFrom(conf, map[string]Item{
+		"a": {Value: make([]byte, 100)},
+	})
+	if err == nil {
+		t.Error("created cache with items larger than the cache")
+	}
+}
+
+func TestMemoryIncrement(t *testing.T) {
+	tc, err := NewCache(config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	tc.Set("a", int8(1), DefaultExpiration)
+	tc.IncrementInt8("a", 1)
+	if used := tc.MemoryUsed(); used != sizeOf("a", int8(2)) {
+		t.Errorf("memory used is wrong: %d", used)
+	}
+	tc.Flush()
+	if used := tc.MemoryUsed(); used != 0 {
+		t.Errorf("memory used after flush is not 0: %d", used)
+	}
+}
@@ -0,0 +1,263 @@
+package rebis
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	GetMulti returns values of unexpired items of the keys, missing keys are
+	not in the map. Shards of the keys are locked once for all of them.
+	Sliding items are moved forward after the shards are unlocked.
+*/
+func (c *cache) GetMulti(keys []string) map[string]interface{} {
+	var (
+		values  = make(map[string]interface{}, len(keys))
+		sliding []string
+		shards  = c.shardsOf(keys)
+		now     = time.Now().UnixNano()
+	)
+
+	if c.isClosed() {
+		return values
+	}
+
+	for _, s := range shards {
+		s.mu.RLock()
+	}
+
+	for _, k := range keys {
+		s := c.shard(k)
+		item, found := s.items[k]
+
+		switch {
+		case !found || item.Expiration > 0 && now > item.Expiration:
+			atomic.AddUint64(&s.misses, 1)
+		case item.slide > 0:
+			sliding = append(sliding, k)
+		default:
+			atomic.AddUint64(&s.hits, 1)
+			item.meta.touch()
+			values[k] = detach(item.Value)
+		}
+	}
+
+	for _, s := range shards {
+		s.mu.RUnlock()
+	}
+
+	for _, k := range sliding {
+		if item, found := c.slide(c.shard(k), k); found {
+			values[k] = item.Value
+		}
+	}
+
+	c.logIf("get multi %v -> %d items", keys, len(values))
+
+	return values
+}
+
+/*
+	SetMulti adds items to the cache, replacing any existing items. Either
+	all items are written or none of them if there is no memory for all of
+	them. The duration is used like in Set.
+*/
+func (c *cache) SetMulti(items map[string]interface{}, d time.Duration) error {
+	if err := c.putMulti(c.newItems(items, d), false); err != nil {
+		return err
+	}
+
+	c.logIf("set multi %d items <- %s", len(items), d)
+
+	return nil
+}
+
+/*
+	SetMultiNX adds items to the cache only if none of the keys exists or
+	all existing items have expired. Returns an error otherwise, then none
+	of the items is written.
+*/
+func (c *cache) SetMultiNX(items map[string]interface{}, d time.Duration) error {
+	if err := c.putMulti(c.newItems(items, d), true); err != nil {
+		return err
+	}
+
+	c.logIf("set multi nx %d items <- %s", len(items), d)
+
+	return nil
+}
+
+/*
+	DeleteMulti deletes items of the keys and returns the count of deleted
+	unexpired items. Deleted items are passed to the OnEvicted function.
+*/
+func (c *cache) DeleteMulti(keys []string) int {
+	var (
+		evictedItems []keyAndValue
+		n            int
+		shards       = c.shardsOf(keys)
+		now          = time.Now().UnixNano()
+	)
+
+	lockShards(shards)
+
+	if c.isClosed() {
+		unlockShards(shards)
+
+		return 0
+	}
+
+	for _, k := range keys {
+		s := c.shard(k)
+
+		item, found := s.items[k]
+		if !found {
+			continue
+		}
+
+		atomic.AddUint64(&s.deletes, 1)
+
+		if item.Expiration <= 0 || now <= item.Expiration {
+			n++
+		}
+
+		if ov, evicted := c.delete(s, k); evicted {
+			evictedItems = append(evictedItems, keyAndValue{k, ov})
+		}
+	}
+
+	unlockShards(shards)
+	c.awaitAOF()
+
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+
+	c.logIf("delete multi %v, deleted %d items", keys, n)
+
+	return n
+}
+
+func (c *cache) newItems(items map[string]interface{}, d time.Duration) map[string]Item {
+	newItems := make(map[string]Item, len(items))
+	for k, x := range items {
+		newItems[k] = c.newItem(k, x, d)
+	}
+
+	return newItems
+}
+
+/*
+	Store all items or none of them. Shards of the keys are locked together,
+	memory for the items is reserved at once and items are evicted while
+	there is no memory for all of them. With nx no item is written if one of
+	the keys exists.
+*/
+func (c *cache) putMulti(items map[string]Item, nx bool) error {
+	var size uintptr
+
+	keys := make([]string, 0, len(items))
+	for k, item := range items {
+		if err := c.checkAOF(k, item.Value); err != nil {
+			return err
+		}
+
+		keys = append(keys, k)
+		size += item.size
+	}
+
+	if size > c.maxSize {
+		atomic.AddUint64(&c.rejected, 1)
+
+		return memoryError("items are larger than the cache")
+	}
+
+	shards := c.shardsOf(keys)
+
+	for {
+		lockShards(shards)
+
+		if c.isClosed() {
+			unlockShards(shards)
+
+			return ErrClosed
+		}
+
+		var free uintptr
+
+		for k := range items {
+			old, found := c.shard(k).items[k]
+			if nx && found && !old.Expired() {
+				unlockShards(shards)
+
+				return fmt.Errorf("item %s already exists", k)
+			}
+
+			free += old.size
+		}
+
+		stored := c.resize(free, size)
+		if stored {
+			for k, item := range items {
+				s := c.shard(k)
+				old, found := s.items[k]
+				c.place(s, k, item, old, found, nil)
+				atomic.AddUint64(&s.sets, 1)
+			}
+		}
+
+		unlockShards(shards)
+
+		if stored {
+			c.awaitAOF()
+
+			return nil
+		}
+
+		if !c.evict() {
+			atomic.AddUint64(&c.rejected, 1)
+
+			return errNoSlot
+		}
+	}
+}
+
+/*
+	Returns shards of the keys without duplicates in the order of the cache
+	shards. Several shards are always locked in this order, like in lockAll.
+*/
+func (c *cache) shardsOf(keys []string) []*shard {
+	indexes := make([]int, 0, len(keys))
+	seen := make(map[int]struct{}, len(keys))
+
+	for _, k := range keys {
+		i := int(hashKey(k) & c.shardMask)
+		if _, found := seen[i]; !found {
+			seen[i] = struct{}{}
+			indexes = append(indexes, i)
+		}
+	}
+
+	sort.Ints(indexes)
+
+	shards := make([]*shard, len(indexes))
+	for j, i := range indexes {
+		shards[j] = c.shards[i]
+	}
+
+	return shards
+}
+
+func lockShards(shards []*shard) {
+	for _, s := range shards {
+		s.mu.Lock()
+	}
+}
+
+func unlockShards(shards []*shard) {
+	for _, s := range shards {
+		s.mu.Unlock()
+	}
+}
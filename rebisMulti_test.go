@@ -0,0 +1,132 @@
+package rebis
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMulti(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	if err := tc.SetMulti(map[string]interface{}{"a": 1, "b": "b", "c": 1.5}, DefaultExpiration); err != nil {
+		t.Fatal("Couldn't set multi:", err)
+	}
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	values := tc.GetMulti([]string{"a", "b", "c", "d", "expired"})
+	if want := map[string]interface{}{"a": 1, "b": "b", "c": 1.5}; !reflect.DeepEqual(values, want) {
+		t.Errorf("get multi is wrong: %v", values)
+	}
+	if st := tc.Stats(); st.Hits != 3 || st.Misses != 2 || st.Sets != 4 {
+		t.Errorf("multi operations are counted wrong: %+v", st)
+	}
+
+	if err := tc.SetMultiNX(map[string]interface{}{"a": 2, "e": 2}, DefaultExpiration); err == nil {
+		t.Error("set multi nx with existing key")
+	}
+	if _, found := tc.Get("e"); found {
+		t.Error("set multi nx wrote e when a exists")
+	}
+	if err := tc.SetMultiNX(map[string]interface{}{"e": 2, "expired": 2}, DefaultExpiration); err != nil {
+		t.Error("Couldn't set multi nx over expired key:", err)
+	}
+
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	if n := tc.DeleteMulti([]string{"a", "b", "missing"}); n != 2 {
+		t.Errorf("delete multi deleted %d items", n)
+	}
+	sort.Strings(evicted)
+	if !reflect.DeepEqual(evicted, []string{"a", "b"}) {
+		t.Errorf("OnEvicted of delete multi is called for %v", evicted)
+	}
+	if n := tc.ItemCount(); n != 3 {
+		t.Errorf("item count after delete multi is %d", n)
+	}
+}
+
+func TestMultiMaxMemory(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 4096
+	tc, _ := NewCache(conf)
+	tc.Set("a", make([]byte, 1024), DefaultExpiration)
+	tc.Set("x", make([]byte, 2048), DefaultExpiration)
+
+	items := map[string]interface{}{"a": make([]byte, 512), "b": make([]byte, 1024), "c": make([]byte, 1024)}
+	if err := tc.SetMulti(items, DefaultExpiration); err == nil {
+		t.Error("set multi when there is no memory for all items")
+	}
+	if size, _ := tc.MemoryUsage("a"); tc.ItemCount() != 2 || size != sizeOf("a", make([]byte, 1024)) {
+		t.Errorf("set multi without memory wrote items: %d", tc.ItemCount())
+	}
+	if st := tc.Stats(); st.Rejected != 1 {
+		t.Errorf("rejected set multi is counted %d times", st.Rejected)
+	}
+
+	delete(items, "c")
+	if err := tc.SetMulti(items, DefaultExpiration); err != nil {
+		t.Error("Couldn't set multi:", err)
+	}
+	want := sizeOf("a", make([]byte, 512)) + sizeOf("b", make([]byte, 1024)) + sizeOf("x", make([]byte, 2048))
+	if used := tc.MemoryUsed(); used != want {
+		t.Errorf("memory used after set multi is %d, not %d", used, want)
+	}
+
+	conf.EvictionPolicy = EvictAllKeysLRU
+	te, _ := NewCache(conf)
+	for i := 0; i < 3; i++ {
+		te.Set(key(i), make([]byte, 1024), DefaultExpiration)
+	}
+	if err := te.SetMulti(map[string]interface{}{"x": make([]byte, 1024), "y": make([]byte, 1024)}, DefaultExpiration); err != nil {
+		t.Error("Couldn't set multi with eviction:", err)
+	}
+	if used := te.MemoryUsed(); used > 4096 || te.ItemCount() != 3 {
+		t.Errorf("set multi with eviction is wrong: %d bytes, %d items", used, te.ItemCount())
+	}
+}
+
+func TestMultiConcurrent(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			keys := make([]string, 50)
+			items := make(map[string]interface{}, len(keys))
+			for i := range keys {
+				keys[i] = strconv.Itoa((i*7 + g) % 100)
+				items[keys[i]] = g
+			}
+			for i := 0; i < 100; i++ {
+				tc.SetMulti(items, DefaultExpiration)
+				tc.GetMulti(keys)
+				tc.DeleteMulti(keys[:10])
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestTypedMulti(t *testing.T) {
+	tc, _ := NewTypedCache[int, string](configDefault())
+	if err := tc.SetMulti(map[int]string{1: "one", 2: "two"}, DefaultExpiration); err != nil {
+		t.Fatal("Couldn't set typed multi:", err)
+	}
+	if values := tc.GetMulti([]int{1, 2, 3}); !reflect.DeepEqual(values, map[int]string{1: "one", 2: "two"}) {
+		t.Errorf("typed get multi is wrong: %v", values)
+	}
+	if err := tc.SetMultiNX(map[int]string{2: "two", 3: "three"}, DefaultExpiration); err == nil {
+		t.Error("typed set multi nx with existing key")
+	}
+	if n := tc.DeleteMulti([]int{1, 2, 3}); n != 2 || tc.ItemCount() != 0 {
+		t.Errorf("typed delete multi is wrong: %d, %d", n, tc.ItemCount())
+	}
+}
@@ -0,0 +1,260 @@
+package rebis
+
+import (
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// DefaultScanCount is count of keys examined by Scan if count <= 0.
+const DefaultScanCount = 10
+
+/*
+	scanKey is a key with its position in the order of Scan.
+*/
+type scanKey struct {
+	key   string
+	order uint64
+}
+
+/*
+	Position of the key in the order of Scan: keys are ordered by shard and
+	then by the mixed hash, so the order does not depend on the map and on
+	other keys.
+*/
+func (c *cache) scanOrder(k string) uint64 {
+	h := hashKey(k)
+
+	return (h&c.shardMask)<<(64-c.shardBits()) | mixHash(h)>>c.shardBits()
+}
+
+/*
+	Mix bits of the hash like the finalizer of MurmurHash3, high bits of FNV
+	hash of similar keys are too close to select buckets of scanIndex.
+*/
+func mixHash(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	return h
+}
+
+func (c *cache) shardBits() int {
+	return bits.OnesCount64(c.shardMask)
+}
+
+/*
+	Scan iterates keys incrementally like Redis SCAN. Start with cursor 0 and
+	pass the returned cursor to the next call, the iteration is finished when
+	the returned cursor is 0. About count keys are examined by one call, keys
+	which are not expired and match the glob-style pattern are returned, an
+	empty pattern matches all keys. Only one shard is locked at a time and
+	keys of the shard are indexed by scanIndex, so the call reads about
+	count keys, not the whole shard.
+
+	A key which is in the cache during the whole iteration is returned once,
+	a key which is added or deleted during it can be returned or not.
+*/
+func (c *cache) Scan(cursor uint64, pattern string, count int) ([]string, uint64) {
+	if count <= 0 {
+		count = DefaultScanCount
+	}
+
+	var (
+		keys     []string
+		examined int
+		last     uint64
+	)
+
+	now := time.Now().UnixNano()
+	shift := 64 - c.shardBits() // the shard is in the high bits of the order
+
+	for i := int(cursor >> shift); i < len(c.shards); i++ {
+		s := c.shards[i]
+
+		s.mu.RLock()
+		x := &s.scan
+		// the order after the shard bits is the mixed hash
+		for b := x.bucket(cursor << c.shardBits()); b < len(x.buckets); b++ {
+			for _, cand := range c.scanBucket(x.buckets[b], cursor) {
+				// keys with the same order as the last one are returned with it
+				if examined >= count && cand.order != last {
+					s.mu.RUnlock()
+
+					return keys, cand.order
+				}
+
+				examined++
+				last = cand.order
+
+				v := s.items[cand.key]
+				if (v.Expiration <= 0 || v.Expiration > now) && (pattern == "" || match(pattern, cand.key)) {
+					keys = append(keys, cand.key)
+				}
+			}
+		}
+		s.mu.RUnlock()
+
+		if examined >= count && i+1 < len(c.shards) {
+			return keys, uint64(i+1) << shift
+		}
+
+		cursor = uint64(i+1) << shift
+	}
+
+	return keys, 0
+}
+
+/*
+	Returns keys of the bucket from the cursor in the order of Scan.
+*/
+func (c *cache) scanBucket(keys []string, cursor uint64) []scanKey {
+	next := make([]scanKey, 0, len(keys))
+	for _, k := range keys {
+		if o := c.scanOrder(k); o >= cursor {
+			next = append(next, scanKey{k, o})
+		}
+	}
+
+	sort.Slice(next, func(i, j int) bool {
+		return next[i].order < next[j].order
+	})
+
+	return next
+}
+
+/*
+	scanIndex keeps keys of the shard in buckets by the high bits of their
+	mixed hash, which are the bits of the order of Scan after the shard. When the
+	index grows, every bucket splits into two neighbouring ones, so the
+	cursor of Scan still points into its bucket and one call reads only the
+	buckets of keys it returns, not the whole shard.
+*/
+type scanIndex struct {
+	buckets [][]string
+	bits    int // count of high bits of the mixed hash which select the bucket
+	length  int
+}
+
+// scanBucketLoad is the average count of keys in a bucket when the index grows.
+const scanBucketLoad = 4
+
+/*
+	Returns the bucket of the mixed hash.
+*/
+func (x *scanIndex) bucket(h uint64) int {
+	return int(h >> (64 - x.bits))
+}
+
+/*
+	Add the key which is not in the index.
+*/
+func (x *scanIndex) add(k string) {
+	if x.length >= scanBucketLoad*len(x.buckets) {
+		x.grow()
+	}
+
+	b := x.bucket(mixHash(hashKey(k)))
+	x.buckets[b] = append(x.buckets[b], k)
+	x.length++
+}
+
+/*
+	Remove the key from the index, the order of keys in the bucket is not
+	kept.
+*/
+func (x *scanIndex) remove(k string) {
+	if x.length == 0 {
+		return
+	}
+
+	b := x.bucket(mixHash(hashKey(k)))
+	keys := x.buckets[b]
+
+	for i := range keys {
+		if keys[i] == k {
+			keys[i] = keys[len(keys)-1]
+			keys[len(keys)-1] = ""
+			x.buckets[b] = keys[:len(keys)-1]
+			x.length--
+
+			return
+		}
+	}
+}
+
+/*
+	Double the count of buckets, keys of the bucket are split by the next
+	bit of the mixed hash.
+*/
+func (x *scanIndex) grow() {
+	old := x.buckets
+	if old != nil {
+		x.bits++
+	}
+
+	x.buckets = make([][]string, 1<<x.bits)
+	for _, keys := range old {
+		for _, k := range keys {
+			b := x.bucket(mixHash(hashKey(k)))
+			x.buckets[b] = append(x.buckets[b], k)
+		}
+	}
+}
+
+/*
+	Keys returns all keys which are not expired and match the glob-style
+	pattern, an empty pattern matches all keys. Shards are locked one by one.
+*/
+func (c *cache) Keys(pattern string) []string {
+	keys := make([]string, 0)
+	now := time.Now().UnixNano()
+
+	for _, s := range c.shards {
+		s.mu.RLock()
+		for k, v := range s.items {
+			if (v.Expiration <= 0 || v.Expiration > now) && (pattern == "" || match(pattern, k)) {
+				keys = append(keys, k)
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	return keys
+}
+
+/*
+	Range calls f for every item which is not expired, until f returns false.
+	Items of one shard are copied under its lock and f is called without
+	locks, so f can use the cache. Items changed during Range can be passed
+	to f with the old value or not passed.
+*/
+func (c *cache) Range(f func(k string, item Item) bool) {
+	for _, s := range c.shards {
+		now := time.Now().UnixNano()
+
+		s.mu.RLock()
+		items := make([]keyAndItem, 0, len(s.items))
+		for k, v := range s.items {
+			if v.Expiration <= 0 || v.Expiration > now {
+				v.Value = detach(v.Value)
+				items = append(items, keyAndItem{k, v})
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, v := range items {
+			if !f(v.key, v.item) {
+				return
+			}
+		}
+	}
+}
+
+type keyAndItem struct {
+	key  string
+	item Item
+}
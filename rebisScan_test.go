@@ -0,0 +1,281 @@
+package rebis
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func scanAll(tc *Cache, pattern string, count int) ([]string, int) {
+	var (
+		keys  []string
+		calls int
+	)
+
+	for cursor := uint64(0); ; {
+		var next []string
+		next, cursor = tc.Scan(cursor, pattern, count)
+		keys = append(keys, next...)
+		calls++
+
+		if cursor == 0 {
+			return keys, calls
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	for _, shards := range []int{1, 4, 32} {
+		conf := configDefault()
+		conf.Shards = shards
+		tc, _ := NewCache(conf)
+
+		for i := 0; i < 1000; i++ {
+			tc.Set("user:"+strconv.Itoa(i), i, DefaultExpiration)
+		}
+		tc.Set("post:1", 1, DefaultExpiration)
+		tc.Set("expired", 1, time.Millisecond)
+		<-time.After(2 * time.Millisecond)
+
+		keys, calls := scanAll(tc, "", 10)
+		if len(keys) != 1001 {
+			t.Errorf("%d shards: scan returned %d keys", shards, len(keys))
+		}
+		if calls < 100 {
+			t.Errorf("%d shards: scan is not incremental, %d calls", shards, calls)
+		}
+		seen := make(map[string]bool)
+		for _, k := range keys {
+			if seen[k] {
+				t.Errorf("%d shards: %s is returned twice", shards, k)
+			}
+			seen[k] = true
+		}
+
+		keys, _ = scanAll(tc, "user:1?", 7)
+		sort.Strings(keys)
+		if len(keys) != 10 || keys[0] != "user:10" || keys[9] != "user:19" {
+			t.Errorf("%d shards: scan with pattern is wrong: %v", shards, keys)
+		}
+
+		if _, calls := scanAll(tc, "", 0); calls < 100 {
+			t.Errorf("%d shards: scan without count is not by %d keys, %d calls", shards, DefaultScanCount, calls)
+		}
+	}
+}
+
+func TestScanChanges(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	for i := 0; i < 500; i++ {
+		tc.Set("stable"+strconv.Itoa(i), i, DefaultExpiration)
+		tc.Set("deleted"+strconv.Itoa(i), i, DefaultExpiration)
+	}
+
+	seen := make(map[string]int)
+	added := 0
+
+	for cursor := uint64(0); ; {
+		var keys []string
+		keys, cursor = tc.Scan(cursor, "", 20)
+		for _, k := range keys {
+			seen[k]++
+		}
+
+		// changes between the calls do not affect keys which stay in the cache
+		tc.Delete("deleted" + strconv.Itoa(added))
+		tc.Set("added"+strconv.Itoa(added), 1, DefaultExpiration)
+		added++
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	for i := 0; i < 500; i++ {
+		if n := seen["stable"+strconv.Itoa(i)]; n != 1 {
+			t.Errorf("stable%d is returned %d times", i, n)
+		}
+	}
+}
+
+func TestScanIndex(t *testing.T) {
+	var x scanIndex
+	for i := 0; i < 100; i++ {
+		x.add("k" + strconv.Itoa(i))
+	}
+	for i := 0; i < 100; i += 2 {
+		x.remove("k" + strconv.Itoa(i))
+	}
+	x.remove("missing")
+
+	if x.length != 50 || len(x.buckets)*scanBucketLoad < x.length {
+		t.Errorf("index has %d keys in %d buckets", x.length, len(x.buckets))
+	}
+	n := 0
+	for b, keys := range x.buckets {
+		for _, k := range keys {
+			if x.bucket(mixHash(hashKey(k))) != b {
+				t.Errorf("%s is in bucket %d", k, b)
+			}
+			n++
+		}
+	}
+	if n != 50 {
+		t.Errorf("index has %d keys in buckets", n)
+	}
+
+	// the index follows keys of the cache
+	tc, _ := NewCacheFrom(configDefault(), map[string]Item{"from": {Value: 1}})
+	for i := 0; i < 100; i++ {
+		tc.Set(key(i), i, DefaultExpiration)
+		tc.Set(key(i), i, DefaultExpiration)
+	}
+	tc.Delete(key(0))
+	n = 0
+	for _, s := range tc.shards {
+		n += s.scan.length
+	}
+	if n != 100 {
+		t.Errorf("index of cache has %d keys", n)
+	}
+	tc.Flush()
+	for _, s := range tc.shards {
+		if s.scan.length != 0 {
+			t.Errorf("index of flushed shard has %d keys", s.scan.length)
+		}
+	}
+}
+
+func TestScanCursor(t *testing.T) {
+	conf := configDefault()
+	conf.Shards = 1
+	tc, _ := NewCache(conf)
+	for i := 0; i < 2000; i++ {
+		tc.Set(key(i), i, DefaultExpiration)
+	}
+
+	keys, cursor := tc.Scan(0, "", 10)
+	if cursor == 0 || len(keys) != 10 {
+		t.Errorf("scan of 10 keys returned %d keys, cursor %d", len(keys), cursor)
+	}
+
+	// the cursor stays valid while the index grows
+	for i := 2000; i < 4000; i++ {
+		tc.Set(key(i), i, DefaultExpiration)
+	}
+	for cursor != 0 {
+		var next []string
+		next, cursor = tc.Scan(cursor, "", 10)
+		keys = append(keys, next...)
+	}
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		seen[k] = true
+	}
+	for i := 0; i < 2000; i++ {
+		if !seen[key(i)] {
+			t.Errorf("%s is not returned", key(i))
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	for _, k := range []string{"user:1", "user:2", "user:10", "post:1"} {
+		tc.Set(k, "v", DefaultExpiration)
+	}
+	tc.Set("user:3", "v", time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	keys := tc.Keys("user:?")
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "user:1" || keys[1] != "user:2" {
+		t.Errorf("keys user:? are wrong: %v", keys)
+	}
+	if keys := tc.Keys(""); len(keys) != 4 {
+		t.Errorf("all keys are wrong: %v", keys)
+	}
+	tc.Flush()
+	if keys := tc.Keys("*"); keys == nil || len(keys) != 0 {
+		t.Errorf("keys of empty cache are wrong: %v", keys)
+	}
+}
+
+func TestRange(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	for i := 0; i < 100; i++ {
+		tc.Set(key(i), i, DefaultExpiration)
+	}
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+
+	sum := 0
+	tc.Range(func(k string, item Item) bool {
+		sum += item.Value.(int)
+		// the cache can be used from f
+		tc.Delete(k)
+
+		return true
+	})
+	if sum != 4950 {
+		t.Errorf("sum of values is not 4950: %d", sum)
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("items are not deleted in range: %d", n)
+	}
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 1, DefaultExpiration)
+	calls := 0
+	tc.Range(func(k string, item Item) bool {
+		calls++
+
+		return false
+	})
+	if calls != 1 {
+		t.Errorf("range is not stopped: %d calls", calls)
+	}
+
+	typed, _ := NewTypedCache[int, int](configDefault())
+	for i := 0; i < 10; i++ {
+		typed.Set(i, i*i, DefaultExpiration)
+	}
+	squares := 0
+	typed.Range(func(k, v int) bool {
+		if v != k*k {
+			t.Errorf("typed value of %d is wrong: %d", k, v)
+		}
+		squares += v
+
+		return true
+	})
+	if squares != 285 {
+		t.Errorf("sum of typed values is not 285: %d", squares)
+	}
+}
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "post:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hallo", false},
+		{"*:*:end", "a:b:end", true},
+	}
+	for _, c := range cases {
+		if match(c.pattern, c.s) != c.match {
+			t.Errorf("match(%q, %q) is not %v", c.pattern, c.s, c.match)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package rebis
+
+import (
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	Set is a value of the set data type, unordered unique strings. Get
+	returns a copy of the set, it is changed only by S methods.
+*/
+type Set map[string]struct{}
+
+/*
+	Size of the set is the size of its members.
+*/
+func (set Set) Size() uintptr {
+	var n uintptr
+	for m := range set {
+		n += uintptr(setMemberSize(m))
+	}
+
+	return n
+}
+
+func (set Set) length() int {
+	return len(set)
+}
+
+func (set Set) clone() interface{} {
+	c := make(Set, len(set))
+	for m := range set {
+		c[m] = struct{}{}
+	}
+
+	return c
+}
+
+func (set Set) members() []string {
+	members := make([]string, 0, len(set))
+	for m := range set {
+		members = append(members, m)
+	}
+
+	return members
+}
+
+/*
+	SAdd adds the members to the set and returns the count of added members.
+	The set is created with the default expiration if the key is not found.
+*/
+func (c *cache) SAdd(k string, members ...string) (int, error) {
+	var added int
+
+	err := changeValue(c, k, &Change{Op: "SAdd", Args: changeArgs(members...)}, func(set Set, grow func(n int) bool) (Set, error) {
+		var n int
+		for _, m := range uniqueStrings(members) {
+			if _, found := set[m]; !found {
+				n += setMemberSize(m)
+			}
+		}
+
+		if n == 0 {
+			return set, nil
+		}
+
+		if !grow(n) {
+			return set, errNoSlot
+		}
+
+		if set == nil {
+			set = make(Set, len(members))
+		}
+
+		for _, m := range members {
+			if _, found := set[m]; !found {
+				set[m] = struct{}{}
+				added++
+			}
+		}
+
+		return set, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("sadd %s %v, added %d members", k, members, added)
+
+	return added, nil
+}
+
+/*
+	SRem removes the members from the set and returns the count of removed
+	members. The key is deleted with its last member.
+*/
+func (c *cache) SRem(k string, members ...string) (int, error) {
+	var removed int
+
+	err := changeValue(c, k, &Change{Op: "SRem", Args: changeArgs(members...)}, func(set Set, grow func(n int) bool) (Set, error) {
+		var n int
+		for _, m := range uniqueStrings(members) {
+			if _, found := set[m]; found {
+				n -= setMemberSize(m)
+			}
+		}
+
+		if n == 0 {
+			return set, nil
+		}
+
+		grow(n)
+
+		for _, m := range members {
+			if _, found := set[m]; found {
+				delete(set, m)
+				removed++
+			}
+		}
+
+		return set, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("srem %s %v, removed %d members", k, members, removed)
+
+	return removed, nil
+}
+
+/*
+	SIsMember returns true if the set has the member.
+*/
+func (c *cache) SIsMember(k, member string) (bool, error) {
+	var found bool
+
+	err := readValue(c, k, func(set Set) {
+		_, found = set[member]
+	})
+
+	return found, err
+}
+
+/*
+	SMembers returns members of the set in random order.
+*/
+func (c *cache) SMembers(k string) ([]string, error) {
+	members := []string{}
+
+	err := readValue(c, k, func(set Set) {
+		members = set.members()
+	})
+
+	return members, err
+}
+
+/*
+	SCard returns the count of members of the set.
+*/
+func (c *cache) SCard(k string) (int, error) {
+	var n int
+
+	err := readValue(c, k, func(set Set) {
+		n = len(set)
+	})
+
+	return n, err
+}
+
+/*
+	SPop removes and returns a random member of the set and a bool
+	indicating whether the set was found.
+*/
+func (c *cache) SPop(k string) (string, bool, error) {
+	var (
+		member string
+		found  bool
+		change = &Change{Op: "SPop"}
+	)
+
+	err := changeValue(c, k, change, func(set Set, grow func(n int) bool) (Set, error) {
+		if len(set) == 0 {
+			return set, nil
+		}
+
+		// iteration of the map starts at a random member
+		for m := range set {
+			member, found = m, true
+
+			break
+		}
+
+		change.Args = []string{member}
+		grow(-setMemberSize(member))
+		delete(set, member)
+
+		return set, nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	if found {
+		c.logIf("spop %s -> %s", k, member)
+	}
+
+	return member, found, nil
+}
+
+/*
+	SRandMember returns random members of the set without removing them. With
+	positive count members are distinct and there are at most count of them,
+	with negative count members can repeat and there are exactly -count of
+	them if the set is found.
+*/
+func (c *cache) SRandMember(k string, count int) ([]string, error) {
+	members := []string{}
+
+	err := readValue(c, k, func(set Set) {
+		if count < 0 {
+			if len(set) == 0 {
+				return
+			}
+
+			all := set.members()
+			for i := 0; i < -count; i++ {
+				members = append(members, all[rand.Intn(len(all))]) // nolint
+			}
+
+			return
+		}
+
+		members = randomMembers(set, count)
+	})
+
+	return members, err
+}
+
+/*
+	SInter returns the intersection of the sets, missing keys are empty sets.
+*/
+func (c *cache) SInter(keys ...string) ([]string, error) {
+	return c.combineSets(keys, setInter)
+}
+
+/*
+	SUnion returns the union of the sets.
+*/
+func (c *cache) SUnion(keys ...string) ([]string, error) {
+	return c.combineSets(keys, setUnion)
+}
+
+/*
+	SDiff returns members of the first set which are not in other sets.
+*/
+func (c *cache) SDiff(keys ...string) ([]string, error) {
+	return c.combineSets(keys, setDiff)
+}
+
+/*
+	SInterStore writes the intersection of the sets to dst like SInter and
+	returns the count of its members. An existing dst is replaced whatever
+	type it holds, it is deleted if the result is empty. dst gets the
+	default expiration.
+*/
+func (c *cache) SInterStore(dst string, keys ...string) (int, error) {
+	return c.storeSets(dst, keys, setInter)
+}
+
+/*
+	SUnionStore writes the union of the sets to dst like SInterStore.
+*/
+func (c *cache) SUnionStore(dst string, keys ...string) (int, error) {
+	return c.storeSets(dst, keys, setUnion)
+}
+
+/*
+	SDiffStore writes the difference of the sets to dst like SInterStore.
+*/
+func (c *cache) SDiffStore(dst string, keys ...string) (int, error) {
+	return c.storeSets(dst, keys, setDiff)
+}
+
+/*
+	Combine the sets of the keys under one read lock of their shards.
+*/
+func (c *cache) combineSets(keys []string, op func(sets []Set) Set) ([]string, error) {
+	shards := c.shardsOf(keys)
+
+	for _, s := range shards {
+		s.mu.RLock()
+	}
+
+	sets, err := c.setsOf(keys)
+	members := []string{}
+
+	if err == nil {
+		members = op(sets).members()
+	}
+
+	for _, s := range shards {
+		s.mu.RUnlock()
+	}
+
+	return members, err
+}
+
+/*
+	Write the combination of the sets of the keys to dst. Shards of all keys
+	are locked together, items are evicted while there is no memory for the
+	result like in putMulti.
+*/
+func (c *cache) storeSets(dst string, keys []string, op func(sets []Set) Set) (int, error) {
+	shards := c.shardsOf(append([]string{dst}, keys...))
+
+	for {
+		lockShards(shards)
+
+		if c.isClosed() {
+			unlockShards(shards)
+
+			return 0, ErrClosed
+		}
+
+		sets, err := c.setsOf(keys)
+		if err != nil {
+			unlockShards(shards)
+
+			return 0, err
+		}
+
+		var (
+			result     = op(sets)
+			s          = c.shard(dst)
+			old, found = s.items[dst]
+		)
+
+		if len(result) == 0 {
+			var (
+				ov      interface{}
+				evicted bool
+			)
+
+			if found {
+				atomic.AddUint64(&s.deletes, 1)
+				ov, evicted = c.delete(s, dst)
+			}
+
+			unlockShards(shards)
+			c.awaitAOF()
+
+			if evicted {
+				c.onEvicted(dst, ov)
+			}
+
+			return 0, nil
+		}
+
+		item := c.newItem(dst, result, DefaultExpiration)
+		if item.size > c.maxSize {
+			unlockShards(shards)
+			atomic.AddUint64(&c.rejected, 1)
+
+			return 0, memoryError(fmt.Sprintf("item %s is larger than the cache", dst))
+		}
+
+		stored := c.resize(old.size, item.size)
+		if stored {
+			c.place(s, dst, item, old, found, nil)
+			atomic.AddUint64(&s.sets, 1)
+		}
+
+		unlockShards(shards)
+
+		if stored {
+			c.awaitAOF()
+			c.logIf("store sets %v to %s, %d members", keys, dst, len(result))
+
+			return len(result), nil
+		}
+
+		if !c.evict() {
+			atomic.AddUint64(&c.rejected, 1)
+
+			return 0, errNoSlot
+		}
+	}
+}
+
+/*
+	Returns sets of the keys, nil for missing keys, shards of the keys must
+	be locked. Returns ErrWrongType if one of the keys holds a value of
+	another type.
+*/
+func (c *cache) setsOf(keys []string) ([]Set, error) {
+	sets := make([]Set, len(keys))
+	now := time.Now().UnixNano()
+
+	for i, k := range keys {
+		s := c.shard(k)
+
+		item, found := s.items[k]
+		if !found || item.Expiration > 0 && now > item.Expiration {
+			atomic.AddUint64(&s.misses, 1)
+
+			continue
+		}
+
+		set, ok := item.Value.(Set)
+		if !ok {
+			return nil, fmt.Errorf("item %s: %w", k, ErrWrongType)
+		}
+
+		atomic.AddUint64(&s.hits, 1)
+		item.meta.touch()
+		sets[i] = set
+	}
+
+	return sets, nil
+}
+
+func setInter(sets []Set) Set {
+	result := Set{}
+	if len(sets) == 0 {
+		return result
+	}
+
+	smallest := sets[0]
+	for _, set := range sets[1:] {
+		if len(set) < len(smallest) {
+			smallest = set
+		}
+	}
+
+	for m := range smallest {
+		in := true
+		for _, set := range sets {
+			if _, found := set[m]; !found {
+				in = false
+
+				break
+			}
+		}
+
+		if in {
+			result[m] = struct{}{}
+		}
+	}
+
+	return result
+}
+
+func setUnion(sets []Set) Set {
+	result := Set{}
+	for _, set := range sets {
+		for m := range set {
+			result[m] = struct{}{}
+		}
+	}
+
+	return result
+}
+
+func setDiff(sets []Set) Set {
+	result := Set{}
+	if len(sets) == 0 {
+		return result
+	}
+
+	for m := range sets[0] {
+		in := false
+		for _, set := range sets[1:] {
+			if _, found := set[m]; found {
+				in = true
+
+				break
+			}
+		}
+
+		if !in {
+			result[m] = struct{}{}
+		}
+	}
+
+	return result
+}
+
+/*
+	Returns at most n distinct random members of the set.
+*/
+func randomMembers(set Set, n int) []string {
+	all := set.members()
+	if n >= len(all) {
+		return all
+	}
+
+	rand.Shuffle(len(all), func(i, j int) { // nolint
+		all[i], all[j] = all[j], all[i]
+	})
+
+	return all[:n]
+}
+
+/*
+	Returns the count of bytes used by the member of the set.
+*/
+func setMemberSize(m string) int {
+	return int(sizeString) + len(m)
+}
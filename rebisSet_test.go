@@ -0,0 +1,240 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func sortedMembers(members []string, err error) []string {
+	sort.Strings(members)
+
+	return members
+}
+
+func TestSet(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	if n, err := tc.SAdd("s", "a", "b", "a"); err != nil || n != 2 {
+		t.Fatalf("SAdd = %d, %v", n, err)
+	}
+	if n, _ := tc.SAdd("s", "b", "c"); n != 1 {
+		t.Errorf("SAdd of existing member = %d", n)
+	}
+	if found, _ := tc.SIsMember("s", "c"); !found {
+		t.Error("SIsMember c = false")
+	}
+	if n, _ := tc.SCard("s"); n != 3 {
+		t.Errorf("SCard = %d", n)
+	}
+	if members := sortedMembers(tc.SMembers("s")); !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Errorf("SMembers = %v", members)
+	}
+	if n, _ := tc.SRem("s", "a", "x"); n != 1 {
+		t.Errorf("SRem = %d", n)
+	}
+
+	m, found, _ := tc.SPop("s")
+	if ok, _ := tc.SIsMember("s", m); !found || ok {
+		t.Errorf("SPop = %q, %t, still member %t", m, found, ok)
+	}
+	tc.SPop("s")
+	if _, found := tc.Get("s"); found {
+		t.Error("set without members is not deleted")
+	}
+	if _, found, err := tc.SPop("s"); found || err != nil {
+		t.Errorf("SPop of missing set = %t, %v", found, err)
+	}
+}
+
+func TestSetPopAll(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	for i := 0; i < 100; i++ {
+		tc.SAdd("s", key(i))
+	}
+
+	popped := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		m, found, err := tc.SPop("s")
+		if !found || err != nil || popped[m] {
+			t.Fatalf("SPop %d = %q, %t, %v", i, m, found, err)
+		}
+		popped[m] = true
+	}
+	if _, found := tc.Get("s"); found {
+		t.Error("set without members is not deleted")
+	}
+
+	tc.Set("e", Set{}, DefaultExpiration)
+	if _, found, err := tc.SPop("e"); found || err != nil {
+		t.Errorf("SPop of empty set = %t, %v", found, err)
+	}
+}
+
+func TestSetRandMember(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SAdd("s", "a", "b", "c")
+
+	if members := sortedMembers(tc.SRandMember("s", 5)); !reflect.DeepEqual(members, []string{"a", "b", "c"}) {
+		t.Errorf("SRandMember 5 = %v", members)
+	}
+	members, _ := tc.SRandMember("s", 2)
+	if len(members) != 2 || members[0] == members[1] {
+		t.Errorf("SRandMember 2 = %v", members)
+	}
+	if members, _ := tc.SRandMember("s", -7); len(members) != 7 {
+		t.Errorf("SRandMember -7 = %v", members)
+	}
+	if n, _ := tc.SCard("s"); n != 3 {
+		t.Errorf("SRandMember changed the set: %d members", n)
+	}
+
+	tc.Set("e", Set{}, DefaultExpiration)
+	if members, err := tc.SRandMember("e", -3); len(members) != 0 || err != nil {
+		t.Errorf("SRandMember -3 of empty set = %v, %v", members, err)
+	}
+	if members, err := tc.SRandMember("e", 3); len(members) != 0 || err != nil {
+		t.Errorf("SRandMember 3 of empty set = %v, %v", members, err)
+	}
+}
+
+func TestSetCombine(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SAdd("a", "1", "2", "3", "4")
+	tc.SAdd("b", "2", "3", "5")
+	tc.SAdd("c", "3", "4", "6")
+
+	if members := sortedMembers(tc.SInter("a", "b", "c")); !reflect.DeepEqual(members, []string{"3"}) {
+		t.Errorf("SInter = %v", members)
+	}
+	if members, _ := tc.SInter("a", "missing"); len(members) != 0 {
+		t.Errorf("SInter with missing set = %v", members)
+	}
+	if members := sortedMembers(tc.SUnion("b", "c", "missing")); !reflect.DeepEqual(members, []string{"2", "3", "4", "5", "6"}) {
+		t.Errorf("SUnion = %v", members)
+	}
+	if members := sortedMembers(tc.SDiff("a", "b", "c")); !reflect.DeepEqual(members, []string{"1"}) {
+		t.Errorf("SDiff = %v", members)
+	}
+
+	tc.Set("d", "string", DefaultExpiration)
+	if n, err := tc.SUnionStore("d", "a", "b"); err != nil || n != 5 {
+		t.Errorf("SUnionStore = %d, %v", n, err)
+	}
+	if members := sortedMembers(tc.SMembers("d")); !reflect.DeepEqual(members, []string{"1", "2", "3", "4", "5"}) {
+		t.Errorf("stored union = %v", members)
+	}
+	if n, _ := tc.SInterStore("a", "a", "b"); n != 2 {
+		t.Errorf("SInterStore into source = %d", n)
+	}
+	if members := sortedMembers(tc.SMembers("a")); !reflect.DeepEqual(members, []string{"2", "3"}) {
+		t.Errorf("stored intersection = %v", members)
+	}
+	if n, _ := tc.SDiffStore("d", "a", "d"); n != 0 {
+		t.Errorf("SDiffStore of empty result = %d", n)
+	}
+	if _, found := tc.Get("d"); found {
+		t.Error("empty result is stored")
+	}
+
+	v, _ := tc.Get("a")
+	if used, want := tc.MemoryUsed(), sizeOf("a", v)+sizeOf("b", Set{"2": {}, "3": {}, "5": {}})+sizeOf("c", Set{"3": {}, "4": {}, "6": {}}); used != want {
+		t.Errorf("memory of sets = %d, want %d", used, want)
+	}
+}
+
+func TestSetWrongType(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SAdd("s", "a")
+	tc.RPush("l", "a")
+
+	if _, err := tc.SAdd("l", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SAdd of list: %v", err)
+	}
+	if _, err := tc.SInter("s", "l"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SInter with list: %v", err)
+	}
+	if _, err := tc.SUnionStore("d", "s", "l"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("SUnionStore with list: %v", err)
+	}
+	if _, found := tc.Get("d"); found {
+		t.Error("failed SUnionStore wrote the result")
+	}
+}
+
+func TestSetExpirationEvents(t *testing.T) {
+	conf := configDefault()
+	conf.DefaultExpiration = time.Hour
+	tc, _ := NewCache(conf)
+	sub := tc.Subscribe("s*", EventAll, 0)
+
+	tc.SAdd("s", "a")
+	tc.Expire("s", 20*time.Millisecond)
+	tc.SAdd("s", "b")
+	tc.SRem("s", "a", "b")
+
+	for _, want := range []EventType{EventSet, EventExpire, EventSet, EventDelete} {
+		if e := <-sub.C; e.Type != want {
+			t.Errorf("event %s, want %s", e.Type, want)
+		}
+	}
+
+	tc.SAdd("s", "a")
+	if d := tc.TTL("s"); d <= 20*time.Millisecond {
+		t.Errorf("new set has no default expiration: %s", d)
+	}
+	tc.Expire("s", 20*time.Millisecond)
+	<-time.After(30 * time.Millisecond)
+	if found, _ := tc.SIsMember("s", "a"); found {
+		t.Error("member of expired set is found")
+	}
+	sub.Close()
+}
+
+func TestSetBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SAdd("s", "a", "b", "")
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if members := sortedMembers(tr.SMembers("s")); !reflect.DeepEqual(members, []string{"", "a", "b"}) {
+		t.Errorf("set is recovered as %v", members)
+	}
+	if tr.MemoryUsed() != tc.MemoryUsed() {
+		t.Errorf("memory of recovered set = %d, want %d", tr.MemoryUsed(), tc.MemoryUsed())
+	}
+}
+
+func TestSetAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.SAdd("a", "1", "2", "3")
+	tc.SRem("a", "2")
+	tc.SAdd("b", "3", "4")
+	tc.SUnionStore("c", "a", "b")
+	tc.SAdd("p", "1", "2")
+	popped, _, _ := tc.SPop("p")
+
+	tr := reopenAOF(t, tc, conf)
+	if members, _ := tr.SMembers("p"); len(members) != 1 || members[0] == popped {
+		t.Errorf("set is replayed as %v after pop of %s", members, popped)
+	}
+	if members := sortedMembers(tr.SMembers("c")); !reflect.DeepEqual(members, []string{"1", "3", "4"}) {
+		t.Errorf("stored set is replayed as %v", members)
+	}
+	if members := sortedMembers(tr.SMembers("a")); !reflect.DeepEqual(members, []string{"1", "3"}) {
+		t.Errorf("set is replayed as %v", members)
+	}
+	tr.Close(context.Background())
+}
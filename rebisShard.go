@@ -0,0 +1,83 @@
+package rebis
+
+import (
+	"sync"
+)
+
+const (
+	DefaultShards = 32
+
+	// FNV-1a 64 bit constants, see https://en.wikipedia.org/wiki/Fowler–Noll–Vo_hash_function
+	offset64 uint64 = 14695981039346656037
+	prime64  uint64 = 1099511628211
+)
+
+/*
+	shard is an independently locked part of the cache items.
+*/
+type shard struct {
+	hits    uint64 // atomic
+	misses  uint64 // atomic
+	sets    uint64 // atomic
+	deletes uint64 // atomic
+	mu      sync.RWMutex
+	items   map[string]Item
+	scan    scanIndex // keys of items in the order of Scan
+}
+
+/*
+	Create n shards, n is rounded up to the power of two so the shard
+	can be selected by the hash mask.
+*/
+func newShards(n int) []*shard {
+	if n <= 0 {
+		n = DefaultShards
+	}
+
+	count := 1
+	for count < n {
+		count <<= 1
+	}
+
+	shards := make([]*shard, count)
+	for i := range shards {
+		shards[i] = &shard{items: make(map[string]Item)}
+	}
+
+	return shards
+}
+
+/*
+	Hash of the key, FNV-1a without allocations.
+*/
+func hashKey(k string) uint64 {
+	h := offset64
+	for i := 0; i < len(k); i++ {
+		h ^= uint64(k[i])
+		h *= prime64
+	}
+
+	return h
+}
+
+/*
+	Returns the shard that owns the key.
+*/
+func (c *cache) shard(k string) *shard {
+	return c.shards[hashKey(k)&c.shardMask]
+}
+
+/*
+	Lock all shards, used for operations over the whole cache.
+*/
+func (c *cache) lockAll() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+	}
+}
+
+func (c *cache) unlockAll() {
+	for _, s := range c.shards {
+		s.mu.Unlock()
+	}
+}
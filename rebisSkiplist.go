@@ -0,0 +1,233 @@
+package rebis
+
+import "math/rand"
+
+const (
+	skiplistMaxLevel = 32
+	skiplistP        = 0.25
+)
+
+/*
+	skiplist keeps members of the sorted set ordered by score and member,
+	like zskiplist of Redis. Spans of levels count nodes between neighbours,
+	so ranks are found in logarithmic time.
+*/
+type skiplist struct {
+	head   *skipnode
+	tail   *skipnode
+	level  int
+	length int
+}
+
+type skipnode struct {
+	member string
+	score  float64
+	back   *skipnode // nil for the first node
+	levels []skiplevel
+}
+
+type skiplevel struct {
+	next *skipnode
+	span int
+}
+
+func newSkiplist() *skiplist {
+	return &skiplist{
+		head:  &skipnode{levels: make([]skiplevel, skiplistMaxLevel)},
+		level: 1,
+	}
+}
+
+/*
+	Returns true if the node goes before the score and the member.
+*/
+func (n *skipnode) before(score float64, member string) bool {
+	return n.score < score || n.score == score && n.member < member
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skiplistMaxLevel && rand.Float64() < skiplistP { // nolint
+		level++
+	}
+
+	return level
+}
+
+/*
+	Insert the member, it must not be in the list.
+*/
+func (sl *skiplist) insert(score float64, member string) {
+	var (
+		update [skiplistMaxLevel]*skipnode
+		rank   [skiplistMaxLevel]int
+	)
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+
+		for x.levels[i].next != nil && x.levels[i].next.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].next
+		}
+
+		update[i] = x
+	}
+
+	level := randomLevel()
+	if level > sl.level {
+		for i := sl.level; i < level; i++ {
+			update[i] = sl.head
+			update[i].levels[i].span = sl.length
+		}
+
+		sl.level = level
+	}
+
+	n := &skipnode{member: member, score: score, levels: make([]skiplevel, level)}
+	for i := 0; i < level; i++ {
+		n.levels[i].next = update[i].levels[i].next
+		update[i].levels[i].next = n
+		n.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+
+	for i := level; i < sl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != sl.head {
+		n.back = update[0]
+	}
+
+	if n.levels[0].next != nil {
+		n.levels[0].next.back = n
+	} else {
+		sl.tail = n
+	}
+
+	sl.length++
+}
+
+/*
+	Delete the member with the score, returns false if it is not found.
+*/
+func (sl *skiplist) delete(score float64, member string) bool {
+	var update [skiplistMaxLevel]*skipnode
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && x.levels[i].next.before(score, member) {
+			x = x.levels[i].next
+		}
+
+		update[i] = x
+	}
+
+	x = x.levels[0].next
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+
+	for i := 0; i < sl.level; i++ {
+		if update[i].levels[i].next == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].next = x.levels[i].next
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+
+	if x.levels[0].next != nil {
+		x.levels[0].next.back = x.back
+	} else {
+		sl.tail = x.back
+	}
+
+	for sl.level > 1 && sl.head.levels[sl.level-1].next == nil {
+		sl.level--
+	}
+
+	sl.length--
+
+	return true
+}
+
+/*
+	Returns the 0-based rank of the member with the score.
+*/
+func (sl *skiplist) rank(score float64, member string) int {
+	var rank int
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && x.levels[i].next.before(score, member) {
+			rank += x.levels[i].span
+			x = x.levels[i].next
+		}
+	}
+
+	return rank
+}
+
+/*
+	Returns the node of the 0-based rank, nil if it is out of range.
+*/
+func (sl *skiplist) byRank(rank int) *skipnode {
+	if rank < 0 || rank >= sl.length {
+		return nil
+	}
+
+	var traversed int
+
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && traversed+x.levels[i].span <= rank+1 {
+			traversed += x.levels[i].span
+			x = x.levels[i].next
+		}
+
+		if traversed == rank+1 {
+			return x
+		}
+	}
+
+	return nil
+}
+
+/*
+	Returns the first node for which above is true, above must be false for
+	a prefix of the list and true for the rest of it.
+*/
+func (sl *skiplist) first(above func(n *skipnode) bool) *skipnode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && !above(x.levels[i].next) {
+			x = x.levels[i].next
+		}
+	}
+
+	return x.levels[0].next
+}
+
+/*
+	Returns the last node for which below is true, below must be true for a
+	prefix of the list and false for the rest of it.
+*/
+func (sl *skiplist) last(below func(n *skipnode) bool) *skipnode {
+	x := sl.head
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && below(x.levels[i].next) {
+			x = x.levels[i].next
+		}
+	}
+
+	if x == sl.head {
+		return nil
+	}
+
+	return x
+}
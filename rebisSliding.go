@@ -0,0 +1,86 @@
+package rebis
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	SetSliding adds an item with sliding expiration to the cache, replacing
+	any existing item. Every Get and GetWithExpiration of the item moves its
+	expiration to d from now, but not further than maxLifetime from now if
+	it is positive. If the duration is 0 (DefaultExpiration), the cache's
+	default expiration time is used, it must be positive.
+*/
+func (c *cache) SetSliding(k string, x interface{}, d, maxLifetime time.Duration) error {
+	item := c.newItem(k, x, d)
+	if item.Expiration <= 0 {
+		return fmt.Errorf("sliding expiration of %s requires positive duration", k)
+	}
+
+	c.setSliding(&item, d, maxLifetime)
+
+	if err := c.put(c.shard(k), k, item, nil); err != nil {
+		return err
+	}
+
+	c.logIf("set sliding %s -> %v <- %s, max %s", k, x, d, maxLifetime)
+
+	return nil
+}
+
+/*
+	Make the new item sliding, its expiration is already set by d.
+*/
+func (c *cache) setSliding(item *Item, d, maxLifetime time.Duration) {
+	if d == DefaultExpiration {
+		d = c.defaultExpiration
+	}
+
+	item.slide = int64(d)
+	item.deadline = 0
+
+	if maxLifetime > 0 {
+		item.deadline = time.Now().Add(maxLifetime).UnixNano()
+		if item.Expiration > item.deadline {
+			item.Expiration = item.deadline
+		}
+	}
+}
+
+/*
+	Read the sliding item under the write lock and move its expiration
+	forward. The new expiration is written to the append-only file.
+*/
+func (c *cache) slide(s *shard, k string) (Item, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, found := s.items[k]
+	now := time.Now().UnixNano()
+
+	if !found || item.Expiration > 0 && now > item.Expiration {
+		atomic.AddUint64(&s.misses, 1)
+
+		return Item{}, false
+	}
+
+	if e := now + item.slide; item.slide > 0 && !c.isClosed() {
+		if item.deadline > 0 && e > item.deadline {
+			e = item.deadline
+		}
+
+		if e > item.Expiration {
+			item.Expiration = e
+			s.items[k] = item
+			c.logExpire(k, e)
+		}
+	}
+
+	atomic.AddUint64(&s.hits, 1)
+	item.meta.touch()
+	item.Value = detach(item.Value)
+
+	return item, true
+}
@@ -0,0 +1,151 @@
+package rebis
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSliding(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	if err := tc.SetSliding("a", 1, 50*time.Millisecond, 0); err != nil {
+		t.Fatal("Couldn't set sliding a:", err)
+	}
+	tc.Set("b", 1, 50*time.Millisecond)
+
+	for i := 0; i < 4; i++ {
+		<-time.After(20 * time.Millisecond)
+		if _, found := tc.Get("a"); !found {
+			t.Fatalf("sliding a is expired after %d reads", i)
+		}
+	}
+	if _, found := tc.Get("b"); found {
+		t.Error("expiration of not sliding b is moved by reads")
+	}
+
+	_, exp, _ := tc.GetWithExpiration("a")
+	if d := time.Until(exp); d <= 40*time.Millisecond || d > 50*time.Millisecond {
+		t.Errorf("expiration of a is not moved by GetWithExpiration: %s", d)
+	}
+
+	if err := tc.Persist("a"); err != nil {
+		t.Fatal("Couldn't persist a:", err)
+	}
+	tc.Get("a")
+	if d := tc.TTL("a"); d != NoExpiration {
+		t.Errorf("persisted a slides: %s", d)
+	}
+
+	if err := tc.SetSliding("c", 1, NoExpiration, 0); err == nil {
+		t.Error("sliding without expiration is set")
+	}
+	if st := tc.Stats(); st.Hits != 6 || st.Misses != 1 {
+		t.Errorf("reads of sliding items are counted wrong: %d hits, %d misses", st.Hits, st.Misses)
+	}
+}
+
+func TestSlidingMaxLifetime(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SetSliding("a", 1, time.Hour, 30*time.Millisecond)
+	if d := tc.TTL("a"); d > 30*time.Millisecond {
+		t.Errorf("expiration of a is after max lifetime: %s", d)
+	}
+
+	<-time.After(15 * time.Millisecond)
+	if _, found := tc.Get("a"); !found {
+		t.Fatal("a is expired before max lifetime")
+	}
+	<-time.After(20 * time.Millisecond)
+	if _, found := tc.Get("a"); found {
+		t.Error("a is not expired after max lifetime")
+	}
+}
+
+func TestSlidingConfig(t *testing.T) {
+	conf := configDefault()
+	conf.DefaultExpiration = 50 * time.Millisecond
+	conf.SlidingExpiration = true
+	conf.MaxLifetime = time.Hour
+	tc, _ := NewCache(conf)
+
+	tc.SetDefault("a", 1)
+	tc.Set("b", 1, NoExpiration)
+	items := tc.Items()
+	if a := items["a"]; a.slide != int64(50*time.Millisecond) || a.deadline == 0 {
+		t.Errorf("default item is not sliding: %d %d", a.slide, a.deadline)
+	}
+	if b := items["b"]; b.slide != 0 {
+		t.Errorf("item without expiration is sliding: %d", b.slide)
+	}
+
+	<-time.After(30 * time.Millisecond)
+	tc.Get("a")
+	<-time.After(30 * time.Millisecond)
+	if _, found := tc.Get("a"); !found {
+		t.Error("item of sliding config is expired")
+	}
+}
+
+func TestSlidingBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SetSliding("a", 1, time.Minute, time.Hour)
+	tc.SetWithTags("b", 1, time.Minute, "x")
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if a, want := tr.Items()["a"], tc.Items()["a"]; a.slide != want.slide || a.deadline != want.deadline {
+		t.Errorf("sliding is not recovered: %d %d", a.slide, a.deadline)
+	}
+	if b := tr.Items()["b"]; b.slide != 0 || len(b.tags) != 1 {
+		t.Errorf("b is recovered wrong: %d %v", b.slide, b.tags)
+	}
+}
+
+func TestSlidingAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.SetSliding("a", 1, 50*time.Millisecond, time.Hour)
+	tc.SetSliding("b", 1, time.Minute, 0)
+	tc.Persist("b")
+	<-time.After(30 * time.Millisecond)
+	tc.Get("a")
+	_, exp, _ := tc.GetWithExpiration("a")
+
+	tr := reopenAOF(t, tc, conf)
+	a := tr.Items()["a"]
+	if a.slide != int64(50*time.Millisecond) || a.Expiration != exp.UnixNano() {
+		t.Errorf("sliding of a is not replayed: %d %s", a.slide, time.Unix(0, a.Expiration))
+	}
+	if b := tr.Items()["b"]; b.slide != 0 || b.Expiration != 0 {
+		t.Errorf("persist of b is not replayed: %d %d", b.slide, b.Expiration)
+	}
+
+	if err := tr.RewriteAOF(); err != nil {
+		t.Fatal("Couldn't rewrite append only file:", err)
+	}
+	tr = reopenAOF(t, tr, conf)
+	if a := tr.Items()["a"]; a.slide != int64(50*time.Millisecond) || a.deadline == 0 {
+		t.Errorf("sliding of a is lost after rewrite: %d %d", a.slide, a.deadline)
+	}
+	tr.Close(context.Background())
+}
+
+func TestTypedSliding(t *testing.T) {
+	tc, _ := NewTypedCache[string, int](configDefault())
+	tc.SetSliding("a", 1, 50*time.Millisecond, 0)
+
+	for i := 0; i < 3; i++ {
+		<-time.After(20 * time.Millisecond)
+		if _, found := tc.Get("a"); !found {
+			t.Fatalf("typed sliding a is expired after %d reads", i)
+		}
+	}
+}
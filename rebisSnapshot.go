@@ -0,0 +1,1059 @@
+package rebis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+/*
+	Snapshot file layout:
+
+		magic "REBIS" | version byte
+		entry*        | opEntry, key, expiration, tag, value
+		              | or opEntryFields, key, expiration, fields, tag, value
+		opEOF         | crc32 (Castagnoli) of all previous bytes, little endian
+
+	Lengths and integers are varints, floats are IEEE 754 bits in little
+	endian. Lists and maps of interface{} are written element by element
+	with their own tags. Values of data types are count and their elements
+	as strings. Registered types are gob encoded after their name.
+	Fields are count and pairs of field id and data, they keep properties of
+	items other than value and expiration.
+	Tags and ops are part of the format, so new ones must be only appended.
+*/
+const (
+	snapshotMagic   = "REBIS"
+	snapshotVersion = 2 // version 1 with entries of tags is not read
+)
+
+const (
+	opEntry       byte = 0x01
+	opEntryFields byte = 0x03 // entry with fields of the item, 0x02 is not used
+	opEOF         byte = 0xFF
+)
+
+const (
+	fieldTags    byte = iota + 1 // count, tags
+	fieldSliding                 // sliding time of life, maximum expiration
+	fieldVersion                 // version
+)
+
+const (
+	tagNil byte = iota
+	tagString
+	tagBytes
+	tagBool
+	tagInt
+	tagInt8
+	tagInt16
+	tagInt32
+	tagInt64
+	tagUint
+	tagUint8
+	tagUint16
+	tagUint32
+	tagUint64
+	tagUintptr
+	tagFloat32
+	tagFloat64
+	tagComplex64
+	tagComplex128
+	tagTime
+	tagRegistered
+	tagList
+	tagMap
+	tagHash
+	tagStrings
+	tagSet
+	tagSortedSet
+	tagStream
+)
+
+// ErrNotRegistered is returned by writes to the append-only file of values
+// of types which are not registered by RegisterType.
+var ErrNotRegistered = errors.New("rebis: type is not registered")
+
+var (
+	errSnapshotFormat = errors.New("invalid snapshot")
+	crcTable          = crc32.MakeTable(crc32.Castagnoli)
+)
+
+/*
+	registry of user types which can be saved in snapshots.
+*/
+var registry = struct {
+	sync.RWMutex
+	names map[reflect.Type]string
+	types map[string]reflect.Type
+}{
+	names: make(map[reflect.Type]string),
+	types: make(map[string]reflect.Type),
+}
+
+/*
+	RegisterType records the type of value, so values of that type can be
+	saved in backups and restored with the same Go type. Values of builtin
+	types (numbers, string, []byte, bool, time.Time, []interface{} and
+	map[string]interface{} of them) do not need to be registered. Items of
+	other types are skipped by backups. Registered values are encoded with
+	encoding/gob, so only exported fields are saved. The name of the type is
+	its package path and name, use RegisterTypeName if the type can be moved
+	or renamed.
+*/
+func RegisterType(value interface{}) {
+	t := reflect.TypeOf(value)
+
+	name := t.String()
+	if t.Name() != "" && t.PkgPath() != "" {
+		name = t.PkgPath() + "." + t.Name()
+	}
+
+	RegisterTypeName(name, value)
+}
+
+/*
+	RegisterTypeName is like RegisterType but uses the provided name for the
+	type. It panics if the name or the type are already registered with
+	another pair.
+*/
+func RegisterTypeName(name string, value interface{}) {
+	if name == "" {
+		panic("rebis: attempt to register empty name")
+	}
+
+	t := reflect.TypeOf(value)
+	if t == nil {
+		panic("rebis: attempt to register nil value")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if n, found := registry.names[t]; found && n != name {
+		panic(fmt.Sprintf("rebis: registering duplicate types for %q: %s != %s", name, t, n))
+	}
+
+	if rt, found := registry.types[name]; found && rt != t {
+		panic(fmt.Sprintf("rebis: registering duplicate names for %s: %q != %q", t, rt, name))
+	}
+
+	registry.names[t] = name
+	registry.types[name] = t
+}
+
+func registeredName(t reflect.Type) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	name, found := registry.names[t]
+
+	return name, found
+}
+
+func registeredType(name string) (reflect.Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	t, found := registry.types[name]
+
+	return t, found
+}
+
+/*
+	snapshotWriter encodes the snapshot and counts its checksum, it is also
+	used for records of the append-only file.
+*/
+type snapshotWriter struct {
+	w   io.Writer
+	crc uint32
+	buf [binary.MaxVarintLen64]byte
+}
+
+/*
+	Create writer and write the header of the snapshot, w should be buffered.
+*/
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	sw := &snapshotWriter{w: w}
+	sw.write([]byte(snapshotMagic))
+	sw.write([]byte{snapshotVersion})
+
+	return sw
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	sw.crc = crc32.Update(sw.crc, crcTable, p)
+	sw.w.Write(p)
+}
+
+func (sw *snapshotWriter) byte(b byte) {
+	sw.buf[0] = b
+	sw.write(sw.buf[:1])
+}
+
+func (sw *snapshotWriter) varint(n int64) {
+	sw.write(sw.buf[:binary.PutVarint(sw.buf[:], n)])
+}
+
+func (sw *snapshotWriter) uvarint(n uint64) {
+	sw.write(sw.buf[:binary.PutUvarint(sw.buf[:], n)])
+}
+
+func (sw *snapshotWriter) fixed32(n uint32) {
+	binary.LittleEndian.PutUint32(sw.buf[:], n)
+	sw.write(sw.buf[:4])
+}
+
+func (sw *snapshotWriter) fixed64(n uint64) {
+	binary.LittleEndian.PutUint64(sw.buf[:], n)
+	sw.write(sw.buf[:8])
+}
+
+func (sw *snapshotWriter) bytes(p []byte) {
+	sw.uvarint(uint64(len(p)))
+	sw.write(p)
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.bytes([]byte(s))
+}
+
+/*
+	Write count and strings.
+*/
+func (sw *snapshotWriter) strings(list []string) {
+	sw.uvarint(uint64(len(list)))
+	for _, s := range list {
+		sw.string(s)
+	}
+}
+
+func (sw *snapshotWriter) entry(k string, item Item) error {
+	if !hasFields(item) {
+		sw.byte(opEntry)
+		sw.string(k)
+		sw.varint(item.Expiration)
+	} else {
+		sw.byte(opEntryFields)
+		sw.string(k)
+		sw.varint(item.Expiration)
+		sw.fields(item)
+	}
+
+	return sw.value(item.Value)
+}
+
+/*
+	Check that the item has properties which are written as fields.
+*/
+func hasFields(item Item) bool {
+	return len(item.tags) > 0 || item.slide > 0 || item.version > 0
+}
+
+/*
+	Write fields of the item which are set.
+*/
+func (sw *snapshotWriter) fields(item Item) {
+	var n uint64
+	if len(item.tags) > 0 {
+		n++
+	}
+
+	if item.slide > 0 {
+		n++
+	}
+
+	if item.version > 0 {
+		n++
+	}
+
+	sw.uvarint(n)
+
+	if len(item.tags) > 0 {
+		sw.byte(fieldTags)
+		sw.strings(item.tags)
+	}
+
+	if item.slide > 0 {
+		sw.byte(fieldSliding)
+		sw.varint(item.slide)
+		sw.varint(item.deadline)
+	}
+
+	if item.version > 0 {
+		sw.byte(fieldVersion)
+		sw.uvarint(item.version)
+	}
+}
+
+/*
+	Write the type tag and the value.
+*/
+func (sw *snapshotWriter) value(x interface{}) error {
+	switch v := x.(type) {
+	case nil:
+		sw.byte(tagNil)
+	case string:
+		sw.byte(tagString)
+		sw.string(v)
+	case []byte:
+		sw.byte(tagBytes)
+		sw.bytes(v)
+	case bool:
+		sw.byte(tagBool)
+		if v {
+			sw.byte(1)
+		} else {
+			sw.byte(0)
+		}
+	case int:
+		sw.byte(tagInt)
+		sw.varint(int64(v))
+	case int8:
+		sw.byte(tagInt8)
+		sw.varint(int64(v))
+	case int16:
+		sw.byte(tagInt16)
+		sw.varint(int64(v))
+	case int32:
+		sw.byte(tagInt32)
+		sw.varint(int64(v))
+	case int64:
+		sw.byte(tagInt64)
+		sw.varint(v)
+	case uint:
+		sw.byte(tagUint)
+		sw.uvarint(uint64(v))
+	case uint8:
+		sw.byte(tagUint8)
+		sw.uvarint(uint64(v))
+	case uint16:
+		sw.byte(tagUint16)
+		sw.uvarint(uint64(v))
+	case uint32:
+		sw.byte(tagUint32)
+		sw.uvarint(uint64(v))
+	case uint64:
+		sw.byte(tagUint64)
+		sw.uvarint(v)
+	case uintptr:
+		sw.byte(tagUintptr)
+		sw.uvarint(uint64(v))
+	case float32:
+		sw.byte(tagFloat32)
+		sw.fixed32(math.Float32bits(v))
+	case float64:
+		sw.byte(tagFloat64)
+		sw.fixed64(math.Float64bits(v))
+	case complex64:
+		sw.byte(tagComplex64)
+		sw.fixed32(math.Float32bits(real(v)))
+		sw.fixed32(math.Float32bits(imag(v)))
+	case complex128:
+		sw.byte(tagComplex128)
+		sw.fixed64(math.Float64bits(real(v)))
+		sw.fixed64(math.Float64bits(imag(v)))
+	case time.Time:
+		buf, err := v.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		sw.byte(tagTime)
+		sw.bytes(buf)
+	case []interface{}:
+		sw.byte(tagList)
+		sw.uvarint(uint64(len(v)))
+
+		for _, e := range v {
+			if err := sw.value(e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		sw.byte(tagMap)
+		sw.uvarint(uint64(len(v)))
+
+		for k, e := range v {
+			sw.string(k)
+
+			if err := sw.value(e); err != nil {
+				return err
+			}
+		}
+	case Hash:
+		sw.byte(tagHash)
+		sw.uvarint(uint64(len(v)))
+
+		for f, e := range v {
+			sw.string(f)
+			sw.string(e)
+		}
+	case *List:
+		sw.byte(tagStrings)
+		sw.strings(v.Values())
+	case Set:
+		sw.byte(tagSet)
+		sw.strings(v.members())
+	case *SortedSet:
+		sw.byte(tagSortedSet)
+		sw.uvarint(uint64(v.Len()))
+
+		for _, m := range v.Members() {
+			sw.string(m.Member)
+			sw.fixed64(math.Float64bits(m.Score))
+		}
+	case *Stream:
+		sw.byte(tagStream)
+		sw.stream(v)
+	default:
+		name, found := registeredName(reflect.TypeOf(x))
+		if !found {
+			return fmt.Errorf("%w: %T", ErrNotRegistered, x)
+		}
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(x); err != nil {
+			return fmt.Errorf("can not encode %T: %w", x, err)
+		}
+
+		sw.byte(tagRegistered)
+		sw.string(name)
+		sw.bytes(buf.Bytes())
+	}
+
+	return nil
+}
+
+/*
+	Write the last ID, entries and groups of the stream, groups keep their
+	last delivered IDs and pending entries.
+*/
+func (sw *snapshotWriter) stream(st *Stream) {
+	sw.streamID(st.last)
+	sw.uvarint(uint64(len(st.entries)))
+
+	for _, e := range st.entries {
+		sw.streamID(e.id)
+		sw.uvarint(uint64(len(e.fields)))
+
+		for f, v := range e.fields {
+			sw.string(f)
+			sw.string(v)
+		}
+	}
+
+	sw.uvarint(uint64(len(st.groups)))
+
+	for name, g := range st.groups {
+		sw.string(name)
+		sw.streamID(g.last)
+		sw.uvarint(uint64(len(g.pending)))
+
+		for id, p := range g.pending {
+			sw.streamID(id)
+			sw.string(p.consumer)
+			sw.varint(p.delivered)
+			sw.uvarint(uint64(p.count))
+		}
+	}
+}
+
+func (sw *snapshotWriter) streamID(id streamID) {
+	sw.uvarint(id.ms)
+	sw.uvarint(id.seq)
+}
+
+/*
+	Check that the value can be written by value without encoding it, values
+	of types which are not registered can't be written.
+*/
+func encodable(x interface{}) error {
+	switch v := x.(type) {
+	case nil, string, []byte, bool, int, int8, int16, int32, int64, uint, uint8,
+		uint16, uint32, uint64, uintptr, float32, float64, complex64, complex128,
+		time.Time, Hash, *List, Set, *SortedSet, *Stream:
+	case []interface{}:
+		for _, e := range v {
+			if err := encodable(e); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			if err := encodable(e); err != nil {
+				return err
+			}
+		}
+	default:
+		if _, found := registeredName(reflect.TypeOf(x)); !found {
+			return fmt.Errorf("%w: %T", ErrNotRegistered, x)
+		}
+	}
+
+	return nil
+}
+
+/*
+	Write the end of the snapshot and the checksum.
+*/
+func (sw *snapshotWriter) close() {
+	sw.byte(opEOF)
+
+	binary.LittleEndian.PutUint32(sw.buf[:], sw.crc)
+	sw.w.Write(sw.buf[:4])
+}
+
+/*
+	snapshotReader decodes the snapshot from the buffer.
+*/
+type snapshotReader struct {
+	r *bytes.Reader
+}
+
+/*
+	Check magic, version and checksum of the snapshot.
+*/
+func newSnapshotReader(buf []byte) (*snapshotReader, error) {
+	if len(buf) < len(snapshotMagic)+1+1+4 || string(buf[:len(snapshotMagic)]) != snapshotMagic {
+		return nil, errSnapshotFormat
+	}
+
+	if v := buf[len(snapshotMagic)]; v != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, version %d is required", v, snapshotVersion)
+	}
+
+	body, sum := buf[:len(buf)-4], binary.LittleEndian.Uint32(buf[len(buf)-4:])
+	if crc32.Checksum(body, crcTable) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", errSnapshotFormat)
+	}
+
+	return &snapshotReader{r: bytes.NewReader(body[len(snapshotMagic)+1:])}, nil
+}
+
+/*
+	Read all entries of the snapshot.
+*/
+func (sr *snapshotReader) items() (map[string]Item, error) {
+	items := make(map[string]Item)
+
+	for {
+		op, err := sr.r.ReadByte()
+		if err != nil {
+			return nil, sr.err(err)
+		}
+
+		switch op {
+		case opEOF:
+			if sr.r.Len() != 0 {
+				return nil, fmt.Errorf("%w: data after the end", errSnapshotFormat)
+			}
+
+			return items, nil
+		case opEntry, opEntryFields:
+			k, err := sr.string()
+			if err != nil {
+				return nil, err
+			}
+
+			var item Item
+			if item.Expiration, err = binary.ReadVarint(sr.r); err != nil {
+				return nil, sr.err(err)
+			}
+
+			if err := sr.itemFields(op, &item); err != nil {
+				return nil, fmt.Errorf("item %s: %w", k, err)
+			}
+
+			if item.Value, err = sr.value(); err != nil {
+				return nil, fmt.Errorf("item %s: %w", k, err)
+			}
+
+			items[k] = item
+		default:
+			return nil, fmt.Errorf("%w: unknown op 0x%02x", errSnapshotFormat, op)
+		}
+	}
+}
+
+func (sr *snapshotReader) err(err error) error {
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: unexpected end", errSnapshotFormat)
+	}
+
+	return err
+}
+
+func (sr *snapshotReader) bytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return nil, sr.err(err)
+	}
+
+	if n > uint64(sr.r.Len()) {
+		return nil, fmt.Errorf("%w: unexpected end", errSnapshotFormat)
+	}
+
+	buf := make([]byte, n)
+	sr.r.Read(buf)
+
+	return buf, nil
+}
+
+func (sr *snapshotReader) string() (string, error) {
+	buf, err := sr.bytes()
+
+	return string(buf), err
+}
+
+/*
+	Read fields of the item written by the op.
+*/
+func (sr *snapshotReader) itemFields(op byte, item *Item) error {
+	if op == opEntryFields || op == aofSetFields {
+		return sr.fields(item)
+	}
+
+	return nil
+}
+
+func (sr *snapshotReader) fields(item *Item) error {
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return sr.err(err)
+	}
+
+	for i := uint64(0); i < n; i++ {
+		field, err := sr.r.ReadByte()
+		if err != nil {
+			return sr.err(err)
+		}
+
+		switch field {
+		case fieldTags:
+			if item.tags, err = sr.strings(); err != nil {
+				return err
+			}
+		case fieldSliding:
+			if item.slide, err = binary.ReadVarint(sr.r); err != nil {
+				return sr.err(err)
+			}
+
+			if item.deadline, err = binary.ReadVarint(sr.r); err != nil {
+				return sr.err(err)
+			}
+		case fieldVersion:
+			if item.version, err = binary.ReadUvarint(sr.r); err != nil {
+				return sr.err(err)
+			}
+		default:
+			return fmt.Errorf("%w: unknown field 0x%02x", errSnapshotFormat, field)
+		}
+	}
+
+	return nil
+}
+
+func (sr *snapshotReader) strings() ([]string, error) {
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return nil, sr.err(err)
+	}
+
+	if n > uint64(sr.r.Len()) {
+		return nil, fmt.Errorf("%w: unexpected end", errSnapshotFormat)
+	}
+
+	list := make([]string, n)
+	for i := range list {
+		if list[i], err = sr.string(); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+func (sr *snapshotReader) fixed32() (uint32, error) {
+	var buf [4]byte
+	if _, err := io.ReadFull(sr.r, buf[:]); err != nil {
+		return 0, sr.err(err)
+	}
+
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+func (sr *snapshotReader) fixed64() (uint64, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(sr.r, buf[:]); err != nil {
+		return 0, sr.err(err)
+	}
+
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
+/*
+	Read the type tag and the value with the same Go type as it was saved.
+*/
+func (sr *snapshotReader) value() (interface{}, error) {
+	tag, err := sr.r.ReadByte()
+	if err != nil {
+		return nil, sr.err(err)
+	}
+
+	switch tag {
+	case tagNil:
+		return nil, nil
+	case tagString:
+		return sr.string()
+	case tagBytes:
+		return sr.bytes()
+	case tagBool:
+		b, err := sr.r.ReadByte()
+
+		return b != 0, sr.err(err)
+	case tagInt, tagInt8, tagInt16, tagInt32, tagInt64:
+		n, err := binary.ReadVarint(sr.r)
+		if err != nil {
+			return nil, sr.err(err)
+		}
+
+		return signed(tag, n), nil
+	case tagUint, tagUint8, tagUint16, tagUint32, tagUint64, tagUintptr:
+		n, err := binary.ReadUvarint(sr.r)
+		if err != nil {
+			return nil, sr.err(err)
+		}
+
+		return unsigned(tag, n), nil
+	case tagFloat32:
+		n, err := sr.fixed32()
+
+		return math.Float32frombits(n), err
+	case tagFloat64:
+		n, err := sr.fixed64()
+
+		return math.Float64frombits(n), err
+	case tagComplex64:
+		re, err := sr.fixed32()
+		if err != nil {
+			return nil, err
+		}
+
+		im, err := sr.fixed32()
+
+		return complex(math.Float32frombits(re), math.Float32frombits(im)), err
+	case tagComplex128:
+		re, err := sr.fixed64()
+		if err != nil {
+			return nil, err
+		}
+
+		im, err := sr.fixed64()
+
+		return complex(math.Float64frombits(re), math.Float64frombits(im)), err
+	case tagTime:
+		buf, err := sr.bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		var t time.Time
+		err = t.UnmarshalBinary(buf)
+
+		return t, err
+	case tagRegistered:
+		return sr.registered()
+	case tagList, tagMap:
+		return sr.container(tag)
+	case tagHash:
+		return sr.hash()
+	case tagStrings:
+		values, err := sr.strings()
+		if err != nil {
+			return nil, err
+		}
+
+		return NewList(values...), nil
+	case tagSet:
+		members, err := sr.strings()
+		if err != nil {
+			return nil, err
+		}
+
+		set := make(Set, len(members))
+		for _, m := range members {
+			set[m] = struct{}{}
+		}
+
+		return set, nil
+	case tagSortedSet:
+		return sr.sortedSet()
+	case tagStream:
+		return sr.stream()
+	default:
+		return nil, fmt.Errorf("%w: unknown type tag 0x%02x", errSnapshotFormat, tag)
+	}
+}
+
+func (sr *snapshotReader) registered() (interface{}, error) {
+	name, err := sr.string()
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := sr.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	t, found := registeredType(name)
+	if !found {
+		return nil, fmt.Errorf("type %q is not registered", name)
+	}
+
+	v := reflect.New(t)
+	if err := gob.NewDecoder(bytes.NewReader(buf)).DecodeValue(v); err != nil {
+		return nil, fmt.Errorf("can not decode %s: %w", name, err)
+	}
+
+	return v.Elem().Interface(), nil
+}
+
+/*
+	Read []interface{} or map[string]interface{}, which are decoded JSON
+	values usually.
+*/
+func (sr *snapshotReader) container(tag byte) (interface{}, error) {
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return nil, sr.err(err)
+	}
+
+	if n > uint64(sr.r.Len()) {
+		return nil, fmt.Errorf("%w: unexpected end", errSnapshotFormat)
+	}
+
+	if tag == tagList {
+		list := make([]interface{}, n)
+		for i := range list {
+			if list[i], err = sr.value(); err != nil {
+				return nil, err
+			}
+		}
+
+		return list, nil
+	}
+
+	m := make(map[string]interface{}, n)
+
+	for i := uint64(0); i < n; i++ {
+		k, err := sr.string()
+		if err != nil {
+			return nil, err
+		}
+
+		if m[k], err = sr.value(); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func (sr *snapshotReader) hash() (Hash, error) {
+	n, err := sr.count()
+	if err != nil {
+		return nil, err
+	}
+
+	h := make(Hash, n)
+
+	for i := 0; i < n; i++ {
+		f, err := sr.string()
+		if err != nil {
+			return nil, err
+		}
+
+		if h[f], err = sr.string(); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+func (sr *snapshotReader) sortedSet() (*SortedSet, error) {
+	n, err := sr.count()
+	if err != nil {
+		return nil, err
+	}
+
+	z := NewSortedSet()
+
+	for i := 0; i < n; i++ {
+		m, err := sr.string()
+		if err != nil {
+			return nil, err
+		}
+
+		bits, err := sr.fixed64()
+		if err != nil {
+			return nil, err
+		}
+
+		z.add(m, math.Float64frombits(bits))
+	}
+
+	return z, nil
+}
+
+func (sr *snapshotReader) stream() (*Stream, error) {
+	st := &Stream{}
+
+	var err error
+	if st.last, err = sr.streamID(); err != nil {
+		return nil, err
+	}
+
+	n, err := sr.count()
+	if err != nil {
+		return nil, err
+	}
+
+	st.entries = make([]streamEntry, n)
+
+	for i := range st.entries {
+		e := &st.entries[i]
+		if e.id, err = sr.streamID(); err != nil {
+			return nil, err
+		}
+
+		if e.fields, err = sr.hash(); err != nil {
+			return nil, err
+		}
+	}
+
+	if n, err = sr.count(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n; i++ {
+		name, err := sr.string()
+		if err != nil {
+			return nil, err
+		}
+
+		last, err := sr.streamID()
+		if err != nil {
+			return nil, err
+		}
+
+		g := st.group(name, last)
+
+		pending, err := sr.count()
+		if err != nil {
+			return nil, err
+		}
+
+		for j := 0; j < pending; j++ {
+			var p pendingEntry
+
+			id, err := sr.streamID()
+			if err != nil {
+				return nil, err
+			}
+
+			if p.consumer, err = sr.string(); err != nil {
+				return nil, err
+			}
+
+			if p.delivered, err = binary.ReadVarint(sr.r); err != nil {
+				return nil, sr.err(err)
+			}
+
+			count, err := binary.ReadUvarint(sr.r)
+			if err != nil {
+				return nil, sr.err(err)
+			}
+
+			p.count = int(count)
+			g.pending[id] = &p
+		}
+	}
+
+	return st, nil
+}
+
+func (sr *snapshotReader) streamID() (streamID, error) {
+	var (
+		id  streamID
+		err error
+	)
+
+	if id.ms, err = binary.ReadUvarint(sr.r); err != nil {
+		return id, sr.err(err)
+	}
+
+	if id.seq, err = binary.ReadUvarint(sr.r); err != nil {
+		return id, sr.err(err)
+	}
+
+	return id, nil
+}
+
+/*
+	Read the count of elements, every element takes at least one byte.
+*/
+func (sr *snapshotReader) count() (int, error) {
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return 0, sr.err(err)
+	}
+
+	if n > uint64(sr.r.Len()) {
+		return 0, fmt.Errorf("%w: unexpected end", errSnapshotFormat)
+	}
+
+	return int(n), nil
+}
+
+func signed(tag byte, n int64) interface{} {
+	switch tag {
+	case tagInt:
+		return int(n)
+	case tagInt8:
+		return int8(n)
+	case tagInt16:
+		return int16(n)
+	case tagInt32:
+		return int32(n)
+	default:
+		return n
+	}
+}
+
+func unsigned(tag byte, n uint64) interface{} {
+	switch tag {
+	case tagUint:
+		return uint(n)
+	case tagUint8:
+		return uint8(n)
+	case tagUint16:
+		return uint16(n)
+	case tagUint32:
+		return uint32(n)
+	case tagUintptr:
+		return uintptr(n)
+	default:
+		return n
+	}
+}
@@ -0,0 +1,192 @@
+package rebis
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type snapshotStruct struct {
+	Name string
+	Tags []string
+}
+
+func TestSnapshotValues(t *testing.T) {
+	RegisterType(snapshotStruct{})
+	RegisterType(&TestStruct{})
+
+	now := time.Now()
+	values := map[string]interface{}{
+		"nil":        nil,
+		"string":     "string",
+		"bytes":      []byte{1, 2, 3},
+		"bool":       true,
+		"int":        -1,
+		"int8":       int8(-8),
+		"int16":      int16(-16),
+		"int32":      int32(-32),
+		"int64":      int64(-64),
+		"uint":       uint(1),
+		"uint8":      uint8(8),
+		"uint16":     uint16(16),
+		"uint32":     uint32(32),
+		"uint64":     uint64(1 << 63),
+		"uintptr":    uintptr(10),
+		"float32":    float32(3.5),
+		"float64":    3.25,
+		"complex64":  complex64(1 + 2i),
+		"complex128": 3 + 4i,
+		"time":       now,
+		"struct":     snapshotStruct{Name: "a", Tags: []string{"b", "c"}},
+		"pointer":    &TestStruct{Num: 1, Children: []*TestStruct{{Num: 2}}},
+		"json":       map[string]interface{}{"a": []interface{}{1.5, "b", nil}, "c": map[string]interface{}{}},
+	}
+
+	var buf bytes.Buffer
+	sw := newSnapshotWriter(&buf)
+	for k, v := range values {
+		if err := sw.entry(k, Item{Value: v, Expiration: 42}); err != nil {
+			t.Fatalf("Couldn't write %s: %s", k, err)
+		}
+	}
+	sw.close()
+
+	sr, err := newSnapshotReader(buf.Bytes())
+	if err != nil {
+		t.Fatal("Couldn't read snapshot:", err)
+	}
+	items, err := sr.items()
+	if err != nil {
+		t.Fatal("Couldn't read items:", err)
+	}
+	if len(items) != len(values) {
+		t.Errorf("items count is not %d: %d", len(values), len(items))
+	}
+	for k, v := range values {
+		item := items[k]
+		if item.Expiration != 42 {
+			t.Errorf("expiration of %s is not 42: %d", k, item.Expiration)
+		}
+		if tm, ok := v.(time.Time); ok {
+			if !tm.Equal(item.Value.(time.Time)) {
+				t.Errorf("time is not restored: %v", item.Value)
+			}
+
+			continue
+		}
+		if !reflect.DeepEqual(item.Value, v) {
+			t.Errorf("%s is not restored: %#v (%T)", k, item.Value, item.Value)
+		}
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	var buf bytes.Buffer
+	sw := newSnapshotWriter(&buf)
+	if err := sw.entry("a", Item{Value: struct{ A int }{1}}); err == nil {
+		t.Error("wrote not registered type")
+	}
+
+	buf.Reset()
+	sw = newSnapshotWriter(&buf)
+	sw.entry("a", Item{Value: "a"})
+	sw.close()
+	snapshot := buf.Bytes()
+
+	corrupted := append([]byte{}, snapshot...)
+	corrupted[len(snapshotMagic)+3] ^= 0xFF
+	if _, err := newSnapshotReader(corrupted); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Error("checksum is not checked:", err)
+	}
+
+	newer := append([]byte{}, snapshot...)
+	newer[len(snapshotMagic)] = snapshotVersion + 1
+	if _, err := newSnapshotReader(newer); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Error("version is not checked:", err)
+	}
+
+	older := append([]byte{}, snapshot...)
+	older[len(snapshotMagic)] = snapshotVersion - 1
+	if _, err := newSnapshotReader(older); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Error("old version is read:", err)
+	}
+
+	if _, err := newSnapshotReader([]byte(`{"a":{"Value":"a"}}`)); err == nil {
+		t.Error("json is read as snapshot")
+	}
+}
+
+func TestBackupSkipsNotRegistered(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("a", struct{ A int }{1}, DefaultExpiration)
+	tc.Set("b", "b", DefaultExpiration)
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup with not registered type:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if _, found := tr.Get("a"); found {
+		t.Error("item of not registered type is recovered")
+	}
+	if b, _ := tr.Get("b"); b != "b" {
+		t.Errorf("b is not recovered: %v", b)
+	}
+}
+
+type duplicateStruct struct {
+	A int
+}
+
+func TestRegisterTypeDuplicate(t *testing.T) {
+	RegisterTypeName("rebis.duplicate", duplicateStruct{})
+	RegisterTypeName("rebis.duplicate", duplicateStruct{})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registered other type with the same name")
+		}
+	}()
+	RegisterTypeName("rebis.duplicate", TestStruct{})
+}
+
+func TestBackupIncrement(t *testing.T) {
+	ts, err := NewCache(config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	ts.Set("int", 1, DefaultExpiration)
+	ts.Set("uint16", uint16(1), DefaultExpiration)
+	ts.Set("float", 1.5, NoExpiration)
+	if err := ts.BackupSaveFile("test.rdb"); err != nil {
+		t.Fatal("Couldn't save cache to test.rdb:", err)
+	}
+	if _, err := os.Stat("test.rdb"); err != nil {
+		t.Fatal("test.rdb is not created:", err)
+	}
+
+	tr, err := NewCache(config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	if err := tr.BackupRecoveryFile("test.rdb"); err != nil {
+		t.Fatal("Couldn't load cache from test.rdb:", err)
+	}
+	if n, err := tr.IncrementInt("int", 1); err != nil || n != 2 {
+		t.Error("Couldn't increment int after recovery:", n, err)
+	}
+	if n, err := tr.IncrementUint16("uint16", 1); err != nil || n != 2 {
+		t.Error("Couldn't increment uint16 after recovery:", n, err)
+	}
+	if n, err := tr.IncrementFloat64("float", 1); err != nil || n != 2.5 {
+		t.Error("Couldn't increment float64 after recovery:", n, err)
+	}
+}
@@ -0,0 +1,740 @@
+package rebis
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+	ZAddFlag changes the behavior of ZAdd like options of ZADD in Redis.
+*/
+type ZAddFlag uint8
+
+const (
+	ZAddNX ZAddFlag = 1 << iota // only add new members
+	ZAddXX                      // only update existing members
+	ZAddGT                      // update existing members only if the new score is greater
+	ZAddLT                      // update existing members only if the new score is less
+)
+
+/*
+	ZMember is a member of the sorted set with its score.
+*/
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+/*
+	ZRangeBy selects members by score or lex range like ZRANGEBYSCORE and
+	ZRANGEBYLEX of Redis. Score bounds are numbers, "-inf" or "+inf", lex
+	bounds are "-", "+" or members after "[". A bound after "(" is excluded.
+	Offset members of the range are skipped, positive Count limits the count
+	of returned members. With Rev members are returned from the greatest.
+*/
+type ZRangeBy struct {
+	Min, Max      string
+	Offset, Count int
+	Rev           bool
+}
+
+/*
+	SortedSet is a value of the sorted set data type, unique strings ordered
+	by their scores. Get returns a copy of the sorted set, it is changed only
+	by Z methods. The zero value is an empty sorted set.
+*/
+type SortedSet struct {
+	scores map[string]float64
+	list   *skiplist
+}
+
+/*
+	Bounds of the range as functions of nodes, ge is true for nodes not
+	before the minimum, le is true for nodes not after the maximum.
+*/
+type zrange struct {
+	ge, le func(n *skipnode) bool
+}
+
+/*
+	NewSortedSet returns the sorted set of the members.
+*/
+func NewSortedSet(members ...ZMember) *SortedSet {
+	z := &SortedSet{scores: make(map[string]float64, len(members)), list: newSkiplist()}
+	for _, m := range members {
+		z.add(m.Member, m.Score)
+	}
+
+	return z
+}
+
+/*
+	Len returns the count of members of the sorted set.
+*/
+func (z *SortedSet) Len() int {
+	if z == nil || z.list == nil {
+		return 0
+	}
+
+	return z.list.length
+}
+
+/*
+	Score returns the score of the member and a bool indicating whether the
+	member was found.
+*/
+func (z *SortedSet) Score(member string) (float64, bool) {
+	if z == nil {
+		return 0, false
+	}
+
+	score, found := z.scores[member]
+
+	return score, found
+}
+
+/*
+	Members returns members of the sorted set from the lowest score.
+*/
+func (z *SortedSet) Members() []ZMember {
+	members := make([]ZMember, 0, z.Len())
+	if z.Len() == 0 {
+		return members
+	}
+
+	for n := z.list.head.levels[0].next; n != nil; n = n.levels[0].next {
+		members = append(members, ZMember{n.member, n.score})
+	}
+
+	return members
+}
+
+/*
+	Size of the sorted set is the size of its members and scores.
+*/
+func (z *SortedSet) Size() uintptr {
+	var n uintptr
+	if z == nil {
+		return n
+	}
+
+	for m := range z.scores {
+		n += uintptr(zsetMemberSize(m))
+	}
+
+	return n
+}
+
+func (z *SortedSet) length() int {
+	return z.Len()
+}
+
+func (z *SortedSet) clone() interface{} {
+	return NewSortedSet(z.Members()...)
+}
+
+/*
+	Add the member or change its score, returns true if it is added.
+*/
+func (z *SortedSet) add(member string, score float64) bool {
+	if z.list == nil {
+		z.scores, z.list = make(map[string]float64), newSkiplist()
+	}
+
+	old, found := z.scores[member]
+	if found {
+		if old == score {
+			return false
+		}
+
+		z.list.delete(old, member)
+	}
+
+	z.scores[member] = score
+	z.list.insert(score, member)
+
+	return !found
+}
+
+func (z *SortedSet) remove(member string) bool {
+	score, found := z.scores[member]
+	if !found {
+		return false
+	}
+
+	delete(z.scores, member)
+	z.list.delete(score, member)
+
+	return true
+}
+
+/*
+	Returns members of the range by ZRangeBy rules.
+*/
+func (z *SortedSet) rangeBy(r zrange, offset, count int, rev bool) []ZMember {
+	members := []ZMember{}
+	if z.Len() == 0 {
+		return members
+	}
+
+	n, in, next := z.list.first(r.ge), r.le, func(n *skipnode) *skipnode { return n.levels[0].next }
+	if rev {
+		n, in, next = z.list.last(r.le), r.ge, func(n *skipnode) *skipnode { return n.back }
+	}
+
+	for ; n != nil && in(n); n = next(n) {
+		if offset > 0 {
+			offset--
+
+			continue
+		}
+
+		if count > 0 && len(members) == count {
+			break
+		}
+
+		members = append(members, ZMember{n.member, n.score})
+	}
+
+	return members
+}
+
+/*
+	ZAdd adds the members to the sorted set or changes their scores and
+	returns the count of added members. Flags are like options of ZADD, NX
+	can not be used with XX, GT or LT. The sorted set is created with the
+	default expiration if the key is not found.
+*/
+func (c *cache) ZAdd(k string, flags ZAddFlag, members ...ZMember) (int, error) {
+	if err := checkZAddFlags(flags); err != nil {
+		return 0, err
+	}
+
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, fmt.Errorf("score of %s is not a number", m.Member)
+		}
+	}
+
+	var added int
+
+	change := &Change{Op: "ZAdd", Args: make([]string, 0, 1+2*len(members))}
+	change.Args = append(change.Args, formatInt(int64(flags)))
+
+	for _, m := range members {
+		change.Args = append(change.Args, m.Member, formatFloat(m.Score))
+	}
+
+	err := changeValue(c, k, change, func(z *SortedSet, grow func(n int) bool) (*SortedSet, error) {
+		var (
+			n       int
+			changes = make(map[string]float64, len(members))
+		)
+
+		for _, m := range members {
+			old, found := changes[m.Member]
+			if !found {
+				old, found = z.Score(m.Member)
+			}
+
+			if !zaddAllowed(flags, found, old, m.Score) || found && old == m.Score {
+				continue
+			}
+
+			if !found {
+				n += zsetMemberSize(m.Member)
+			}
+
+			changes[m.Member] = m.Score
+		}
+
+		if len(changes) == 0 {
+			return z, nil
+		}
+
+		if !grow(n) {
+			return z, errNoSlot
+		}
+
+		if z == nil {
+			z = NewSortedSet()
+		}
+
+		for m, score := range changes {
+			if z.add(m, score) {
+				added++
+			}
+		}
+
+		return z, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("zadd %s %v, added %d members", k, members, added)
+
+	return added, nil
+}
+
+/*
+	ZAddIncr increments the score of the member by n like ZADD with INCR and
+	returns the new score. The bool is false if the flags forbid the change.
+*/
+func (c *cache) ZAddIncr(k string, flags ZAddFlag, member string, n float64) (float64, bool, error) {
+	if err := checkZAddFlags(flags); err != nil {
+		return 0, false, err
+	}
+
+	var (
+		score   float64
+		changed bool
+		change  = &Change{Op: "ZAddIncr", Args: []string{formatInt(int64(flags)), member, formatFloat(n)}}
+	)
+
+	err := changeValue(c, k, change, func(z *SortedSet, grow func(n int) bool) (*SortedSet, error) {
+		old, found := z.Score(member)
+
+		score = old + n
+		if math.IsNaN(score) {
+			return z, fmt.Errorf("increment of %s would produce NaN", member)
+		}
+
+		if !zaddAllowed(flags, found, old, score) {
+			return z, nil
+		}
+
+		var size int
+		if !found {
+			size = zsetMemberSize(member)
+		}
+
+		if !grow(size) {
+			return z, errNoSlot
+		}
+
+		if z == nil {
+			z = NewSortedSet()
+		}
+
+		z.add(member, score)
+		changed = true
+
+		return z, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	if !changed {
+		return 0, false, nil
+	}
+
+	c.logIf("zincr %s %s by %g -> %g", k, member, n, score)
+
+	return score, true, nil
+}
+
+/*
+	ZIncrBy increments the score of the member by n and returns the new
+	score. The missing member is added with the score n.
+*/
+func (c *cache) ZIncrBy(k string, n float64, member string) (float64, error) {
+	score, _, err := c.ZAddIncr(k, 0, member, n)
+
+	return score, err
+}
+
+/*
+	ZScore returns the score of the member and a bool indicating whether the
+	member was found.
+*/
+func (c *cache) ZScore(k, member string) (float64, bool, error) {
+	var (
+		score float64
+		found bool
+	)
+
+	err := readValue(c, k, func(z *SortedSet) {
+		score, found = z.Score(member)
+	})
+
+	return score, found, err
+}
+
+/*
+	ZCard returns the count of members of the sorted set.
+*/
+func (c *cache) ZCard(k string) (int, error) {
+	var n int
+
+	err := readValue(c, k, func(z *SortedSet) {
+		n = z.Len()
+	})
+
+	return n, err
+}
+
+/*
+	ZRank returns the 0-based rank of the member from the lowest score and a
+	bool indicating whether the member was found.
+*/
+func (c *cache) ZRank(k, member string) (int, bool, error) {
+	return c.zrank(k, member, false)
+}
+
+/*
+	ZRevRank returns the 0-based rank of the member from the greatest score.
+*/
+func (c *cache) ZRevRank(k, member string) (int, bool, error) {
+	return c.zrank(k, member, true)
+}
+
+/*
+	ZRange returns members from start to stop rank inclusive, from the
+	lowest score. Negative ranks count from the greatest score like in
+	LRange.
+*/
+func (c *cache) ZRange(k string, start, stop int) ([]ZMember, error) {
+	return c.zrangeByRank(k, start, stop, false)
+}
+
+/*
+	ZRevRange returns members like ZRange with ranks from the greatest score.
+*/
+func (c *cache) ZRevRange(k string, start, stop int) ([]ZMember, error) {
+	return c.zrangeByRank(k, start, stop, true)
+}
+
+/*
+	ZRangeByScore returns members with scores from Min to Max.
+*/
+func (c *cache) ZRangeByScore(k string, by ZRangeBy) ([]ZMember, error) {
+	r, err := scoreRange(by.Min, by.Max)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.zrangeBy(k, r, by)
+}
+
+/*
+	ZRangeByLex returns members from Min to Max in lexicographical order,
+	all members of the sorted set must have the same score.
+*/
+func (c *cache) ZRangeByLex(k string, by ZRangeBy) ([]ZMember, error) {
+	r, err := lexRange(by.Min, by.Max)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.zrangeBy(k, r, by)
+}
+
+/*
+	ZRem removes the members from the sorted set and returns the count of
+	removed members. The key is deleted with its last member.
+*/
+func (c *cache) ZRem(k string, members ...string) (int, error) {
+	var removed int
+
+	err := changeValue(c, k, &Change{Op: "ZRem", Args: changeArgs(members...)}, func(z *SortedSet, grow func(n int) bool) (*SortedSet, error) {
+		var n int
+		for _, m := range uniqueStrings(members) {
+			if _, found := z.Score(m); found {
+				n -= zsetMemberSize(m)
+			}
+		}
+
+		if n == 0 {
+			return z, nil
+		}
+
+		grow(n)
+
+		for _, m := range members {
+			if z.remove(m) {
+				removed++
+			}
+		}
+
+		return z, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("zrem %s %v, removed %d members", k, members, removed)
+
+	return removed, nil
+}
+
+/*
+	ZRemRangeByScore removes members with scores from min to max, bounds
+	are like in ZRangeBy. Returns the count of removed members.
+*/
+func (c *cache) ZRemRangeByScore(k, min, max string) (int, error) {
+	r, err := scoreRange(min, max)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed []ZMember
+
+	change := &Change{Op: "ZRemRangeByScore", Args: []string{min, max}}
+
+	err = changeValue(c, k, change, func(z *SortedSet, grow func(n int) bool) (*SortedSet, error) {
+		removed = z.rangeBy(r, 0, 0, false)
+
+		return c.zremove(z, removed, grow), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("zremrangebyscore %s %s %s, removed %d members", k, min, max, len(removed))
+
+	return len(removed), nil
+}
+
+/*
+	ZPopMin removes and returns count members with the lowest scores.
+*/
+func (c *cache) ZPopMin(k string, count int) ([]ZMember, error) {
+	return c.zpop(k, count, false)
+}
+
+/*
+	ZPopMax removes and returns count members with the greatest scores, from
+	the greatest.
+*/
+func (c *cache) ZPopMax(k string, count int) ([]ZMember, error) {
+	return c.zpop(k, count, true)
+}
+
+func (c *cache) zrank(k, member string, rev bool) (int, bool, error) {
+	var (
+		rank  int
+		found bool
+	)
+
+	err := readValue(c, k, func(z *SortedSet) {
+		var score float64
+		if score, found = z.Score(member); found {
+			rank = z.list.rank(score, member)
+			if rev {
+				rank = z.Len() - 1 - rank
+			}
+		}
+	})
+
+	return rank, found, err
+}
+
+func (c *cache) zrangeByRank(k string, start, stop int, rev bool) ([]ZMember, error) {
+	members := []ZMember{}
+
+	err := readValue(c, k, func(z *SortedSet) {
+		from, to := listRange(start, stop, z.Len())
+		if from == to {
+			return
+		}
+
+		if !rev {
+			for n := z.list.byRank(from); n != nil && len(members) < to-from; n = n.levels[0].next {
+				members = append(members, ZMember{n.member, n.score})
+			}
+
+			return
+		}
+
+		for n := z.list.byRank(z.Len() - 1 - from); n != nil && len(members) < to-from; n = n.back {
+			members = append(members, ZMember{n.member, n.score})
+		}
+	})
+
+	return members, err
+}
+
+func (c *cache) zrangeBy(k string, r zrange, by ZRangeBy) ([]ZMember, error) {
+	members := []ZMember{}
+
+	err := readValue(c, k, func(z *SortedSet) {
+		members = z.rangeBy(r, by.Offset, by.Count, by.Rev)
+	})
+
+	return members, err
+}
+
+func (c *cache) zpop(k string, count int, max bool) ([]ZMember, error) {
+	var popped []ZMember
+
+	change := &Change{Op: "ZPopMin", Args: []string{strconv.Itoa(count)}}
+	if max {
+		change.Op = "ZPopMax"
+	}
+
+	err := changeValue(c, k, change, func(z *SortedSet, grow func(n int) bool) (*SortedSet, error) {
+		if count <= 0 || z.Len() == 0 {
+			return z, nil
+		}
+
+		popped = z.rangeBy(zrange{ge: anyNode, le: anyNode}, 0, count, max)
+
+		return c.zremove(z, popped, grow), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if popped == nil {
+		popped = []ZMember{}
+	}
+
+	c.logIf("zpop %s -> %v", k, popped)
+
+	return popped, nil
+}
+
+/*
+	Remove the members from the sorted set and release their memory.
+*/
+func (c *cache) zremove(z *SortedSet, members []ZMember, grow func(n int) bool) *SortedSet {
+	if len(members) == 0 {
+		return z
+	}
+
+	var n int
+	for _, m := range members {
+		n -= zsetMemberSize(m.Member)
+		z.remove(m.Member)
+	}
+
+	grow(n)
+
+	return z
+}
+
+func anyNode(*skipnode) bool {
+	return true
+}
+
+func checkZAddFlags(flags ZAddFlag) error {
+	if flags&ZAddNX != 0 && flags&(ZAddXX|ZAddGT|ZAddLT) != 0 {
+		return fmt.Errorf("NX can not be used with XX, GT or LT")
+	}
+
+	if flags&ZAddGT != 0 && flags&ZAddLT != 0 {
+		return fmt.Errorf("GT can not be used with LT")
+	}
+
+	return nil
+}
+
+/*
+	Returns true if the flags allow to set the score of the member.
+*/
+func zaddAllowed(flags ZAddFlag, found bool, old, score float64) bool {
+	switch {
+	case found && flags&ZAddNX != 0:
+		return false
+	case !found && flags&ZAddXX != 0:
+		return false
+	case found && flags&ZAddGT != 0 && score <= old:
+		return false
+	case found && flags&ZAddLT != 0 && score >= old:
+		return false
+	}
+
+	return true
+}
+
+/*
+	Returns the range of scores from min to max.
+*/
+func scoreRange(min, max string) (zrange, error) {
+	minScore, minExcl, err := parseScoreBound(min)
+	if err != nil {
+		return zrange{}, err
+	}
+
+	maxScore, maxExcl, err := parseScoreBound(max)
+	if err != nil {
+		return zrange{}, err
+	}
+
+	return zrange{
+		ge: func(n *skipnode) bool {
+			return n.score > minScore || !minExcl && n.score == minScore
+		},
+		le: func(n *skipnode) bool {
+			return n.score < maxScore || !maxExcl && n.score == maxScore
+		},
+	}, nil
+}
+
+/*
+	Returns the range of members from min to max.
+*/
+func lexRange(min, max string) (zrange, error) {
+	minMember, minExcl, minInf, err := parseLexBound(min)
+	if err != nil {
+		return zrange{}, err
+	}
+
+	maxMember, maxExcl, maxInf, err := parseLexBound(max)
+	if err != nil {
+		return zrange{}, err
+	}
+
+	return zrange{
+		ge: func(n *skipnode) bool {
+			return minInf < 0 || minInf == 0 && (n.member > minMember || !minExcl && n.member == minMember)
+		},
+		le: func(n *skipnode) bool {
+			return maxInf > 0 || maxInf == 0 && (n.member < maxMember || !maxExcl && n.member == maxMember)
+		},
+	}, nil
+}
+
+func parseScoreBound(s string) (float64, bool, error) {
+	excl := strings.HasPrefix(s, "(")
+	if excl {
+		s = s[1:]
+	}
+
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false, fmt.Errorf("score bound %s is not a float", s)
+	}
+
+	return score, excl, nil
+}
+
+/*
+	Returns the member of the lex bound, whether it is excluded and -1 for
+	"-" or 1 for "+".
+*/
+func parseLexBound(s string) (string, bool, int, error) {
+	switch {
+	case s == "-":
+		return "", false, -1, nil
+	case s == "+":
+		return "", false, 1, nil
+	case strings.HasPrefix(s, "["):
+		return s[1:], false, 0, nil
+	case strings.HasPrefix(s, "("):
+		return s[1:], true, 0, nil
+	default:
+		return "", false, 0, fmt.Errorf("lex bound %s must start with ( or [", s)
+	}
+}
+
+/*
+	Returns the count of bytes used by the member of the sorted set.
+*/
+func zsetMemberSize(m string) int {
+	return int(sizeString) + len(m) + 8
+}
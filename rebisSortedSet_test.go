@@ -0,0 +1,310 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestSkiplist(t *testing.T) {
+	z := NewSortedSet()
+	model := map[string]float64{}
+
+	for i := 0; i < 2000; i++ {
+		m := strconv.Itoa(rand.Intn(300))
+		if rand.Intn(3) == 0 {
+			z.remove(m)
+			delete(model, m)
+		} else {
+			score := float64(rand.Intn(50))
+			z.add(m, score)
+			model[m] = score
+		}
+	}
+
+	want := make([]ZMember, 0, len(model))
+	for m, score := range model {
+		want = append(want, ZMember{m, score})
+	}
+	sort.Slice(want, func(i, j int) bool {
+		return want[i].Score < want[j].Score || want[i].Score == want[j].Score && want[i].Member < want[j].Member
+	})
+
+	if members := z.Members(); !reflect.DeepEqual(members, want) {
+		t.Fatalf("members of skiplist are out of order")
+	}
+	for i, m := range want {
+		if rank := z.list.rank(m.Score, m.Member); rank != i {
+			t.Fatalf("rank of %s = %d, want %d", m.Member, rank, i)
+		}
+		if n := z.list.byRank(i); n.member != m.Member {
+			t.Fatalf("member of rank %d = %s, want %s", i, n.member, m.Member)
+		}
+	}
+
+	var back []ZMember
+	for n := z.list.tail; n != nil; n = n.back {
+		back = append([]ZMember{{n.member, n.score}}, back...)
+	}
+	if !reflect.DeepEqual(back, want) {
+		t.Error("back links of skiplist are broken")
+	}
+}
+
+func TestSortedSet(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	n, err := tc.ZAdd("z", 0, ZMember{"a", 1}, ZMember{"b", 2}, ZMember{"c", 3})
+	if err != nil || n != 3 {
+		t.Fatalf("ZAdd = %d, %v", n, err)
+	}
+	if n, _ := tc.ZAdd("z", 0, ZMember{"a", 4}, ZMember{"d", 0}); n != 1 {
+		t.Errorf("ZAdd with update = %d", n)
+	}
+	if score, found, _ := tc.ZScore("z", "a"); !found || score != 4 {
+		t.Errorf("ZScore a = %g, %t", score, found)
+	}
+	if n, _ := tc.ZCard("z"); n != 4 {
+		t.Errorf("ZCard = %d", n)
+	}
+	if rank, found, _ := tc.ZRank("z", "a"); !found || rank != 3 {
+		t.Errorf("ZRank a = %d, %t", rank, found)
+	}
+	if rank, _, _ := tc.ZRevRank("z", "a"); rank != 0 {
+		t.Errorf("ZRevRank a = %d", rank)
+	}
+	if _, found, _ := tc.ZRank("z", "x"); found {
+		t.Error("ZRank of missing member is found")
+	}
+
+	if members, _ := tc.ZRange("z", 1, -2); !reflect.DeepEqual(members, []ZMember{{"b", 2}, {"c", 3}}) {
+		t.Errorf("ZRange = %v", members)
+	}
+	if members, _ := tc.ZRevRange("z", 0, 1); !reflect.DeepEqual(members, []ZMember{{"a", 4}, {"c", 3}}) {
+		t.Errorf("ZRevRange = %v", members)
+	}
+
+	if score, _ := tc.ZIncrBy("z", 2.5, "d"); score != 2.5 {
+		t.Errorf("ZIncrBy = %g", score)
+	}
+	if n, _ := tc.ZRem("z", "d", "x"); n != 1 {
+		t.Errorf("ZRem = %d", n)
+	}
+
+	if members, _ := tc.ZPopMin("z", 2); !reflect.DeepEqual(members, []ZMember{{"b", 2}, {"c", 3}}) {
+		t.Errorf("ZPopMin = %v", members)
+	}
+	if members, _ := tc.ZPopMax("z", 5); !reflect.DeepEqual(members, []ZMember{{"a", 4}}) {
+		t.Errorf("ZPopMax = %v", members)
+	}
+	if _, found := tc.Get("z"); found {
+		t.Error("sorted set without members is not deleted")
+	}
+}
+
+func TestZAddFlags(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.ZAdd("z", 0, ZMember{"a", 5})
+
+	tc.ZAdd("z", ZAddNX, ZMember{"a", 1}, ZMember{"b", 1})
+	tc.ZAdd("z", ZAddXX, ZMember{"b", 2}, ZMember{"c", 1})
+	tc.ZAdd("z", ZAddGT, ZMember{"a", 3}, ZMember{"b", 3})
+	tc.ZAdd("z", ZAddLT|ZAddXX, ZMember{"a", 4})
+	if members, _ := tc.ZRange("z", 0, -1); !reflect.DeepEqual(members, []ZMember{{"b", 3}, {"a", 4}}) {
+		t.Errorf("members after flags = %v", members)
+	}
+
+	if _, err := tc.ZAdd("z", ZAddNX|ZAddGT, ZMember{"a", 1}); err == nil {
+		t.Error("NX and GT are used together")
+	}
+	if _, err := tc.ZAdd("z", ZAddGT|ZAddLT, ZMember{"a", 1}); err == nil {
+		t.Error("GT and LT are used together")
+	}
+
+	if score, changed, _ := tc.ZAddIncr("z", ZAddGT, "a", -1); changed || score != 0 {
+		t.Errorf("ZAddIncr GT with decrement = %g, %t", score, changed)
+	}
+	if score, changed, _ := tc.ZAddIncr("z", ZAddXX, "a", 1); !changed || score != 5 {
+		t.Errorf("ZAddIncr XX = %g, %t", score, changed)
+	}
+	if _, changed, _ := tc.ZAddIncr("z", ZAddXX, "x", 1); changed {
+		t.Error("ZAddIncr XX added missing member")
+	}
+}
+
+func TestZRangeBy(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		tc.ZAdd("z", 0, ZMember{m, float64(i)})
+		tc.ZAdd("lex", 0, ZMember{m, 0})
+	}
+
+	names := func(members []ZMember, err error) []string {
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := []string{}
+		for _, m := range members {
+			s = append(s, m.Member)
+		}
+
+		return s
+	}
+
+	cases := []struct {
+		by   ZRangeBy
+		lex  bool
+		want []string
+	}{
+		{ZRangeBy{Min: "1", Max: "3"}, false, []string{"b", "c", "d"}},
+		{ZRangeBy{Min: "(1", Max: "+inf"}, false, []string{"c", "d", "e"}},
+		{ZRangeBy{Min: "-inf", Max: "(2"}, false, []string{"a", "b"}},
+		{ZRangeBy{Min: "-inf", Max: "+inf", Offset: 1, Count: 2}, false, []string{"b", "c"}},
+		{ZRangeBy{Min: "1", Max: "3", Rev: true}, false, []string{"d", "c", "b"}},
+		{ZRangeBy{Min: "-inf", Max: "+inf", Count: 2, Rev: true}, false, []string{"e", "d"}},
+		{ZRangeBy{Min: "5", Max: "1"}, false, []string{}},
+		{ZRangeBy{Min: "[b", Max: "(d"}, true, []string{"b", "c"}},
+		{ZRangeBy{Min: "-", Max: "[b"}, true, []string{"a", "b"}},
+		{ZRangeBy{Min: "(c", Max: "+", Rev: true}, true, []string{"e", "d"}},
+	}
+	for _, c := range cases {
+		var got []string
+		if c.lex {
+			got = names(tc.ZRangeByLex("lex", c.by))
+		} else {
+			got = names(tc.ZRangeByScore("z", c.by))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("range %+v = %v, want %v", c.by, got, c.want)
+		}
+	}
+
+	if _, err := tc.ZRangeByScore("z", ZRangeBy{Min: "x", Max: "1"}); err == nil {
+		t.Error("bad score bound is accepted")
+	}
+	if _, err := tc.ZRangeByLex("lex", ZRangeBy{Min: "a", Max: "+"}); err == nil {
+		t.Error("bad lex bound is accepted")
+	}
+
+	if n, _ := tc.ZRemRangeByScore("z", "(0", "3"); n != 3 {
+		t.Errorf("ZRemRangeByScore = %d", n)
+	}
+	if got := names(tc.ZRange("z", 0, -1)); !reflect.DeepEqual(got, []string{"a", "e"}) {
+		t.Errorf("members after ZRemRangeByScore = %v", got)
+	}
+}
+
+func TestSortedSetWrongType(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SAdd("s", "a")
+
+	if _, err := tc.ZAdd("s", 0, ZMember{"a", 1}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("ZAdd of set: %v", err)
+	}
+	if _, _, err := tc.ZScore("s", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("ZScore of set: %v", err)
+	}
+}
+
+func TestSortedSetMemory(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 1024
+	tc, _ := NewCache(conf)
+
+	tc.ZAdd("z", 0, ZMember{"a", 1}, ZMember{"bb", 2})
+	tc.ZIncrBy("z", 1, "ccc")
+	tc.ZRem("z", "a")
+	v, _ := tc.Get("z")
+	if used, want := tc.MemoryUsed(), sizeOf("z", v); used != want {
+		t.Errorf("memory of sorted set = %d, want %d", used, want)
+	}
+
+	if _, err := tc.ZAdd("z", 0, ZMember{string(make([]byte, 2048)), 1}); err == nil {
+		t.Error("member larger than the cache is added")
+	}
+
+	tc.ZPopMin("z", 10)
+	if used := tc.MemoryUsed(); used != 0 {
+		t.Errorf("memory of deleted sorted set is not released: %d", used)
+	}
+}
+
+func TestSortedSetClone(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.ZAdd("z", 0, ZMember{"a", 1})
+
+	v, _ := tc.Get("z")
+	v.(*SortedSet).add("b", 2)
+	if n, _ := tc.ZCard("z"); n != 1 {
+		t.Errorf("sorted set is changed through Get: %d members", n)
+	}
+}
+
+func TestSortedSetZeroValue(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	if err := tc.Set("z", &SortedSet{}, DefaultExpiration); err != nil {
+		t.Fatal("Couldn't set zero sorted set:", err)
+	}
+
+	if n, err := tc.ZCard("z"); n != 0 || err != nil {
+		t.Errorf("ZCard of zero sorted set = %d, %v", n, err)
+	}
+	if members, _ := tc.ZRangeByScore("z", ZRangeBy{Min: "-inf", Max: "+inf"}); len(members) != 0 {
+		t.Errorf("ZRangeByScore of zero sorted set = %v", members)
+	}
+	if v, _ := tc.Get("z"); v.(*SortedSet).Len() != 0 {
+		t.Errorf("copy of zero sorted set has %d members", v.(*SortedSet).Len())
+	}
+	if n, _ := tc.ZRem("z", "a"); n != 0 {
+		t.Errorf("ZRem of zero sorted set = %d", n)
+	}
+	if n, err := tc.ZAdd("z", 0, ZMember{"a", 1}); n != 1 || err != nil {
+		t.Errorf("ZAdd to zero sorted set = %d, %v", n, err)
+	}
+	if members, _ := tc.ZRange("z", 0, -1); !reflect.DeepEqual(members, []ZMember{{"a", 1}}) {
+		t.Errorf("zero sorted set after ZAdd = %v", members)
+	}
+}
+
+func TestSortedSetBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.ZAdd("z", 0, ZMember{"a", 1.5}, ZMember{"b", -2}, ZMember{"", 0})
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if members, _ := tr.ZRange("z", 0, -1); !reflect.DeepEqual(members, []ZMember{{"b", -2}, {"", 0}, {"a", 1.5}}) {
+		t.Errorf("sorted set is recovered as %v", members)
+	}
+	if tr.MemoryUsed() != tc.MemoryUsed() {
+		t.Errorf("memory of recovered sorted set = %d, want %d", tr.MemoryUsed(), tc.MemoryUsed())
+	}
+}
+
+func TestSortedSetAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.ZAdd("z", 0, ZMember{"a", 1}, ZMember{"b", 2})
+	tc.ZIncrBy("z", 5, "a")
+	tc.ZPopMax("z", 1)
+	tc.ZAdd("z", ZAddGT, ZMember{"b", 1}, ZMember{"c", math.Inf(1)}, ZMember{"d", 3})
+	tc.ZRemRangeByScore("z", "(2", "3")
+
+	tr := reopenAOF(t, tc, conf)
+	if members, _ := tr.ZRange("z", 0, -1); !reflect.DeepEqual(members, []ZMember{{"b", 2}, {"c", math.Inf(1)}}) {
+		t.Errorf("sorted set is replayed as %v", members)
+	}
+	tr.Close(context.Background())
+}
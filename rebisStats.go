@@ -0,0 +1,174 @@
+package rebis
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+/*
+	CleanupBuckets are upper bounds of the buckets of Stats.Cleanups.
+*/
+var CleanupBuckets = [...]time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+/*
+	Histogram of durations, Buckets[i] is the count of durations not greater
+	than CleanupBuckets[i] and greater than the previous bound. Durations
+	greater than the last bound are counted only in Count.
+*/
+type Histogram struct {
+	Count   uint64
+	Sum     time.Duration
+	Buckets [len(CleanupBuckets)]uint64
+}
+
+/*
+	histogram is updated atomically. The last bucket counts durations greater
+	than the last bound, the count is the total of the buckets, so it is
+	consistent with them in every snapshot.
+*/
+type histogram struct {
+	sum     int64
+	buckets [len(CleanupBuckets) + 1]uint64
+}
+
+/*
+	Stats is a snapshot of the cache counters, they are counted since the cache
+	is created or since the last ResetStats.
+*/
+type Stats struct {
+	Hits           uint64        // reads of existing items
+	Misses         uint64        // reads of missing or expired items
+	Sets           uint64        // items written by Set, Add, Replace and increments
+	Deletes        uint64        // items deleted by Delete
+	Expirations    uint64        // expired items deleted by DeleteExpired
+	Evictions      uint64        // items evicted by the eviction policy
+	Rejected       uint64        // writes rejected because there is no memory
+	Backups        uint64        // saved backups
+	BackupFailures uint64        // backups failed to save
+	BackupDuration time.Duration // duration of the last saved backup
+	LastBackup     time.Time     // time of the last saved backup, zero if there is none
+	Cleanups       Histogram     // durations of DeleteExpired passes
+	Items          int           // items in the cache, including expired ones
+	MemoryUsed     uintptr       // bytes used by items
+	MemoryLimit    uintptr       // maximum bytes for items
+}
+
+/*
+	HitRatio returns the share of reads that found the item, 0 if there are
+	no reads.
+*/
+func (s Stats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+/*
+	Stats returns the current counters of the cache. Counters are updated
+	atomically without locks, so the snapshot is not consistent between them
+	under concurrent operations.
+*/
+func (c *cache) Stats() Stats {
+	st := Stats{
+		Expirations:    atomic.LoadUint64(&c.expirations),
+		Evictions:      atomic.LoadUint64(&c.evictions),
+		Rejected:       atomic.LoadUint64(&c.rejected),
+		Backups:        atomic.LoadUint64(&c.backups),
+		BackupFailures: atomic.LoadUint64(&c.backupFailures),
+		BackupDuration: time.Duration(atomic.LoadInt64(&c.backupDuration)),
+		Cleanups:       c.cleanups.snapshot(),
+		MemoryUsed:     c.MemoryUsed(),
+		MemoryLimit:    c.MemoryLimit(),
+	}
+
+	if last := atomic.LoadInt64(&c.lastBackup); last > 0 {
+		st.LastBackup = time.Unix(0, last)
+	}
+
+	for _, s := range c.shards {
+		st.Hits += atomic.LoadUint64(&s.hits)
+		st.Misses += atomic.LoadUint64(&s.misses)
+		st.Sets += atomic.LoadUint64(&s.sets)
+		st.Deletes += atomic.LoadUint64(&s.deletes)
+
+		s.mu.RLock()
+		st.Items += len(s.items)
+		s.mu.RUnlock()
+	}
+
+	return st
+}
+
+/*
+	ResetStats sets all counters of the cache to zero. Duration and time of
+	the last backup are kept, they are not counters.
+*/
+func (c *cache) ResetStats() {
+	atomic.StoreUint64(&c.expirations, 0)
+	atomic.StoreUint64(&c.evictions, 0)
+	atomic.StoreUint64(&c.rejected, 0)
+	atomic.StoreUint64(&c.backups, 0)
+	atomic.StoreUint64(&c.backupFailures, 0)
+	c.cleanups.reset()
+
+	for _, s := range c.shards {
+		atomic.StoreUint64(&s.hits, 0)
+		atomic.StoreUint64(&s.misses, 0)
+		atomic.StoreUint64(&s.sets, 0)
+		atomic.StoreUint64(&s.deletes, 0)
+	}
+
+	c.logIf("reset stats")
+}
+
+/*
+	Count the duration in its bucket.
+*/
+func (h *histogram) observe(d time.Duration) {
+	i := len(CleanupBuckets)
+	for j, bound := range CleanupBuckets {
+		if d <= bound {
+			i = j
+
+			break
+		}
+	}
+
+	atomic.AddUint64(&h.buckets[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{Sum: time.Duration(atomic.LoadInt64(&h.sum))}
+
+	for i := range h.buckets {
+		n := atomic.LoadUint64(&h.buckets[i])
+		if i < len(s.Buckets) {
+			s.Buckets[i] = n
+		}
+
+		s.Count += n
+	}
+
+	return s
+}
+
+func (h *histogram) reset() {
+	atomic.StoreInt64(&h.sum, 0)
+
+	for i := range h.buckets {
+		atomic.StoreUint64(&h.buckets[i], 0)
+	}
+}
@@ -0,0 +1,164 @@
+package rebis
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 1024
+	tc, _ := NewCache(conf)
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Add("b", "b", time.Millisecond)
+	tc.Replace("a", 2, DefaultExpiration)
+	tc.Increment("a", 1)
+	tc.Add("a", 1, DefaultExpiration) // exists, not counted
+	tc.Get("a")
+	tc.GetWithExpiration("a")
+	tc.Get("missing")
+	tc.Delete("a")
+	tc.Delete("missing")
+	<-time.After(2 * time.Millisecond)
+	tc.Get("b")
+	tc.DeleteExpired()
+	if err := tc.Set("big", make([]byte, 2048), DefaultExpiration); err == nil {
+		t.Error("item larger than the cache is set")
+	}
+	tc.Set("c", make([]byte, 512), DefaultExpiration)
+	tc.Set("d", make([]byte, 512), DefaultExpiration)
+
+	st := tc.Stats()
+	if st.Cleanups.Count != 1 || st.Cleanups.Sum <= 0 {
+		t.Errorf("cleanup is not observed: %+v", st.Cleanups)
+	}
+	want := Stats{
+		Hits:        2,
+		Misses:      2,
+		Sets:        5,
+		Deletes:     1,
+		Expirations: 1,
+		Rejected:    2,
+		Items:       1,
+		MemoryUsed:  tc.MemoryUsed(),
+		MemoryLimit: 1024,
+		Cleanups:    st.Cleanups,
+	}
+	if st != want {
+		t.Errorf("stats are wrong:\n got %+v\nwant %+v", st, want)
+	}
+	if r := st.HitRatio(); r != 0.5 {
+		t.Errorf("hit ratio is not 0.5: %f", r)
+	}
+
+	tc.ResetStats()
+	st = tc.Stats()
+	if st.Hits != 0 || st.Misses != 0 || st.Sets != 0 || st.Deletes != 0 || st.Expirations != 0 || st.Rejected != 0 {
+		t.Errorf("stats are not reset: %+v", st)
+	}
+	if st.Items != 1 {
+		t.Errorf("items are reset: %d", st.Items)
+	}
+	if st.Cleanups != (Histogram{}) {
+		t.Errorf("cleanups are not reset: %+v", st.Cleanups)
+	}
+	if (Stats{}).HitRatio() != 0 {
+		t.Error("hit ratio without reads is not 0")
+	}
+}
+
+func TestStatsEvictions(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 1024
+	conf.EvictionPolicy = EvictAllKeysLRU
+	tc, _ := NewCache(conf)
+
+	for i := 0; i < 10; i++ {
+		tc.Set(key(i), make([]byte, 256), DefaultExpiration)
+	}
+	if st := tc.Stats(); st.Evictions == 0 || st.Evictions != tc.evictions || st.Rejected != 0 {
+		t.Errorf("evictions are not counted: %+v", st)
+	}
+}
+
+func TestStatsBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("a", 1, DefaultExpiration)
+
+	if err := tc.BackupSaveFile(filepath.Join(t.TempDir(), "test.rdb")); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+	tc.BackupSaveFile(filepath.Join(t.TempDir(), "missing", "test.rdb"))
+
+	st := tc.Stats()
+	if st.Backups != 1 || st.BackupFailures != 1 {
+		t.Errorf("backups are not counted: %+v", st)
+	}
+	if st.BackupDuration <= 0 || time.Since(st.LastBackup) > time.Second {
+		t.Errorf("last backup is wrong: %s %s", st.BackupDuration, st.LastBackup)
+	}
+
+	tc.ResetStats()
+	if st := tc.Stats(); st.Backups != 0 || st.LastBackup.IsZero() {
+		t.Errorf("backup stats after reset are wrong: %+v", st)
+	}
+
+	typed, _ := NewTypedCache[string, int](configDefault())
+	typed.Get("a")
+	if st := typed.Stats(); st.Misses != 1 {
+		t.Errorf("typed cache miss is not counted: %+v", st)
+	}
+	typed.Close(context.Background())
+}
+
+func TestHistogram(t *testing.T) {
+	var h histogram
+	for _, d := range []time.Duration{0, 100 * time.Microsecond, 2 * time.Millisecond, time.Minute} {
+		h.observe(d)
+	}
+
+	s := h.snapshot()
+	if s.Count != 4 || s.Sum != time.Minute+2*time.Millisecond+100*time.Microsecond {
+		t.Errorf("count or sum is wrong: %+v", s)
+	}
+	want := [len(CleanupBuckets)]uint64{2, 0, 1}
+	if s.Buckets != want {
+		t.Errorf("buckets are wrong: %v", s.Buckets)
+	}
+}
+
+func TestHistogramConcurrent(t *testing.T) {
+	var h histogram
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10000; i++ {
+			h.observe(time.Duration(i) * time.Millisecond)
+		}
+		close(done)
+	}()
+
+	// the count is never less than observations in buckets
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		s := h.snapshot()
+		var n uint64
+		for _, b := range s.Buckets {
+			n += b
+		}
+		if s.Count < n {
+			t.Fatalf("count %d is less than %d in buckets", s.Count, n)
+		}
+	}
+
+	if s := h.snapshot(); s.Count != 10000 {
+		t.Error("count is wrong:", s.Count)
+	}
+}
@@ -0,0 +1,992 @@
+package rebis
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	StreamEntry is an entry of the stream, its ID is "ms-seq" like in Redis.
+*/
+type StreamEntry struct {
+	ID     string
+	Fields map[string]string
+}
+
+/*
+	XAddArgs are arguments of XAdd. Empty ID or "*" makes the ID from the
+	current time, an explicit ID must be greater than the last ID of the
+	stream. Positive MaxLen trims the oldest entries after the new one is
+	added.
+*/
+type XAddArgs struct {
+	ID     string
+	Fields map[string]string
+	MaxLen int
+}
+
+/*
+	XReadArgs are arguments of XRead and XReadGroup. Streams map keys to
+	IDs to read entries after, "$" is the last ID of the stream for XRead,
+	">" is entries never delivered to the group for XReadGroup. Positive
+	Count limits the count of entries of every stream. With Block reading
+	waits for entries until ctx is done.
+*/
+type XReadArgs struct {
+	Streams map[string]string
+	Count   int
+	Block   bool
+}
+
+/*
+	XPendingArgs select pending entries of the group by range of IDs like
+	XRange, empty bounds are "-" and "+". Positive Count limits the count of
+	entries, Consumer selects entries of one consumer, MinIdle selects
+	entries not delivered for at least that time.
+*/
+type XPendingArgs struct {
+	Start, End string
+	Count      int
+	Consumer   string
+	MinIdle    time.Duration
+}
+
+/*
+	PendingEntry is an entry delivered to the consumer of the group and not
+	acknowledged yet.
+*/
+type PendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int
+}
+
+/*
+	Stream is a value of the stream data type, append-only log of entries
+	with consumer groups. Get returns a copy of the stream, it is changed
+	only by X methods.
+*/
+type Stream struct {
+	entries []streamEntry
+	last    streamID
+	groups  map[string]*streamGroup
+}
+
+type streamID struct {
+	ms, seq uint64
+}
+
+type streamEntry struct {
+	id     streamID
+	fields map[string]string
+}
+
+type streamGroup struct {
+	last    streamID // the last entry delivered to the group
+	pending map[streamID]*pendingEntry
+}
+
+type pendingEntry struct {
+	consumer  string
+	delivered int64 // unix nano of the last delivery
+	count     int
+}
+
+var maxStreamID = streamID{math.MaxUint64, math.MaxUint64}
+
+/*
+	Len returns the count of entries of the stream.
+*/
+func (st *Stream) Len() int {
+	if st == nil {
+		return 0
+	}
+
+	return len(st.entries)
+}
+
+/*
+	Entries returns entries of the stream from the oldest.
+*/
+func (st *Stream) Entries() []StreamEntry {
+	entries := make([]StreamEntry, st.Len())
+	for i := range entries {
+		entries[i] = st.entries[i].public()
+	}
+
+	return entries
+}
+
+/*
+	Size of the stream is the size of its entries, groups and pending
+	entries of groups.
+*/
+func (st *Stream) Size() uintptr {
+	var n int
+	if st == nil {
+		return 0
+	}
+
+	for _, e := range st.entries {
+		n += streamEntrySize(e.fields)
+	}
+
+	for name, g := range st.groups {
+		n += streamGroupSize(name)
+		for _, p := range g.pending {
+			n += pendingSize(p.consumer)
+		}
+	}
+
+	return uintptr(n)
+}
+
+/*
+	The stream with groups is kept without entries like in Redis.
+*/
+func (st *Stream) length() int {
+	if st == nil {
+		return 0
+	}
+
+	return len(st.entries) + len(st.groups)
+}
+
+func (st *Stream) clone() interface{} {
+	c := &Stream{entries: make([]streamEntry, len(st.entries)), last: st.last}
+	for i, e := range st.entries {
+		c.entries[i] = streamEntry{e.id, Hash(e.fields).clone().(Hash)}
+	}
+
+	for name, g := range st.groups {
+		cg := c.group(name, g.last)
+		for id, p := range g.pending {
+			v := *p
+			cg.pending[id] = &v
+		}
+	}
+
+	return c
+}
+
+/*
+	Add the group, returns the existing one if it is found.
+*/
+func (st *Stream) group(name string, last streamID) *streamGroup {
+	if st.groups == nil {
+		st.groups = make(map[string]*streamGroup)
+	}
+
+	g, found := st.groups[name]
+	if !found {
+		g = &streamGroup{last: last, pending: make(map[streamID]*pendingEntry)}
+		st.groups[name] = g
+	}
+
+	return g
+}
+
+/*
+	Returns the index of the first entry with ID not less than id.
+*/
+func (st *Stream) search(id streamID) int {
+	return sort.Search(len(st.entries), func(i int) bool {
+		return !st.entries[i].id.less(id)
+	})
+}
+
+/*
+	Returns entries from start to end inclusive, at most count if it is
+	positive, from the newest with rev.
+*/
+func (st *Stream) rangeOf(start, end streamID, count int, rev bool) []StreamEntry {
+	entries := []StreamEntry{}
+	if st.Len() == 0 || end.less(start) {
+		return entries
+	}
+
+	from, to := st.search(start), st.search(end.next())
+	if end == maxStreamID {
+		to = len(st.entries)
+	}
+
+	for i := from; i < to && (count <= 0 || len(entries) < count); i++ {
+		j := i
+		if rev {
+			j = to - 1 - (i - from)
+		}
+
+		entries = append(entries, st.entries[j].public())
+	}
+
+	return entries
+}
+
+/*
+	Returns the entry of the ID and a bool indicating whether it is found.
+*/
+func (st *Stream) entry(id streamID) (streamEntry, bool) {
+	i := st.search(id)
+	if i < len(st.entries) && st.entries[i].id == id {
+		return st.entries[i], true
+	}
+
+	return streamEntry{}, false
+}
+
+func (e streamEntry) public() StreamEntry {
+	return StreamEntry{ID: e.id.String(), Fields: Hash(e.fields).clone().(Hash)}
+}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamID) less(o streamID) bool {
+	return id.ms < o.ms || id.ms == o.ms && id.seq < o.seq
+}
+
+/*
+	Returns the next ID, maxStreamID has no next one and is returned as is.
+*/
+func (id streamID) next() streamID {
+	switch {
+	case id.seq < math.MaxUint64:
+		return streamID{id.ms, id.seq + 1}
+	case id.ms < math.MaxUint64:
+		return streamID{id.ms + 1, 0}
+	default:
+		return id
+	}
+}
+
+func (id streamID) prev() streamID {
+	switch {
+	case id.seq > 0:
+		return streamID{id.ms, id.seq - 1}
+	case id.ms > 0:
+		return streamID{id.ms - 1, math.MaxUint64}
+	default:
+		return id
+	}
+}
+
+/*
+	XAdd appends the entry to the stream and returns its ID. The stream is
+	created with the default expiration if the key is not found.
+*/
+func (c *cache) XAdd(k string, args XAddArgs) (string, error) {
+	if len(args.Fields) == 0 {
+		return "", fmt.Errorf("entry of %s has no fields", k)
+	}
+
+	var explicit *streamID
+
+	if args.ID != "" && args.ID != "*" {
+		id, err := parseStreamID(args.ID, false)
+		if err != nil {
+			return "", err
+		}
+
+		explicit = &id
+	}
+
+	var id streamID
+
+	change := &Change{Op: "XAdd", Args: make([]string, 2, 2+2*len(args.Fields))}
+	change.Args[1] = strconv.Itoa(args.MaxLen)
+
+	for f, v := range args.Fields {
+		change.Args = append(change.Args, f, v)
+	}
+
+	err := changeValue(c, k, change, func(st *Stream, grow func(n int) bool) (*Stream, error) {
+		var last streamID
+		if st != nil {
+			last = st.last
+		}
+
+		if explicit != nil {
+			id = *explicit
+			if !last.less(id) {
+				return st, fmt.Errorf("ID %s is equal or smaller than the last ID %s of %s", id, last, k)
+			}
+		} else {
+			id = streamID{ms: uint64(time.Now().UnixNano() / int64(time.Millisecond))}
+			if !last.less(id) {
+				if id = last.next(); id == last {
+					return st, fmt.Errorf("stream %s has the maximum ID", k)
+				}
+			}
+		}
+
+		change.Args[0] = id.String()
+
+		n, trim := streamEntrySize(args.Fields), 0
+		if args.MaxLen > 0 && st.Len()+1 > args.MaxLen {
+			trim = st.Len() + 1 - args.MaxLen
+			for _, e := range st.entries[:trim] {
+				n -= streamEntrySize(e.fields)
+			}
+		}
+
+		if !grow(n) {
+			return st, errNoSlot
+		}
+
+		if st == nil {
+			st = &Stream{}
+		}
+
+		st.entries = append(st.entries[trim:], streamEntry{id, Hash(args.Fields).clone().(Hash)})
+		st.last = id
+
+		return st, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.logIf("xadd %s %s %v", k, id, args.Fields)
+
+	return id.String(), nil
+}
+
+/*
+	XLen returns the count of entries of the stream.
+*/
+func (c *cache) XLen(k string) (int, error) {
+	var n int
+
+	err := readValue(c, k, func(st *Stream) {
+		n = st.Len()
+	})
+
+	return n, err
+}
+
+/*
+	XRange returns entries with IDs from start to end inclusive, at most
+	count if it is positive. IDs are "ms-seq" or "ms", "-" and "+" are the
+	minimum and the maximum IDs, an ID after "(" is excluded.
+*/
+func (c *cache) XRange(k, start, end string, count int) ([]StreamEntry, error) {
+	return c.xrange(k, start, end, count, false)
+}
+
+/*
+	XRevRange returns entries like XRange from the newest, end goes first
+	like in Redis.
+*/
+func (c *cache) XRevRange(k, end, start string, count int) ([]StreamEntry, error) {
+	return c.xrange(k, start, end, count, true)
+}
+
+/*
+	XRead returns entries of the streams after the IDs. Streams without new
+	entries are not in the map. With Block it waits until one of the streams
+	gets entries or ctx is done and returns ctx error then.
+*/
+func (c *cache) XRead(ctx context.Context, args XReadArgs) (map[string][]StreamEntry, error) {
+	keys, after, err := c.xreadIDs(args.Streams)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]StreamEntry)
+
+	try := func() (bool, error) {
+		for _, k := range keys {
+			if after[k] == maxStreamID {
+				continue
+			}
+
+			err := readValue(c, k, func(st *Stream) {
+				if entries := st.rangeOf(after[k].next(), maxStreamID, args.Count, false); len(entries) > 0 {
+					result[k] = entries
+				}
+			})
+			if err != nil {
+				return false, err
+			}
+		}
+
+		return len(result) > 0, nil
+	}
+
+	if !args.Block {
+		_, err = try()
+	} else {
+		err = c.block(ctx, keys, try)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+	XGroupCreate creates the group of the stream which delivers entries
+	after the ID, "$" is the last ID of the stream. With mkStream the empty
+	stream is created if the key is not found.
+*/
+func (c *cache) XGroupCreate(k, group, id string, mkStream bool) error {
+	change := &Change{Op: "XGroupCreate", Args: []string{group, id, strconv.FormatBool(mkStream)}}
+
+	err := changeValue(c, k, change, func(st *Stream, grow func(n int) bool) (*Stream, error) {
+		if st == nil && !mkStream {
+			return st, fmt.Errorf("stream %s not found", k)
+		}
+
+		if _, found := st.groupOf(group); found {
+			return st, fmt.Errorf("group %s of %s already exists", group, k)
+		}
+
+		last, err := streamIDOf(st, id)
+		if err != nil {
+			return st, err
+		}
+
+		change.Args[1] = last.String()
+
+		if !grow(streamGroupSize(group)) {
+			return st, errNoSlot
+		}
+
+		if st == nil {
+			st = &Stream{}
+		}
+
+		st.group(group, last)
+
+		return st, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.logIf("xgroup create %s %s %s", k, group, id)
+
+	return nil
+}
+
+/*
+	XReadGroup reads entries of the streams for the consumer of the group.
+	With ">" it returns entries never delivered to the group and adds them
+	to pending entries of the consumer, with other IDs it returns pending
+	entries of the consumer after the ID again, entries deleted from the
+	stream have nil fields. Only reading of new entries waits with Block.
+*/
+func (c *cache) XReadGroup(ctx context.Context, group, consumer string, args XReadArgs) (map[string][]StreamEntry, error) {
+	keys := make([]string, 0, len(args.Streams))
+	block := args.Block
+
+	for k, id := range args.Streams {
+		if id != ">" {
+			if _, err := parseStreamID(id, false); err != nil {
+				return nil, err
+			}
+
+			block = false
+		}
+
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	result := make(map[string][]StreamEntry)
+
+	try := func() (bool, error) {
+		for _, k := range keys {
+			entries, err := c.xreadGroup(k, group, consumer, time.Now().UnixNano(), args.Streams[k], args.Count)
+			if err != nil {
+				return false, err
+			}
+
+			if len(entries) > 0 {
+				result[k] = entries
+			}
+		}
+
+		return len(result) > 0, nil
+	}
+
+	var err error
+
+	if !block {
+		_, err = try()
+	} else {
+		err = c.block(ctx, keys, try)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+	XAck removes the entries from pending entries of the group and returns
+	the count of removed entries.
+*/
+func (c *cache) XAck(k, group string, ids ...string) (int, error) {
+	parsed := make([]streamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseStreamID(id, false); err != nil {
+			return 0, err
+		}
+	}
+
+	var acked int
+
+	change := &Change{Op: "XAck", Args: append([]string{group}, ids...)}
+
+	err := changeValue(c, k, change, func(st *Stream, grow func(n int) bool) (*Stream, error) {
+		g, found := st.groupOf(group)
+		if !found {
+			return st, nil
+		}
+
+		var n int
+		for _, id := range parsed {
+			if p, found := g.pending[id]; found {
+				n -= pendingSize(p.consumer)
+				delete(g.pending, id)
+				acked++
+			}
+		}
+
+		if acked > 0 {
+			grow(n)
+		}
+
+		return st, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	c.logIf("xack %s %s %v, acknowledged %d entries", k, group, ids, acked)
+
+	return acked, nil
+}
+
+/*
+	XPending returns pending entries of the group ordered by ID.
+*/
+func (c *cache) XPending(k, group string, args XPendingArgs) ([]PendingEntry, error) {
+	start, end, err := parseStreamRange(args.Start, args.End)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		entries = []PendingEntry{}
+		now     = time.Now().UnixNano()
+		noGroup bool
+	)
+
+	err = readValue(c, k, func(st *Stream) {
+		g, found := st.groupOf(group)
+		if !found {
+			noGroup = true
+
+			return
+		}
+
+		for _, id := range g.pendingIDs() {
+			p := g.pending[id]
+			idle := time.Duration(now - p.delivered)
+
+			switch {
+			case id.less(start) || end.less(id):
+				continue
+			case args.Consumer != "" && p.consumer != args.Consumer:
+				continue
+			case idle < args.MinIdle:
+				continue
+			case args.Count > 0 && len(entries) == args.Count:
+				return
+			}
+
+			entries = append(entries, PendingEntry{id.String(), p.consumer, idle, p.count})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if noGroup {
+		return nil, fmt.Errorf("group %s of %s not found", group, k)
+	}
+
+	return entries, nil
+}
+
+/*
+	XClaim gives pending entries of the group which are not delivered for
+	at least minIdle to the consumer and returns them. Entries deleted from
+	the stream are removed from pending entries and not returned.
+*/
+func (c *cache) XClaim(k, group, consumer string, minIdle time.Duration, ids ...string) ([]StreamEntry, error) {
+	return c.xclaim(k, group, consumer, time.Now().UnixNano(), minIdle, ids)
+}
+
+/*
+	Claim the entries at the time now, see XClaim.
+*/
+func (c *cache) xclaim(k, group, consumer string, now int64, minIdle time.Duration, ids []string) ([]StreamEntry, error) {
+	parsed := make([]streamID, len(ids))
+	for i, id := range ids {
+		var err error
+		if parsed[i], err = parseStreamID(id, false); err != nil {
+			return nil, err
+		}
+	}
+
+	claimed := []StreamEntry{}
+
+	change := &Change{Op: "XClaim", Args: make([]string, 0, 4+len(ids))}
+	change.Args = append(change.Args, group, consumer, formatInt(now), formatInt(int64(minIdle)))
+	change.Args = append(change.Args, ids...)
+
+	err := changeValue(c, k, change, func(st *Stream, grow func(n int) bool) (*Stream, error) {
+		g, found := st.groupOf(group)
+		if !found {
+			return st, fmt.Errorf("group %s of %s not found", group, k)
+		}
+
+		var (
+			n       int
+			claims  []streamID
+			deleted []streamID
+		)
+
+		for _, id := range parsed {
+			p, found := g.pending[id]
+			if !found || time.Duration(now-p.delivered) < minIdle {
+				continue
+			}
+
+			if _, found := st.entry(id); !found {
+				n -= pendingSize(p.consumer)
+				deleted = append(deleted, id)
+
+				continue
+			}
+
+			n += len(consumer) - len(p.consumer)
+			claims = append(claims, id)
+		}
+
+		if len(claims) == 0 && len(deleted) == 0 {
+			return st, nil
+		}
+
+		if !grow(n) {
+			return st, errNoSlot
+		}
+
+		for _, id := range deleted {
+			delete(g.pending, id)
+		}
+
+		for _, id := range claims {
+			p := g.pending[id]
+			p.consumer, p.delivered = consumer, now
+			p.count++
+
+			e, _ := st.entry(id)
+			claimed = append(claimed, e.public())
+		}
+
+		return st, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.logIf("xclaim %s %s %s %v, claimed %d entries", k, group, consumer, ids, len(claimed))
+
+	return claimed, nil
+}
+
+func (c *cache) xrange(k, start, end string, count int, rev bool) ([]StreamEntry, error) {
+	from, to, err := parseStreamRange(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []StreamEntry{}
+
+	err = readValue(c, k, func(st *Stream) {
+		entries = st.rangeOf(from, to, count, rev)
+	})
+
+	return entries, err
+}
+
+/*
+	Returns sorted keys of the streams and IDs to read after, "$" is
+	resolved to the last ID of the stream once.
+*/
+func (c *cache) xreadIDs(streams map[string]string) ([]string, map[string]streamID, error) {
+	keys := make([]string, 0, len(streams))
+	after := make(map[string]streamID, len(streams))
+
+	for k, id := range streams {
+		keys = append(keys, k)
+
+		if id == "$" {
+			var last streamID
+			if err := readValue(c, k, func(st *Stream) { last = st.last }); err != nil {
+				return nil, nil, err
+			}
+
+			after[k] = last
+
+			continue
+		}
+
+		parsed, err := parseStreamID(id, false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		after[k] = parsed
+	}
+
+	sort.Strings(keys)
+
+	return keys, after, nil
+}
+
+/*
+	Read entries of one stream for the consumer of the group at the time
+	now, see XReadGroup.
+*/
+func (c *cache) xreadGroup(k, group, consumer string, now int64, id string, count int) ([]StreamEntry, error) {
+	var entries []StreamEntry
+
+	change := &Change{Op: "XReadGroup", Args: []string{group, consumer, formatInt(now), id, strconv.Itoa(count)}}
+
+	err := changeValue(c, k, change, func(st *Stream, grow func(n int) bool) (*Stream, error) {
+		g, found := st.groupOf(group)
+		if !found {
+			return st, fmt.Errorf("group %s of %s not found", group, k)
+		}
+
+		if id != ">" {
+			after, _ := parseStreamID(id, false)
+
+			for _, pid := range g.pendingIDs() {
+				p := g.pending[pid]
+				if !after.less(pid) || p.consumer != consumer {
+					continue
+				}
+
+				if count > 0 && len(entries) == count {
+					break
+				}
+
+				p.delivered = now
+				p.count++
+
+				e, found := st.entry(pid)
+				if !found {
+					e = streamEntry{id: pid}
+				}
+
+				entry := e.public()
+				if !found {
+					entry.Fields = nil
+				}
+
+				entries = append(entries, entry)
+			}
+
+			if len(entries) > 0 {
+				grow(0)
+			}
+
+			return st, nil
+		}
+
+		if g.last == maxStreamID {
+			return st, nil
+		}
+
+		entries = st.rangeOf(g.last.next(), maxStreamID, count, false)
+		if len(entries) == 0 {
+			return st, nil
+		}
+
+		if !grow(len(entries) * pendingSize(consumer)) {
+			entries = nil
+
+			return st, errNoSlot
+		}
+
+		for _, e := range entries {
+			pid, _ := parseStreamID(e.ID, false)
+			g.pending[pid] = &pendingEntry{consumer: consumer, delivered: now, count: 1}
+			g.last = pid
+		}
+
+		return st, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) > 0 {
+		c.logIf("xreadgroup %s %s %s -> %d entries", k, group, consumer, len(entries))
+	}
+
+	return entries, nil
+}
+
+func (st *Stream) groupOf(name string) (*streamGroup, bool) {
+	if st == nil {
+		return nil, false
+	}
+
+	g, found := st.groups[name]
+
+	return g, found
+}
+
+func (g *streamGroup) pendingIDs() []streamID {
+	ids := make([]streamID, 0, len(g.pending))
+	for id := range g.pending {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].less(ids[j])
+	})
+
+	return ids
+}
+
+/*
+	Returns the ID for the group, "$" is the last ID of the stream.
+*/
+func streamIDOf(st *Stream, id string) (streamID, error) {
+	if id == "$" {
+		if st == nil {
+			return streamID{}, nil
+		}
+
+		return st.last, nil
+	}
+
+	return parseStreamID(id, false)
+}
+
+/*
+	Parse the ID "ms-seq" or "ms", the sequence of "ms" is the minimum or
+	the maximum with end. "-" and "+" are the minimum and the maximum IDs.
+*/
+func parseStreamID(s string, end bool) (streamID, error) {
+	switch s {
+	case "-":
+		return streamID{}, nil
+	case "+":
+		return maxStreamID, nil
+	}
+
+	ms, seq, hasSeq := strings.Cut(s, "-")
+
+	var (
+		id  streamID
+		err error
+	)
+
+	if id.ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return id, fmt.Errorf("invalid stream ID %s", s)
+	}
+
+	switch {
+	case hasSeq:
+		if id.seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return id, fmt.Errorf("invalid stream ID %s", s)
+		}
+	case end:
+		id.seq = math.MaxUint64
+	}
+
+	return id, nil
+}
+
+/*
+	Parse bounds of the range of IDs, a bound after "(" is excluded.
+*/
+func parseStreamRange(start, end string) (streamID, streamID, error) {
+	if start == "" {
+		start = "-"
+	}
+
+	if end == "" {
+		end = "+"
+	}
+
+	from, err := parseStreamID(strings.TrimPrefix(start, "("), false)
+	if err != nil {
+		return from, from, err
+	}
+
+	to, err := parseStreamID(strings.TrimPrefix(end, "("), true)
+	if err != nil {
+		return from, to, err
+	}
+
+	if strings.HasPrefix(start, "(") {
+		if from == maxStreamID {
+			return maxStreamID, streamID{}, nil
+		}
+
+		from = from.next()
+	}
+
+	if strings.HasPrefix(end, "(") {
+		if to == (streamID{}) {
+			return maxStreamID, streamID{}, nil
+		}
+
+		to = to.prev()
+	}
+
+	return from, to, nil
+}
+
+/*
+	Returns the count of bytes used by the entry of the stream.
+*/
+func streamEntrySize(fields map[string]string) int {
+	n := 16
+	for f, v := range fields {
+		n += hashFieldSize(f, v)
+	}
+
+	return n
+}
+
+func streamGroupSize(name string) int {
+	return int(sizeString) + len(name) + 16
+}
+
+func pendingSize(consumer string) int {
+	return int(sizeString) + len(consumer) + 32
+}
@@ -0,0 +1,338 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func entryIDs(entries []StreamEntry, err error) []string {
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+
+	return ids
+}
+
+func TestStream(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	for _, id := range []string{"1-1", "1-2", "2-0", "3-5"} {
+		if _, err := tc.XAdd("s", XAddArgs{ID: id, Fields: map[string]string{"id": id}}); err != nil {
+			t.Fatalf("XAdd %s: %v", id, err)
+		}
+	}
+	if _, err := tc.XAdd("s", XAddArgs{ID: "3-5", Fields: map[string]string{"a": "1"}}); err == nil {
+		t.Error("XAdd with the last ID is accepted")
+	}
+	if _, err := tc.XAdd("s", XAddArgs{Fields: nil}); err == nil {
+		t.Error("XAdd without fields is accepted")
+	}
+	if n, _ := tc.XLen("s"); n != 4 {
+		t.Errorf("XLen = %d", n)
+	}
+
+	cases := []struct {
+		start, end string
+		count      int
+		rev        bool
+		want       []string
+	}{
+		{"-", "+", 0, false, []string{"1-1", "1-2", "2-0", "3-5"}},
+		{"1", "2", 0, false, []string{"1-1", "1-2", "2-0"}},
+		{"(1-1", "(3-5", 0, false, []string{"1-2", "2-0"}},
+		{"-", "+", 2, false, []string{"1-1", "1-2"}},
+		{"-", "+", 2, true, []string{"3-5", "2-0"}},
+		{"3", "1", 0, false, []string{}},
+	}
+	for _, c := range cases {
+		var ids []string
+		if c.rev {
+			ids = entryIDs(tc.XRevRange("s", c.end, c.start, c.count))
+		} else {
+			ids = entryIDs(tc.XRange("s", c.start, c.end, c.count))
+		}
+		if !reflect.DeepEqual(ids, c.want) {
+			t.Errorf("range %s %s %d %t = %v, want %v", c.start, c.end, c.count, c.rev, ids, c.want)
+		}
+	}
+
+	entries, _ := tc.XRange("s", "2-0", "2-0", 0)
+	entries[0].Fields["id"] = "changed"
+	if entries, _ := tc.XRange("s", "2-0", "2-0", 0); entries[0].Fields["id"] != "2-0" {
+		t.Error("entry is changed through XRange")
+	}
+}
+
+func TestStreamAutoID(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.XAdd("s", XAddArgs{ID: "99999999999999-0", Fields: map[string]string{"a": "1"}})
+
+	id, err := tc.XAdd("s", XAddArgs{Fields: map[string]string{"a": "2"}})
+	if err != nil || id != "99999999999999-1" {
+		t.Errorf("auto ID after ID from the future = %s, %v", id, err)
+	}
+
+	tc.XAdd("t", XAddArgs{Fields: map[string]string{"a": "1"}})
+	first, _ := tc.XRange("t", "-", "+", 0)
+	for i := 0; i < 10; i++ {
+		tc.XAdd("t", XAddArgs{ID: "*", Fields: map[string]string{"a": "1"}, MaxLen: 3})
+	}
+	ids := entryIDs(tc.XRange("t", "-", "+", 0))
+	if len(ids) != 3 || ids[0] == first[0].ID {
+		t.Errorf("stream is not trimmed to MaxLen: %v", ids)
+	}
+	for i := 1; i < len(ids); i++ {
+		a, _ := parseStreamID(ids[i-1], false)
+		b, _ := parseStreamID(ids[i], false)
+		if !a.less(b) {
+			t.Errorf("auto IDs are not increasing: %v", ids)
+		}
+	}
+}
+
+func TestXRead(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.XAdd("a", XAddArgs{ID: "1-0", Fields: map[string]string{"a": "1"}})
+	tc.XAdd("a", XAddArgs{ID: "2-0", Fields: map[string]string{"a": "2"}})
+
+	result, err := tc.XRead(context.Background(), XReadArgs{Streams: map[string]string{"a": "1-0", "b": "0"}})
+	if err != nil || len(result) != 1 || !reflect.DeepEqual(entryIDs(result["a"], nil), []string{"2-0"}) {
+		t.Errorf("XRead = %v, %v", result, err)
+	}
+	if result, _ := tc.XRead(context.Background(), XReadArgs{Streams: map[string]string{"a": "$"}}); len(result) != 0 {
+		t.Errorf("XRead after the last ID = %v", result)
+	}
+
+	go func() {
+		<-time.After(20 * time.Millisecond)
+		tc.XAdd("b", XAddArgs{ID: "5-0", Fields: map[string]string{"b": "1"}})
+	}()
+	result, err = tc.XRead(context.Background(), XReadArgs{Streams: map[string]string{"a": "$", "b": "$"}, Block: true})
+	if err != nil || !reflect.DeepEqual(entryIDs(result["b"], nil), []string{"5-0"}) || len(result) != 1 {
+		t.Errorf("blocked XRead = %v, %v", result, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := tc.XRead(ctx, XReadArgs{Streams: map[string]string{"a": "$"}, Block: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("blocked XRead is not cancelled: %v", err)
+	}
+}
+
+func TestStreamGroup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	if err := tc.XGroupCreate("s", "g", "$", false); err == nil {
+		t.Error("group of missing stream is created")
+	}
+	if err := tc.XGroupCreate("s", "g", "$", true); err != nil {
+		t.Fatal("Couldn't create group with stream:", err)
+	}
+	if err := tc.XGroupCreate("s", "g", "$", true); err == nil {
+		t.Error("existing group is created again")
+	}
+	if _, found := tc.Get("s"); !found {
+		t.Error("empty stream with group is deleted")
+	}
+
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		tc.XAdd("s", XAddArgs{ID: id, Fields: map[string]string{"id": id}})
+	}
+
+	read := func(consumer, id string, count int) []string {
+		result, err := tc.XReadGroup(context.Background(), "g", consumer, XReadArgs{Streams: map[string]string{"s": id}, Count: count})
+		if err != nil {
+			t.Fatal("Couldn't read group:", err)
+		}
+
+		return entryIDs(result["s"], nil)
+	}
+
+	if ids := read("alice", ">", 2); !reflect.DeepEqual(ids, []string{"1-0", "2-0"}) {
+		t.Errorf("alice got %v", ids)
+	}
+	if ids := read("bob", ">", 0); !reflect.DeepEqual(ids, []string{"3-0"}) {
+		t.Errorf("bob got %v", ids)
+	}
+	if ids := read("bob", ">", 0); len(ids) != 0 {
+		t.Errorf("bob got delivered entries again: %v", ids)
+	}
+	if ids := read("alice", "0", 0); !reflect.DeepEqual(ids, []string{"1-0", "2-0"}) {
+		t.Errorf("history of alice = %v", ids)
+	}
+
+	if n, _ := tc.XAck("s", "g", "1-0", "9-0"); n != 1 {
+		t.Errorf("XAck = %d", n)
+	}
+
+	pending, err := tc.XPending("s", "g", XPendingArgs{})
+	if err != nil || len(pending) != 2 {
+		t.Fatalf("XPending = %v, %v", pending, err)
+	}
+	if p := pending[0]; p.ID != "2-0" || p.Consumer != "alice" || p.Deliveries != 2 {
+		t.Errorf("pending entry of alice = %+v", p)
+	}
+	if pending, _ := tc.XPending("s", "g", XPendingArgs{Consumer: "bob"}); len(pending) != 1 || pending[0].ID != "3-0" {
+		t.Errorf("pending entries of bob = %v", pending)
+	}
+	if pending, _ := tc.XPending("s", "g", XPendingArgs{MinIdle: time.Hour}); len(pending) != 0 {
+		t.Errorf("pending entries idle for an hour = %v", pending)
+	}
+	if _, err := tc.XPending("s", "missing", XPendingArgs{}); err == nil {
+		t.Error("XPending of missing group returns no error")
+	}
+	if _, err := tc.XReadGroup(context.Background(), "missing", "c", XReadArgs{Streams: map[string]string{"s": ">"}}); err == nil {
+		t.Error("XReadGroup of missing group returns no error")
+	}
+}
+
+func TestXClaim(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.XGroupCreate("s", "g", "0", true)
+	tc.XAdd("s", XAddArgs{ID: "1-0", Fields: map[string]string{"a": "1"}})
+	tc.XAdd("s", XAddArgs{ID: "2-0", Fields: map[string]string{"a": "2"}})
+	tc.XReadGroup(context.Background(), "g", "alice", XReadArgs{Streams: map[string]string{"s": ">"}})
+
+	if claimed, _ := tc.XClaim("s", "g", "bob", time.Hour, "1-0"); len(claimed) != 0 {
+		t.Errorf("entry idle for less than minIdle is claimed: %v", claimed)
+	}
+
+	<-time.After(10 * time.Millisecond)
+	tc.XAdd("s", XAddArgs{ID: "3-0", Fields: map[string]string{"a": "3"}, MaxLen: 2})
+	claimed, err := tc.XClaim("s", "g", "bob", 5*time.Millisecond, "1-0", "2-0")
+	if err != nil || !reflect.DeepEqual(entryIDs(claimed, nil), []string{"2-0"}) {
+		t.Errorf("XClaim = %v, %v", claimed, err)
+	}
+
+	pending, _ := tc.XPending("s", "g", XPendingArgs{})
+	if len(pending) != 1 || pending[0].Consumer != "bob" || pending[0].Deliveries != 2 {
+		t.Errorf("pending entries after XClaim = %+v", pending)
+	}
+}
+
+func TestXReadGroupBlock(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.XGroupCreate("s", "g", "$", true)
+
+	got := make(chan []StreamEntry)
+	for _, consumer := range []string{"a", "b"} {
+		go func(consumer string) {
+			result, _ := tc.XReadGroup(context.Background(), "g", consumer, XReadArgs{Streams: map[string]string{"s": ">"}, Count: 1, Block: true})
+			got <- result["s"]
+		}(consumer)
+	}
+
+	<-time.After(10 * time.Millisecond)
+	tc.XAdd("s", XAddArgs{ID: "1-0", Fields: map[string]string{"a": "1"}})
+	tc.XAdd("s", XAddArgs{ID: "2-0", Fields: map[string]string{"a": "2"}})
+
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		for _, e := range <-got {
+			ids[e.ID] = true
+		}
+	}
+	if !ids["1-0"] || !ids["2-0"] {
+		t.Errorf("consumers got %v", ids)
+	}
+}
+
+func TestStreamWrongType(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.RPush("l", "a")
+
+	if _, err := tc.XAdd("l", XAddArgs{Fields: map[string]string{"a": "1"}}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("XAdd of list: %v", err)
+	}
+	if _, err := tc.XRead(context.Background(), XReadArgs{Streams: map[string]string{"l": "0"}}); !errors.Is(err, ErrWrongType) {
+		t.Errorf("XRead of list: %v", err)
+	}
+}
+
+func TestStreamMemory(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 4096
+	tc, _ := NewCache(conf)
+
+	tc.XGroupCreate("s", "g", "0", true)
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		tc.XAdd("s", XAddArgs{ID: id, Fields: map[string]string{"field": id}, MaxLen: 2})
+	}
+	tc.XReadGroup(context.Background(), "g", "alice", XReadArgs{Streams: map[string]string{"s": ">"}})
+	tc.XClaim("s", "g", "bob", 0, "2-0")
+	tc.XAck("s", "g", "3-0")
+
+	v, _ := tc.Get("s")
+	if used, want := tc.MemoryUsed(), sizeOf("s", v); used != want {
+		t.Errorf("memory of stream = %d, want %d", used, want)
+	}
+
+	if _, err := tc.XAdd("s", XAddArgs{Fields: map[string]string{"big": string(make([]byte, 8192))}}); err == nil {
+		t.Error("entry larger than the cache is added")
+	}
+	if used, want := tc.MemoryUsed(), sizeOf("s", v); used != want {
+		t.Errorf("memory is changed by rejected XAdd: %d, want %d", used, want)
+	}
+}
+
+func TestStreamBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.XAdd("s", XAddArgs{ID: "1-0", Fields: map[string]string{"a": "1", "b": ""}})
+	tc.XAdd("s", XAddArgs{ID: "2-3", Fields: map[string]string{"a": "2"}})
+	tc.XGroupCreate("s", "g", "0", false)
+	tc.XReadGroup(context.Background(), "g", "alice", XReadArgs{Streams: map[string]string{"s": ">"}, Count: 1})
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if tr.MemoryUsed() != tc.MemoryUsed() {
+		t.Errorf("memory of recovered stream = %d, want %d", tr.MemoryUsed(), tc.MemoryUsed())
+	}
+	want, _ := tc.XRange("s", "-", "+", 0)
+	if entries, _ := tr.XRange("s", "-", "+", 0); !reflect.DeepEqual(entries, want) {
+		t.Errorf("stream is recovered as %v", entries)
+	}
+	if pending, _ := tr.XPending("s", "g", XPendingArgs{}); len(pending) != 1 || pending[0].ID != "1-0" || pending[0].Consumer != "alice" {
+		t.Errorf("pending entries are recovered as %v", pending)
+	}
+	result, _ := tr.XReadGroup(context.Background(), "g", "bob", XReadArgs{Streams: map[string]string{"s": ">"}})
+	if ids := entryIDs(result["s"], nil); !reflect.DeepEqual(ids, []string{"2-3"}) {
+		t.Errorf("last delivered ID of group is not recovered: %v", ids)
+	}
+	if id, _ := tr.XAdd("s", XAddArgs{ID: "2-3", Fields: map[string]string{"a": "1"}}); id != "" {
+		t.Error("last ID of stream is not recovered")
+	}
+}
+
+func TestStreamAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.XGroupCreate("s", "g", "$", true)
+	tc.XAdd("s", XAddArgs{ID: "1-0", Fields: map[string]string{"a": "1"}})
+	tc.XAdd("s", XAddArgs{ID: "2-0", Fields: map[string]string{"a": "2"}})
+	tc.XReadGroup(context.Background(), "g", "alice", XReadArgs{Streams: map[string]string{"s": ">"}})
+	tc.XAck("s", "g", "1-0")
+	tc.XAdd("s", XAddArgs{Fields: map[string]string{"a": "3"}})
+	tc.XClaim("s", "g", "bob", 0, "2-0")
+	want := entryIDs(tc.XRange("s", "-", "+", 0))
+
+	tr := reopenAOF(t, tc, conf)
+	if ids := entryIDs(tr.XRange("s", "-", "+", 0)); len(ids) != 3 || !reflect.DeepEqual(ids, want) {
+		t.Errorf("stream is replayed as %v, want %v", ids, want)
+	}
+	if pending, _ := tr.XPending("s", "g", XPendingArgs{}); len(pending) != 1 || pending[0].ID != "2-0" || pending[0].Consumer != "bob" || pending[0].Deliveries != 2 {
+		t.Errorf("pending entries are replayed as %v", pending)
+	}
+	tr.Close(context.Background())
+}
@@ -0,0 +1,163 @@
+package rebis
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// TTLNotFound is returned by TTL if the key is not found or expired.
+const TTLNotFound time.Duration = -2
+
+/*
+	Expire sets the expiration of the item to d from now without changing its
+	value. If the duration is 0 (DefaultExpiration), the cache's default
+	expiration time is used. If it is -1 (NoExpiration), the item never
+	expires. Returns an error if the item is not found.
+*/
+func (c *cache) Expire(k string, d time.Duration) error {
+	if err := c.expire(k, c.expiration(d), false); err != nil {
+		return err
+	}
+
+	c.logIf("expire %s <- %s", k, d)
+
+	return nil
+}
+
+/*
+	ExpireAt sets the expiration of the item to the time, the item with time
+	in the past is deleted. Zero time removes the expiration. Returns an error
+	if the item is not found.
+*/
+func (c *cache) ExpireAt(k string, t time.Time) error {
+	var e int64
+	if !t.IsZero() {
+		e = t.UnixNano()
+	}
+
+	if err := c.expire(k, e, false); err != nil {
+		return err
+	}
+
+	c.logIf("expire %s at %s", k, t)
+
+	return nil
+}
+
+/*
+	Persist removes the expiration of the item, so it never expires, sliding
+	item stops sliding. Returns an error if the item is not found.
+*/
+func (c *cache) Persist(k string) error {
+	if err := c.expire(k, 0, false); err != nil {
+		return err
+	}
+
+	c.logIf("persist %s", k)
+
+	return nil
+}
+
+/*
+	Touch sets the expiration of the item to the cache's default expiration
+	from now and marks the item as used. Returns an error if the item is not
+	found.
+*/
+func (c *cache) Touch(k string) error {
+	if err := c.expire(k, c.expiration(DefaultExpiration), true); err != nil {
+		return err
+	}
+
+	c.logIf("touch %s", k)
+
+	return nil
+}
+
+/*
+	TTL returns the remaining time of life of the item, NoExpiration if the
+	item never expires and TTLNotFound if the item is not found or expired.
+*/
+func (c *cache) TTL(k string) time.Duration {
+	s := c.shard(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, found := s.items[k]
+	if !found || v.Expired() {
+		return TTLNotFound
+	}
+
+	if v.Expiration <= 0 {
+		return NoExpiration
+	}
+
+	if d := time.Until(time.Unix(0, v.Expiration)); d > 0 {
+		return d
+	}
+
+	return time.Nanosecond
+}
+
+/*
+	Set expiration e in unix nano to the item, 0 removes the expiration and
+	the item with e in the past is deleted.
+*/
+func (c *cache) expire(k string, e int64, touch bool) error {
+	s := c.shard(k)
+	s.mu.Lock()
+
+	if c.isClosed() {
+		s.mu.Unlock()
+
+		return ErrClosed
+	}
+
+	ov, evicted, err := c.setExpiration(s, k, e, touch)
+	s.mu.Unlock()
+
+	if err == nil {
+		c.awaitAOF()
+	}
+
+	if evicted {
+		c.onEvicted(k, ov)
+	}
+
+	return err
+}
+
+/*
+	Set expiration e to the item in the locked shard. Returns the value of
+	the deleted item and true if it has to be passed to the OnEvicted
+	function.
+*/
+func (c *cache) setExpiration(s *shard, k string, e int64, touch bool) (interface{}, bool, error) {
+	v, found := s.items[k]
+	if !found || v.Expired() {
+		return nil, false, fmt.Errorf("item %s not found", k)
+	}
+
+	if e > 0 && e <= time.Now().UnixNano() {
+		atomic.AddUint64(&s.deletes, 1)
+		ov, evicted := c.delete(s, k)
+
+		return ov, evicted, nil
+	}
+
+	if touch {
+		v.meta.touch()
+	}
+
+	if e == 0 {
+		// the item which never expires does not slide
+		v.slide, v.deadline = 0, 0
+	}
+
+	v.Expiration = e
+	s.items[k] = v
+	c.logExpire(k, e)
+	c.publish(EventExpire, k, v.Value)
+
+	return nil, false, nil
+}
@@ -0,0 +1,139 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExpire(t *testing.T) {
+	conf := configDefault()
+	conf.DefaultExpiration = time.Hour
+	tc, _ := NewCache(conf)
+
+	if d := tc.TTL("a"); d != TTLNotFound {
+		t.Errorf("TTL of missing key is %s", d)
+	}
+	if err := tc.Expire("a", time.Minute); err == nil {
+		t.Error("expire of missing key")
+	}
+
+	tc.SetWithTags("a", 1, NoExpiration, "x")
+	if d := tc.TTL("a"); d != NoExpiration {
+		t.Errorf("TTL of key without expiration is %s", d)
+	}
+
+	if err := tc.Expire("a", time.Minute); err != nil {
+		t.Fatal("Couldn't expire a:", err)
+	}
+	if d := tc.TTL("a"); d <= 59*time.Second || d > time.Minute {
+		t.Errorf("TTL after expire is %s", d)
+	}
+	if a, _ := tc.Get("a"); a != 1 {
+		t.Errorf("value is changed by expire: %v", a)
+	}
+	if tags := tc.Items()["a"].Tags(); len(tags) != 1 {
+		t.Errorf("tags are changed by expire: %v", tags)
+	}
+
+	tc.Expire("a", DefaultExpiration)
+	if d := tc.TTL("a"); d <= 59*time.Minute {
+		t.Errorf("TTL after expire with default expiration is %s", d)
+	}
+	if err := tc.Persist("a"); err != nil || tc.TTL("a") != NoExpiration {
+		t.Errorf("a is not persisted: %s %v", tc.TTL("a"), err)
+	}
+
+	at := time.Now().Add(2 * time.Hour)
+	tc.ExpireAt("a", at)
+	if _, exp, _ := tc.GetWithExpiration("a"); !exp.Equal(time.Unix(0, at.UnixNano())) {
+		t.Errorf("expiration after expire at is %s", exp)
+	}
+	tc.ExpireAt("a", time.Time{})
+	if d := tc.TTL("a"); d != NoExpiration {
+		t.Errorf("zero time does not remove expiration: %s", d)
+	}
+
+	tc.Set("short", 1, time.Millisecond)
+	if err := tc.Touch("short"); err != nil {
+		t.Fatal("Couldn't touch short:", err)
+	}
+	<-time.After(2 * time.Millisecond)
+	if d := tc.TTL("short"); d <= 59*time.Minute {
+		t.Errorf("TTL after touch is %s", d)
+	}
+
+	var evicted string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = k
+	})
+	if err := tc.ExpireAt("a", time.Now().Add(-time.Second)); err != nil {
+		t.Error("Couldn't expire a in the past:", err)
+	}
+	if _, found := tc.Get("a"); found || evicted != "a" {
+		t.Errorf("a is not deleted by expiration in the past, evicted %q", evicted)
+	}
+	if len(tc.tags.keys) != 0 {
+		t.Error("expired key is kept in the tag index")
+	}
+
+	tc.Set("expired", 1, time.Millisecond)
+	<-time.After(2 * time.Millisecond)
+	if err := tc.Persist("expired"); err == nil {
+		t.Error("expired item is persisted")
+	}
+	if d := tc.TTL("expired"); d != TTLNotFound {
+		t.Errorf("TTL of expired key is %s", d)
+	}
+
+	tc.Close(context.Background())
+	if err := tc.Expire("short", time.Minute); !errors.Is(err, ErrClosed) {
+		t.Error("expire after Close returned:", err)
+	}
+}
+
+func TestExpireAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 1, time.Hour)
+	tc.Set("c", 1, DefaultExpiration)
+	tc.Expire("a", time.Hour)
+	tc.Persist("b")
+	tc.Expire("c", 10*time.Millisecond)
+
+	tr := reopenAOF(t, tc, conf)
+	if d := tr.TTL("a"); d <= 59*time.Minute {
+		t.Errorf("TTL of a after replay is %s", d)
+	}
+	if d := tr.TTL("b"); d != NoExpiration {
+		t.Errorf("TTL of b after replay is %s", d)
+	}
+	<-time.After(10 * time.Millisecond)
+	tr.Close(context.Background())
+
+	tr, _ = NewCache(conf)
+	if _, found := tr.Get("c"); found {
+		t.Error("c is not expired after replay")
+	}
+	tr.Close(context.Background())
+}
+
+func TestTypedExpire(t *testing.T) {
+	tc, _ := NewTypedCache[int, string](configDefault())
+	tc.Set(1, "one", DefaultExpiration)
+
+	if err := tc.Expire(1, time.Minute); err != nil || tc.TTL(1) <= 59*time.Second {
+		t.Errorf("typed expire is wrong: %s %v", tc.TTL(1), err)
+	}
+	if err := tc.Persist(1); err != nil || tc.TTL(1) != NoExpiration {
+		t.Errorf("typed persist is wrong: %s %v", tc.TTL(1), err)
+	}
+	if err := tc.Touch(1); err != nil {
+		t.Error("Couldn't touch typed item:", err)
+	}
+	if err := tc.ExpireAt(1, time.Now().Add(-time.Second)); err != nil || tc.TTL(1) != TTLNotFound {
+		t.Errorf("typed expire at is wrong: %s %v", tc.TTL(1), err)
+	}
+}
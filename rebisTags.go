@@ -0,0 +1,203 @@
+package rebis
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	tagIndex maps tags to keys of the items with them. It is changed under
+	the lock of the shard of the key, so the lock order is shard, index.
+*/
+type tagIndex struct {
+	mu   sync.Mutex
+	keys map[string]map[string]struct{}
+}
+
+/*
+	Tags returns tags of the item.
+*/
+func (item Item) Tags() []string {
+	if len(item.tags) == 0 {
+		return nil
+	}
+
+	return append([]string(nil), item.tags...)
+}
+
+/*
+	Add an item with tags to the cache, replacing any existing item and its
+	tags. Items of the tag can be found by KeysByTag and deleted together by
+	InvalidateTag. Set, Add and Replace write items without tags.
+*/
+func (c *cache) SetWithTags(k string, x interface{}, d time.Duration, tags ...string) error {
+	item := c.newItem(k, x, d)
+	item.tags = uniqueTags(tags)
+	item.size += tagsSize(item.tags)
+
+	if err := c.put(c.shard(k), k, item, nil); err != nil {
+		return err
+	}
+
+	c.logIf("set %s -> %v <- %s with tags %v", k, x, d, item.tags)
+
+	return nil
+}
+
+/*
+	KeysByTag returns keys of unexpired items with the tag.
+*/
+func (c *cache) KeysByTag(tag string) []string {
+	keys := make([]string, 0)
+	now := time.Now().UnixNano()
+
+	for _, k := range c.tags.keysOf(tag) {
+		s := c.shard(k)
+		s.mu.RLock()
+		if v, found := s.items[k]; found && (v.Expiration <= 0 || v.Expiration > now) && hasTag(v.tags, tag) {
+			keys = append(keys, k)
+		}
+		s.mu.RUnlock()
+	}
+
+	return keys
+}
+
+/*
+	InvalidateTag deletes all items with the tag and returns their count.
+	Deleted items are passed to the OnEvicted function. Items which get the
+	tag during the call can be kept.
+*/
+func (c *cache) InvalidateTag(tag string) int {
+	var (
+		evictedItems []keyAndValue
+		n            int
+	)
+
+	for _, k := range c.tags.keysOf(tag) {
+		s := c.shard(k)
+		s.mu.Lock()
+
+		if c.isClosed() {
+			s.mu.Unlock()
+
+			break
+		}
+
+		if v, found := s.items[k]; found && hasTag(v.tags, tag) {
+			atomic.AddUint64(&s.deletes, 1)
+			n++
+
+			if ov, evicted := c.delete(s, k); evicted {
+				evictedItems = append(evictedItems, keyAndValue{k, ov})
+			}
+		}
+
+		s.mu.Unlock()
+	}
+
+	c.awaitAOF()
+
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+
+	c.logIf("invalidate tag %s, deleted %d items", tag, n)
+
+	return n
+}
+
+/*
+	Replace tags of the key in the index, called under the shard lock.
+*/
+func (t *tagIndex) retag(k string, old, tags []string) {
+	if len(old) == 0 && len(tags) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tag := range old {
+		keys := t.keys[tag]
+		delete(keys, k)
+
+		if len(keys) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+
+	for _, tag := range tags {
+		keys, found := t.keys[tag]
+		if !found {
+			keys = make(map[string]struct{})
+			t.keys[tag] = keys
+		}
+
+		keys[k] = struct{}{}
+	}
+}
+
+func (t *tagIndex) keysOf(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keys := make([]string, 0, len(t.keys[tag]))
+	for k := range t.keys[tag] {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+func (t *tagIndex) reset() {
+	t.mu.Lock()
+	t.keys = make(map[string]map[string]struct{})
+	t.mu.Unlock()
+}
+
+/*
+	Returns sorted tags without duplicates, the slice of the caller is not
+	kept.
+*/
+func uniqueTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	unique := append([]string(nil), tags...)
+	sort.Strings(unique)
+
+	n := 1
+	for _, tag := range unique[1:] {
+		if tag != unique[n-1] {
+			unique[n] = tag
+			n++
+		}
+	}
+
+	return unique[:n]
+}
+
+/*
+	Check that sorted tags have the tag.
+*/
+func hasTag(tags []string, tag string) bool {
+	i := sort.SearchStrings(tags, tag)
+
+	return i < len(tags) && tags[i] == tag
+}
+
+/*
+	Returns the count of bytes used by tags of the item.
+*/
+func tagsSize(tags []string) uintptr {
+	var n uintptr
+	for _, tag := range tags {
+		n += sizeString + uintptr(len(tag))
+	}
+
+	return n
+}
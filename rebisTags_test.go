@@ -0,0 +1,180 @@
+package rebis
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func sortedKeysByTag(tc *Cache, tag string) []string {
+	keys := tc.KeysByTag(tag)
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestTags(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+
+	tc.SetWithTags("page:1", "p1", DefaultExpiration, "tenant:1", "page", "page")
+	tc.SetWithTags("page:2", "p2", DefaultExpiration, "tenant:2", "page")
+	tc.SetWithTags("user:1", "u1", DefaultExpiration, "tenant:1")
+	tc.Set("plain", 1, DefaultExpiration)
+
+	if keys := sortedKeysByTag(tc, "tenant:1"); !reflect.DeepEqual(keys, []string{"page:1", "user:1"}) {
+		t.Errorf("keys of tenant:1 are wrong: %v", keys)
+	}
+	if keys := tc.KeysByTag("missing"); keys == nil || len(keys) != 0 {
+		t.Errorf("keys of missing tag are wrong: %v", keys)
+	}
+	item := tc.Items()["page:1"]
+	if tags := item.Tags(); !reflect.DeepEqual(tags, []string{"page", "tenant:1"}) {
+		t.Errorf("tags of page:1 are wrong: %v", tags)
+	}
+	if size, _ := tc.MemoryUsage("page:1"); size != sizeOf("page:1", "p1")+tagsSize([]string{"page", "tenant:1"}) {
+		t.Errorf("size of tags is not counted: %d", size)
+	}
+
+	// increment keeps tags, set replaces them
+	tc.SetWithTags("counter", 1, DefaultExpiration, "tenant:2")
+	tc.Increment("counter", 1)
+	if keys := sortedKeysByTag(tc, "tenant:2"); !reflect.DeepEqual(keys, []string{"counter", "page:2"}) {
+		t.Errorf("keys of tenant:2 after increment are wrong: %v", keys)
+	}
+	tc.Set("page:2", "p2", DefaultExpiration)
+	if keys := tc.KeysByTag("tenant:2"); !reflect.DeepEqual(keys, []string{"counter"}) {
+		t.Errorf("keys of tenant:2 after set are wrong: %v", keys)
+	}
+	tc.Delete("counter")
+	if keys := tc.KeysByTag("tenant:2"); len(keys) != 0 || len(tc.tags.keys["tenant:2"]) != 0 {
+		t.Errorf("deleted key is in the tag index: %v", keys)
+	}
+
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	if n := tc.InvalidateTag("tenant:1"); n != 2 {
+		t.Errorf("invalidated %d items of tenant:1", n)
+	}
+	sort.Strings(evicted)
+	if !reflect.DeepEqual(evicted, []string{"page:1", "user:1"}) {
+		t.Errorf("invalidated items are not evicted: %v", evicted)
+	}
+	if _, found := tc.Get("page:1"); found {
+		t.Error("page:1 is found after invalidation")
+	}
+	if n := tc.InvalidateTag("tenant:1"); n != 0 {
+		t.Errorf("invalidated %d items twice", n)
+	}
+	if n := tc.ItemCount(); n != 2 {
+		t.Errorf("items count after invalidation is not 2: %d", n)
+	}
+
+	tc.SetWithTags("a", 1, DefaultExpiration, "x")
+	tc.Flush()
+	if len(tc.tags.keys) != 0 {
+		t.Errorf("tag index is not empty after flush: %v", tc.tags.keys)
+	}
+}
+
+func TestTagsExpired(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SetWithTags("a", 1, time.Millisecond, "x")
+	tc.SetWithTags("b", 1, DefaultExpiration, "x")
+	<-time.After(2 * time.Millisecond)
+
+	if keys := tc.KeysByTag("x"); !reflect.DeepEqual(keys, []string{"b"}) {
+		t.Errorf("expired key is returned by tag: %v", keys)
+	}
+	tc.DeleteExpired()
+	if _, found := tc.tags.keys["x"]["a"]; found {
+		t.Error("expired key is in the tag index")
+	}
+}
+
+func TestTagsBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.SetWithTags("a", 1, DefaultExpiration, "x", "y")
+	tc.SetWithTags("b", "b", DefaultExpiration, "y")
+	tc.Set("c", 1, DefaultExpiration)
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if keys := sortedKeysByTag(tr, "y"); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("tags are not recovered: %v", keys)
+	}
+	if tr.MemoryUsed() != tc.MemoryUsed() {
+		t.Errorf("memory after recovery is %d, not %d", tr.MemoryUsed(), tc.MemoryUsed())
+	}
+
+	tf, _ := NewCacheFrom(configDefault(), tc.Items())
+	if keys := tf.KeysByTag("x"); !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("tags of NewCacheFrom are not indexed: %v", keys)
+	}
+}
+
+func TestTagsAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.SetWithTags("a", 1, DefaultExpiration, "x")
+	tc.SetWithTags("b", 1, DefaultExpiration, "x")
+	tc.SetWithTags("c", 1, DefaultExpiration, "x")
+	tc.Set("b", 2, DefaultExpiration)
+	tc.Increment("c", 1)
+
+	tr := reopenAOF(t, tc, conf)
+	if keys := sortedKeysByTag(tr, "x"); !reflect.DeepEqual(keys, []string{"a", "c"}) {
+		t.Errorf("tags are not replayed: %v", keys)
+	}
+	if err := tr.RewriteAOF(); err != nil {
+		t.Fatal("Couldn't rewrite append only file:", err)
+	}
+
+	tr = reopenAOF(t, tr, conf)
+	if keys := sortedKeysByTag(tr, "x"); !reflect.DeepEqual(keys, []string{"a", "c"}) {
+		t.Errorf("tags are lost after rewrite: %v", keys)
+	}
+	tr.Close(context.Background())
+}
+
+func TestTypedTags(t *testing.T) {
+	tc, _ := NewTypedCache[int, string](configDefault())
+	tc.SetWithTags(1, "one", DefaultExpiration, "odd")
+	tc.SetWithTags(2, "two", DefaultExpiration, "even")
+	tc.SetWithTags(3, "three", DefaultExpiration, "odd")
+
+	keys := tc.KeysByTag("odd")
+	sort.Ints(keys)
+	if !reflect.DeepEqual(keys, []int{1, 3}) {
+		t.Errorf("typed keys by tag are wrong: %v", keys)
+	}
+	if n := tc.InvalidateTag("odd"); n != 2 || tc.ItemCount() != 1 {
+		t.Errorf("typed invalidation is wrong: %d, %d", n, tc.ItemCount())
+	}
+	if st := tc.Stats(); st.Hits != 0 {
+		t.Errorf("keys by tag are counted as hits: %d", st.Hits)
+	}
+}
+
+func TestUniqueTags(t *testing.T) {
+	if tags := uniqueTags([]string{"b", "a", "b", "c", "a"}); !reflect.DeepEqual(tags, []string{"a", "b", "c"}) {
+		t.Errorf("unique tags are wrong: %v", tags)
+	}
+	if tags := uniqueTags(nil); tags != nil {
+		t.Errorf("unique tags of nil are wrong: %v", tags)
+	}
+	if !hasTag([]string{"a", "c"}, "c") || hasTag([]string{"a", "c"}, "b") {
+		t.Error("hasTag is wrong")
+	}
+}
@@ -0,0 +1,290 @@
+package rebis
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTxnAborted is returned by Txn.Exec if a watched key is changed.
+var ErrTxnAborted = errors.New("rebis: transaction aborted, watched key is changed")
+
+/*
+	Txn queues operations on several keys and executes them atomically by
+	Exec, like MULTI and EXEC in Redis. Txn is not safe for concurrent use.
+*/
+type Txn struct {
+	c       *cache
+	watched map[string]watchState
+	ops     []txnOp
+}
+
+/*
+	TxnResult is the result of the operation of the transaction.
+*/
+type TxnResult struct {
+	Value interface{} // new value by Increment, whether the unexpired item is deleted by Delete
+	Err   error
+}
+
+type txnKind uint8
+
+const (
+	txnSet txnKind = iota
+	txnDelete
+	txnIncrement
+	txnExpire
+)
+
+type txnOp struct {
+	kind  txnKind
+	key   string
+	value interface{}
+	d     time.Duration
+	n     int64
+	item  Item // the item of Set, created by Exec
+}
+
+/*
+	watchState is the state of the watched key, zero if the key is not found.
+*/
+type watchState struct {
+	version    uint64
+	expiration int64
+}
+
+/*
+	Txn returns a new transaction of the cache.
+*/
+func (c *cache) Txn() *Txn {
+	return &Txn{c: c, watched: make(map[string]watchState)}
+}
+
+/*
+	Watch keys, Exec aborts the transaction if any of them is written,
+	deleted or gets another expiration after the call.
+*/
+func (t *Txn) Watch(keys ...string) *Txn {
+	for _, k := range keys {
+		s := t.c.shard(k)
+		s.mu.RLock()
+		t.watched[k] = watchOf(s, k)
+		s.mu.RUnlock()
+	}
+
+	return t
+}
+
+/*
+	Set queues Set of the item, the duration is used like in Cache.Set.
+*/
+func (t *Txn) Set(k string, x interface{}, d time.Duration) *Txn {
+	t.ops = append(t.ops, txnOp{kind: txnSet, key: k, value: x, d: d})
+
+	return t
+}
+
+/*
+	Delete queues Delete of the item.
+*/
+func (t *Txn) Delete(k string) *Txn {
+	t.ops = append(t.ops, txnOp{kind: txnDelete, key: k})
+
+	return t
+}
+
+/*
+	Increment queues Increment of the item by n.
+*/
+func (t *Txn) Increment(k string, n int64) *Txn {
+	t.ops = append(t.ops, txnOp{kind: txnIncrement, key: k, n: n})
+
+	return t
+}
+
+/*
+	Expire queues Expire of the item, the duration is used like in
+	Cache.Expire.
+*/
+func (t *Txn) Expire(k string, d time.Duration) *Txn {
+	t.ops = append(t.ops, txnOp{kind: txnExpire, key: k, d: d})
+
+	return t
+}
+
+/*
+	Exec executes queued operations in order under the locks of all their
+	shards, so other operations see all of them or none. Returns the result
+	of every operation, failed operations do not stop the others like in
+	Redis. If a watched key is changed, nothing is executed and
+	ErrTxnAborted is returned. The transaction is reset after Exec.
+*/
+func (t *Txn) Exec() ([]TxnResult, error) {
+	c := t.c
+	defer t.reset()
+
+	keys := make([]string, 0, len(t.watched)+len(t.ops))
+	for k := range t.watched {
+		keys = append(keys, k)
+	}
+
+	for i := range t.ops {
+		op := &t.ops[i]
+		keys = append(keys, op.key)
+
+		if op.kind == txnSet {
+			op.item = c.newItem(op.key, op.value, op.d)
+		}
+	}
+
+	shards := c.shardsOf(keys)
+	lockShards(shards)
+
+	// evict items before the commit while there is no memory for new values
+	for atomic.LoadUintptr(&c.size)+t.growth() > c.maxSize {
+		unlockShards(shards)
+		evicted := c.evict()
+		lockShards(shards)
+
+		if !evicted {
+			break
+		}
+	}
+
+	if c.isClosed() {
+		unlockShards(shards)
+
+		return nil, ErrClosed
+	}
+
+	for k, w := range t.watched {
+		if watchOf(c.shard(k), k) != w {
+			unlockShards(shards)
+
+			return nil, ErrTxnAborted
+		}
+	}
+
+	var evictedItems []keyAndValue
+
+	results := make([]TxnResult, len(t.ops))
+	for i, op := range t.ops {
+		results[i] = c.execOp(op, &evictedItems)
+	}
+
+	unlockShards(shards)
+	c.awaitAOF()
+
+	for _, v := range evictedItems {
+		c.onEvicted(v.key, v.value)
+	}
+
+	c.logIf("exec transaction of %d operations", len(t.ops))
+
+	return results, nil
+}
+
+/*
+	Discard queued operations and watched keys.
+*/
+func (t *Txn) Discard() {
+	t.reset()
+}
+
+func (t *Txn) reset() {
+	t.ops = nil
+	t.watched = make(map[string]watchState)
+}
+
+/*
+	Returns the count of bytes which Set operations add to the locked cache.
+*/
+func (t *Txn) growth() uintptr {
+	var n uintptr
+
+	for _, op := range t.ops {
+		if op.kind != txnSet {
+			continue
+		}
+
+		if old := t.c.shard(op.key).items[op.key]; op.item.size > old.size {
+			n += op.item.size - old.size
+		}
+	}
+
+	return n
+}
+
+/*
+	Execute the operation with the shard of its key locked. Values of deleted
+	items are added to evictedItems if they have to be passed to the
+	OnEvicted function.
+*/
+func (c *cache) execOp(op txnOp, evictedItems *[]keyAndValue) TxnResult {
+	s := c.shard(op.key)
+
+	switch op.kind {
+	case txnSet:
+		if err := c.checkAOF(op.key, op.item.Value); err != nil {
+			return TxnResult{Err: err}
+		}
+
+		if !c.store(s, op.key, op.item) {
+			atomic.AddUint64(&c.rejected, 1)
+
+			return TxnResult{Err: errNoSlot}
+		}
+
+		atomic.AddUint64(&s.sets, 1)
+
+		return TxnResult{}
+	case txnDelete:
+		v, found := s.items[op.key]
+		if !found {
+			return TxnResult{Value: false}
+		}
+
+		atomic.AddUint64(&s.deletes, 1)
+
+		if ov, evicted := c.delete(s, op.key); evicted {
+			*evictedItems = append(*evictedItems, keyAndValue{op.key, ov})
+		}
+
+		return TxnResult{Value: !v.Expired()}
+	case txnIncrement:
+		var nv interface{}
+
+		err := c.modify(s, op.key, func(x interface{}) (interface{}, error) {
+			v, ok := addInt(x, op.n)
+			if !ok {
+				return nil, fmt.Errorf("the value for %s is not an integer", op.key)
+			}
+
+			nv = v
+
+			return v, nil
+		})
+
+		return TxnResult{Value: nv, Err: err}
+	default:
+		ov, evicted, err := c.setExpiration(s, op.key, c.expiration(op.d), false)
+		if evicted {
+			*evictedItems = append(*evictedItems, keyAndValue{op.key, ov})
+		}
+
+		return TxnResult{Err: err}
+	}
+}
+
+/*
+	Returns the state of the key in the locked shard.
+*/
+func watchOf(s *shard, k string) watchState {
+	v, found := s.items[k]
+	if !found || v.Expired() {
+		return watchState{}
+	}
+
+	return watchState{v.version, v.Expiration}
+}
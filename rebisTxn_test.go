@@ -0,0 +1,167 @@
+package rebis
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTxn(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("counter", 10, DefaultExpiration)
+	tc.Set("old", "x", DefaultExpiration)
+	tc.Set("s", "str", DefaultExpiration)
+
+	results, err := tc.Txn().
+		Increment("counter", -3).
+		Set("audit", "moved 3", time.Hour).
+		Delete("old").
+		Delete("missing").
+		Increment("s", 1).
+		Expire("counter", time.Minute).
+		Expire("missing", time.Minute).
+		Exec()
+	if err != nil {
+		t.Fatal("Couldn't exec transaction:", err)
+	}
+	if len(results) != 7 {
+		t.Fatalf("results count is %d", len(results))
+	}
+
+	if r := results[0]; r.Err != nil || r.Value != 7 {
+		t.Errorf("result of increment is %v, %v", r.Value, r.Err)
+	}
+	if r := results[1]; r.Err != nil {
+		t.Error("result of set is error:", r.Err)
+	}
+	if results[2].Value != true || results[3].Value != false {
+		t.Errorf("results of delete are %v, %v", results[2].Value, results[3].Value)
+	}
+	if results[4].Err == nil {
+		t.Error("increment of string has no error")
+	}
+	if results[5].Err != nil || results[6].Err == nil {
+		t.Errorf("results of expire are %v, %v", results[5].Err, results[6].Err)
+	}
+
+	if x, _ := tc.Get("counter"); x != 7 {
+		t.Errorf("counter is %v", x)
+	}
+	if d := tc.TTL("counter"); d <= 59*time.Second || d > time.Minute {
+		t.Errorf("TTL of counter is %s", d)
+	}
+	if x, _ := tc.Get("audit"); x != "moved 3" {
+		t.Errorf("audit is %v", x)
+	}
+	if _, found := tc.Get("old"); found {
+		t.Error("old is not deleted")
+	}
+}
+
+func TestTxnWatch(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("a", 1, DefaultExpiration)
+
+	txn := tc.Txn().Watch("a", "b")
+	txn.Set("c", 1, DefaultExpiration)
+	tc.Set("a", 2, DefaultExpiration)
+	if _, err := txn.Exec(); !errors.Is(err, ErrTxnAborted) {
+		t.Error("exec after write of watched key:", err)
+	}
+	if _, found := tc.Get("c"); found {
+		t.Error("aborted transaction wrote c")
+	}
+
+	txn.Watch("a", "b").Set("c", 1, DefaultExpiration)
+	tc.Set("b", 1, DefaultExpiration)
+	if _, err := txn.Exec(); !errors.Is(err, ErrTxnAborted) {
+		t.Error("exec after add of watched key:", err)
+	}
+
+	txn.Watch("a").Set("c", 1, DefaultExpiration)
+	tc.Expire("a", time.Hour)
+	if _, err := txn.Exec(); !errors.Is(err, ErrTxnAborted) {
+		t.Error("exec after expire of watched key:", err)
+	}
+
+	txn.Watch("a", "b").Set("c", 2, DefaultExpiration)
+	tc.Get("a")
+	tc.Set("d", 1, DefaultExpiration)
+	if _, err := txn.Exec(); err != nil {
+		t.Error("Couldn't exec transaction with unchanged watched keys:", err)
+	}
+	if x, _ := tc.Get("c"); x != 2 {
+		t.Errorf("c is %v", x)
+	}
+
+	txn.Watch("a").Set("e", 1, DefaultExpiration)
+	txn.Discard()
+	tc.Set("a", 3, DefaultExpiration)
+	if results, err := txn.Exec(); err != nil || len(results) != 0 {
+		t.Errorf("discarded transaction is executed: %v %v", results, err)
+	}
+}
+
+func TestTxnConcurrent(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("from", 800, DefaultExpiration)
+	tc.Set("to", 0, DefaultExpiration)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				tc.Txn().Increment("from", -1).Increment("to", 1).Exec()
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	for {
+		values := tc.GetMulti([]string{"from", "to"})
+		if values["from"].(int)+values["to"].(int) != 800 {
+			t.Fatalf("transaction is not atomic: %v", values)
+		}
+		select {
+		case <-done:
+			if x, _ := tc.Get("to"); x != 800 {
+				t.Errorf("to is %v", x)
+			}
+			return
+		default:
+		}
+	}
+}
+
+func TestTxnMaxMemory(t *testing.T) {
+	conf := configDefault()
+	conf.MaxMemory = 4096
+	conf.EvictionPolicy = EvictAllKeysLRU
+	tc, _ := NewCache(conf)
+	for i := 0; i < 3; i++ {
+		tc.Set(key(i), make([]byte, 1024), DefaultExpiration)
+	}
+
+	results, err := tc.Txn().Set("x", make([]byte, 1024), DefaultExpiration).Set("y", make([]byte, 1024), DefaultExpiration).Exec()
+	if err != nil || results[0].Err != nil || results[1].Err != nil {
+		t.Fatalf("Couldn't exec transaction with eviction: %v %v", results, err)
+	}
+	if used := tc.MemoryUsed(); used > 4096 {
+		t.Errorf("memory used is more than limit: %d", used)
+	}
+
+	conf.EvictionPolicy = NoEviction
+	tn, _ := NewCache(conf)
+	results, _ = tn.Txn().Set("a", make([]byte, 2048), DefaultExpiration).Set("b", make([]byte, 2048), DefaultExpiration).Exec()
+	if results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("results without memory are wrong: %v", results)
+	}
+}
@@ -0,0 +1,508 @@
+package rebis
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+/*
+	TypedCache is type-safe wrapper over hidden cache. It shares janitor,
+	backup and logger with the untyped cache, values are stored together
+	with their keys, so Items can return map[K]V.
+*/
+type TypedCache[K comparable, V any] struct {
+	c     *Cache
+	mixed bool // K is an interface type, its keys can be of different types
+}
+
+/*
+	typedItem is value of cache item in the typed cache.
+*/
+type typedItem[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+/*
+	Size of the typed item is the size of its key and value.
+*/
+func (i typedItem[K, V]) Size() uintptr {
+	return valueSize(i.Key) + valueSize(i.Value)
+}
+
+/*
+	NewTypedCache create new typed rebis cache from config struct. Items of
+	the typed cache are registered for backups, so K and V must be types that
+	encoding/gob can encode.
+*/
+func NewTypedCache[K comparable, V any](config *Config) (*TypedCache[K, V], error) {
+	RegisterType(typedItem[K, V]{})
+
+	C, err := newCache(config, make(map[string]Item))
+	if err != nil {
+		return nil, err
+	}
+
+	mixed := reflect.TypeOf((*K)(nil)).Elem().Kind() == reflect.Interface
+
+	return &TypedCache[K, V]{C, mixed}, nil
+}
+
+/*
+	Returns the key of the item in the hidden cache. If K is an interface
+	type, the key is prefixed with the type of k, so 1 and "1" are different
+	keys.
+*/
+func (tc *TypedCache[K, V]) key(k K) string {
+	if tc.mixed {
+		return fmt.Sprintf("%T:", k) + encodeKey(k)
+	}
+
+	return encodeKey(k)
+}
+
+func encodeKey(k interface{}) string {
+	switch v := k.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	default:
+		return fmt.Sprintf("%#v", k)
+	}
+}
+
+/*
+	Add an item to the cache, replacing any existing item. If the duration is 0
+	(DefaultExpiration), the cache's default expiration time is used. If it is -1
+	(NoExpiration), the item never expires.
+*/
+func (tc *TypedCache[K, V]) Set(k K, v V, d time.Duration) error {
+	return tc.c.Set(tc.key(k), typedItem[K, V]{k, v}, d)
+}
+
+/*
+	Add an item to the cache, replacing any existing item, using the default expiration.
+*/
+func (tc *TypedCache[K, V]) SetDefault(k K, v V) error {
+	return tc.Set(k, v, DefaultExpiration)
+}
+
+/*
+	Add an item with tags to the cache, replacing any existing item and its
+	tags.
+*/
+func (tc *TypedCache[K, V]) SetWithTags(k K, v V, d time.Duration, tags ...string) error {
+	return tc.c.SetWithTags(tc.key(k), typedItem[K, V]{k, v}, d, tags...)
+}
+
+/*
+	Add an item with sliding expiration to the cache, replacing any existing
+	item.
+*/
+func (tc *TypedCache[K, V]) SetSliding(k K, v V, d, maxLifetime time.Duration) error {
+	return tc.c.SetSliding(tc.key(k), typedItem[K, V]{k, v}, d, maxLifetime)
+}
+
+/*
+	Returns keys of unexpired items with the tag.
+*/
+func (tc *TypedCache[K, V]) KeysByTag(tag string) []K {
+	keys := make([]K, 0)
+
+	// items are read without Get, so they are not counted as hits
+	for _, k := range tc.c.KeysByTag(tag) {
+		s := tc.c.shard(k)
+		s.mu.RLock()
+		item, ok := s.items[k].Value.(typedItem[K, V])
+		s.mu.RUnlock()
+
+		if ok {
+			keys = append(keys, item.Key)
+		}
+	}
+
+	return keys
+}
+
+/*
+	Delete all items with the tag and return their count.
+*/
+func (tc *TypedCache[K, V]) InvalidateTag(tag string) int {
+	return tc.c.InvalidateTag(tag)
+}
+
+/*
+	Add an item to the cache only if an item doesn't already exist for the given
+	key, or if the existing item has expired. Returns an error otherwise.
+*/
+func (tc *TypedCache[K, V]) Add(k K, v V, d time.Duration) error {
+	return tc.c.Add(tc.key(k), typedItem[K, V]{k, v}, d)
+}
+
+/*
+	Set a new value for the cache key only if it already exists, and the existing
+	item hasn't expired. Returns an error otherwise.
+*/
+func (tc *TypedCache[K, V]) Replace(k K, v V, d time.Duration) error {
+	return tc.c.Replace(tc.key(k), typedItem[K, V]{k, v}, d)
+}
+
+/*
+	Get an item from the cache. Returns the item or zero value, and a bool
+	indicating whether the key was found.
+*/
+func (tc *TypedCache[K, V]) Get(k K) (V, bool) {
+	x, found := tc.c.Get(tc.key(k))
+	if !found {
+		var zero V
+
+		return zero, false
+	}
+
+	item, ok := x.(typedItem[K, V])
+
+	return item.Value, ok
+}
+
+/*
+	GetWithExpiration returns an item and its expiration time from the cache.
+	It returns the item or zero value, the expiration time and a bool indicating
+	whether the key was found.
+*/
+func (tc *TypedCache[K, V]) GetWithExpiration(k K) (V, time.Time, bool) {
+	x, t, found := tc.c.GetWithExpiration(tc.key(k))
+	if !found {
+		var zero V
+
+		return zero, t, false
+	}
+
+	item, ok := x.(typedItem[K, V])
+
+	return item.Value, t, ok
+}
+
+/*
+	GetWithVersion returns an item and its version from the cache. It returns
+	the item or zero value, the version and a bool indicating whether the key
+	was found.
+*/
+func (tc *TypedCache[K, V]) GetWithVersion(k K) (V, uint64, bool) {
+	x, version, found := tc.c.GetWithVersion(tc.key(k))
+	if !found {
+		var zero V
+
+		return zero, 0, false
+	}
+
+	item, ok := x.(typedItem[K, V])
+
+	return item.Value, version, ok
+}
+
+/*
+	Replace the item only if it has the version. See Cache.CompareAndSwap.
+*/
+func (tc *TypedCache[K, V]) CompareAndSwap(k K, version uint64, v V, d time.Duration) error {
+	return tc.c.CompareAndSwap(tc.key(k), version, typedItem[K, V]{k, v}, d)
+}
+
+/*
+	Delete the item only if it has the version. See Cache.CompareAndDelete.
+*/
+func (tc *TypedCache[K, V]) CompareAndDelete(k K, version uint64) error {
+	return tc.c.CompareAndDelete(tc.key(k), version)
+}
+
+/*
+	GetOrLoad returns the item from the cache, on miss the value is loaded by
+	loader once for all concurrent callers. See Cache.GetOrLoad.
+*/
+func (tc *TypedCache[K, V]) GetOrLoad(ctx context.Context, k K, loader func(ctx context.Context) (V, time.Duration, error)) (V, error) {
+	x, err := tc.c.GetOrLoad(ctx, tc.key(k), func(ctx context.Context) (interface{}, time.Duration, error) {
+		v, d, err := loader(ctx)
+		if err != nil {
+			return nil, d, err
+		}
+
+		return typedItem[K, V]{k, v}, d, nil
+	})
+
+	item, ok := x.(typedItem[K, V])
+	if err == nil && !ok {
+		err = fmt.Errorf("item %v is not of the cache type", k)
+	}
+
+	return item.Value, err
+}
+
+/*
+	Set the expiration of the item to d from now without changing its value.
+*/
+func (tc *TypedCache[K, V]) Expire(k K, d time.Duration) error {
+	return tc.c.Expire(tc.key(k), d)
+}
+
+/*
+	Set the expiration of the item to the time, the item with time in the
+	past is deleted.
+*/
+func (tc *TypedCache[K, V]) ExpireAt(k K, t time.Time) error {
+	return tc.c.ExpireAt(tc.key(k), t)
+}
+
+/*
+	Remove the expiration of the item.
+*/
+func (tc *TypedCache[K, V]) Persist(k K) error {
+	return tc.c.Persist(tc.key(k))
+}
+
+/*
+	Set the expiration of the item to the default expiration from now.
+*/
+func (tc *TypedCache[K, V]) Touch(k K) error {
+	return tc.c.Touch(tc.key(k))
+}
+
+/*
+	Returns the remaining time of life of the item, NoExpiration or
+	TTLNotFound.
+*/
+func (tc *TypedCache[K, V]) TTL(k K) time.Duration {
+	return tc.c.TTL(tc.key(k))
+}
+
+/*
+	Delete an item from the cache. Does nothing if the key is not in the cache.
+*/
+func (tc *TypedCache[K, V]) Delete(k K) {
+	tc.c.Delete(tc.key(k))
+}
+
+/*
+	Returns values of unexpired items of the keys, missing keys are not in
+	the map.
+*/
+func (tc *TypedCache[K, V]) GetMulti(keys []K) map[K]V {
+	values := tc.c.GetMulti(tc.keys(keys))
+	m := make(map[K]V, len(values))
+
+	for _, v := range values {
+		if item, ok := v.(typedItem[K, V]); ok {
+			m[item.Key] = item.Value
+		}
+	}
+
+	return m
+}
+
+/*
+	Add items to the cache, replacing any existing items. Either all items
+	are written or none of them.
+*/
+func (tc *TypedCache[K, V]) SetMulti(items map[K]V, d time.Duration) error {
+	return tc.c.SetMulti(tc.values(items), d)
+}
+
+/*
+	Add items to the cache only if none of the keys exists.
+*/
+func (tc *TypedCache[K, V]) SetMultiNX(items map[K]V, d time.Duration) error {
+	return tc.c.SetMultiNX(tc.values(items), d)
+}
+
+/*
+	Delete items of the keys and return the count of deleted unexpired items.
+*/
+func (tc *TypedCache[K, V]) DeleteMulti(keys []K) int {
+	return tc.c.DeleteMulti(tc.keys(keys))
+}
+
+/*
+	Returns keys of the items in the hidden cache.
+*/
+func (tc *TypedCache[K, V]) keys(keys []K) []string {
+	ks := make([]string, len(keys))
+	for i, k := range keys {
+		ks[i] = tc.key(k)
+	}
+
+	return ks
+}
+
+/*
+	Returns values of the items in the hidden cache by their keys.
+*/
+func (tc *TypedCache[K, V]) values(items map[K]V) map[string]interface{} {
+	values := make(map[string]interface{}, len(items))
+	for k, v := range items {
+		values[tc.key(k)] = typedItem[K, V]{k, v}
+	}
+
+	return values
+}
+
+/*
+	Copies all unexpired items in the cache into a new map and returns it.
+*/
+func (tc *TypedCache[K, V]) Items() map[K]V {
+	items := tc.c.Items()
+	m := make(map[K]V, len(items))
+
+	for _, v := range items {
+		if item, ok := v.Value.(typedItem[K, V]); ok {
+			m[item.Key] = item.Value
+		}
+	}
+
+	return m
+}
+
+/*
+	Calls f for every unexpired item until f returns false, the cache is not
+	locked while f is called. See Cache.Range.
+*/
+func (tc *TypedCache[K, V]) Range(f func(k K, v V) bool) {
+	tc.c.Range(func(_ string, v Item) bool {
+		item, ok := v.Value.(typedItem[K, V])
+		if !ok {
+			return true
+		}
+
+		return f(item.Key, item.Value)
+	})
+}
+
+/*
+	Returns the number of items in the cache. This may include items that have
+	expired, but have not yet been cleaned up.
+*/
+func (tc *TypedCache[K, V]) ItemCount() int {
+	return tc.c.ItemCount()
+}
+
+/*
+	Returns the current counters of the cache.
+*/
+func (tc *TypedCache[K, V]) Stats() Stats {
+	return tc.c.Stats()
+}
+
+/*
+	Set all counters of the cache to zero.
+*/
+func (tc *TypedCache[K, V]) ResetStats() {
+	tc.c.ResetStats()
+}
+
+/*
+	Delete all expired items from the cache.
+*/
+func (tc *TypedCache[K, V]) DeleteExpired() {
+	tc.c.DeleteExpired()
+}
+
+/*
+	Delete all items from the cache.
+*/
+func (tc *TypedCache[K, V]) Flush() {
+	tc.c.Flush()
+}
+
+/*
+	Close stops janitor, backup and append-only file of the cache.
+*/
+func (tc *TypedCache[K, V]) Close(ctx context.Context) error {
+	return tc.c.Close(ctx)
+}
+
+/*
+	ChangeLogger override the logger specified in the
+	cahce structure if it matches the Logger interface
+*/
+func (tc *TypedCache[K, V]) ChangeLogger(custom Logger) {
+	tc.c.ChangeLogger(custom)
+}
+
+/*
+	Saving backup to the path defined in the structure.
+*/
+func (tc *TypedCache[K, V]) BackupSave() error {
+	return tc.c.BackupSave()
+}
+
+/*
+	Saving backup by filename path.
+*/
+func (tc *TypedCache[K, V]) BackupSaveFile(filename string) error {
+	return tc.c.BackupSaveFile(filename)
+}
+
+/*
+	Custom function onEvicted.
+*/
+func (tc *TypedCache[K, V]) OnEvicted(f func(K, V)) {
+	tc.c.OnEvicted(func(_ string, x interface{}) {
+		if item, ok := x.(typedItem[K, V]); ok {
+			f(item.Key, item.Value)
+		}
+	})
+}
+
+/*
+	Recovery backup by path defined in the structure.
+*/
+func (tc *TypedCache[K, V]) BackupRecovery() error {
+	return tc.c.BackupRecovery()
+}
+
+/*
+	Recovery backup by filename path.
+*/
+func (tc *TypedCache[K, V]) BackupRecoveryFile(filename string) error {
+	return tc.c.BackupRecoveryFile(filename)
+}
+
+/*
+	Increment an item of the typed cache by n. Returns an error if it was not
+	found. If there is no error, the incremented value is returned.
+*/
+func Increment[K comparable, N Number](tc *TypedCache[K, N], k K, n N) (N, error) {
+	return updateTyped(tc, k, func(v N) N { return v + n })
+}
+
+/*
+	Decrement an item of the typed cache by n. Returns an error if it was not
+	found. If there is no error, the decremented value is returned.
+*/
+func Decrement[K comparable, N Number](tc *TypedCache[K, N], k K, n N) (N, error) {
+	return updateTyped(tc, k, func(v N) N { return v - n })
+}
+
+func updateTyped[K comparable, N Number](tc *TypedCache[K, N], k K, f func(N) N) (N, error) {
+	var nv N
+
+	key := tc.key(k)
+	err := tc.c.update(key, func(x interface{}) (interface{}, error) {
+		item, ok := x.(typedItem[K, N])
+		if !ok {
+			return nil, fmt.Errorf("the value for %s is not an %T", key, nv)
+		}
+
+		nv = f(item.Value)
+		item.Value = nv
+
+		return item, nil
+	})
+
+	return nv, err
+}
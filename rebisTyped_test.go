@@ -0,0 +1,170 @@
+package rebis
+
+import (
+	"testing"
+	"time"
+)
+
+type typedKey struct {
+	Tenant string
+	ID     int
+}
+
+func TestTypedCache(t *testing.T) {
+	tc, err := NewTypedCache[string, int](config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+
+	if _, found := tc.Get("a"); found {
+		t.Error("Getting A found value that shouldn't exist")
+	}
+
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("b", 2, NoExpiration)
+
+	a, found := tc.Get("a")
+	if !found || a != 1 {
+		t.Error("a is not 1:", a)
+	}
+
+	if err := tc.Add("a", 3, DefaultExpiration); err == nil {
+		t.Error("Successfully added another a when it should have returned an error")
+	}
+	if err := tc.Replace("c", 3, DefaultExpiration); err == nil {
+		t.Error("Replaced c when it shouldn't exist")
+	}
+	if err := tc.Replace("b", 3, DefaultExpiration); err != nil {
+		t.Error("Couldn't replace existing key b")
+	}
+
+	b, exp, found := tc.GetWithExpiration("b")
+	if !found || b != 3 || exp.UnixNano() != 0 {
+		t.Error("b is not 3 without expiration:", b, exp)
+	}
+
+	items := tc.Items()
+	if len(items) != 2 || items["a"] != 1 || items["b"] != 3 {
+		t.Errorf("Items get wrong, items %+v", items)
+	}
+
+	tc.Delete("a")
+	if _, found := tc.Get("a"); found {
+		t.Error("a was found, but it should have been deleted")
+	}
+	if n := tc.ItemCount(); n != 1 {
+		t.Errorf("Item count is not 1: %d", n)
+	}
+}
+
+func TestTypedCacheStructKey(t *testing.T) {
+	tc, err := NewTypedCache[typedKey, *TestStruct](config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+
+	tc.Set(typedKey{"a", 1}, &TestStruct{Num: 1}, DefaultExpiration)
+	tc.Set(typedKey{"a", 2}, &TestStruct{Num: 2}, DefaultExpiration)
+
+	x, found := tc.Get(typedKey{"a", 2})
+	if !found || x.Num != 2 {
+		t.Error("a2 is not 2:", x)
+	}
+
+	items := tc.Items()
+	if len(items) != 2 || items[typedKey{"a", 1}].Num != 1 {
+		t.Errorf("Items get wrong, items %+v", items)
+	}
+}
+
+func TestTypedCacheMixedKey(t *testing.T) {
+	// interface keys need go1.20 in the module of the caller, the key of
+	// such cache is checked directly
+	ints := &TypedCache[int, string]{mixed: true}
+	strs := &TypedCache[string, string]{mixed: true}
+	if ints.key(1) == strs.key("1") {
+		t.Errorf("keys 1 and \"1\" of interface type are the same: %s", ints.key(1))
+	}
+	if strs.key("int:1") == ints.key(1) {
+		t.Errorf("key \"int:1\" of interface type is the same as 1: %s", ints.key(1))
+	}
+}
+
+func TestTypedCacheIncrement(t *testing.T) {
+	tc, err := NewTypedCache[int, float64](config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+
+	if _, err := Increment(tc, 1, 1.5); err == nil {
+		t.Error("Incremented item that doesn't exist")
+	}
+
+	tc.Set(1, 1.5, DefaultExpiration)
+	n, err := Increment(tc, 1, 2)
+	if err != nil || n != 3.5 {
+		t.Error("Error incrementing:", n, err)
+	}
+
+	n, err = Decrement(tc, 1, 0.5)
+	if err != nil || n != 3 {
+		t.Error("Error decrementing:", n, err)
+	}
+
+	x, _ := tc.Get(1)
+	if x != 3 {
+		t.Error("1 is not 3:", x)
+	}
+}
+
+func TestTypedCacheOnEvicted(t *testing.T) {
+	tc, err := NewTypedCache[string, int](config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+
+	works := false
+	tc.OnEvicted(func(k string, v int) {
+		if k == "foo" && v == 3 {
+			works = true
+		}
+	})
+	tc.Set("foo", 3, DefaultExpiration)
+	tc.Delete("foo")
+
+	if !works {
+		t.Error("works bool not true")
+	}
+}
+
+func TestTypedCacheBackup(t *testing.T) {
+	ts, err := NewTypedCache[string, TestStruct](config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	ts.Set("a", TestStruct{Num: 1}, DefaultExpiration)
+	ts.Set("b", TestStruct{Num: 2, Children: []*TestStruct{{Num: 3}}}, DefaultExpiration)
+	ts.Set("expired", TestStruct{Num: 4}, time.Millisecond)
+
+	if err := ts.BackupSaveFile("test.rdb"); err != nil {
+		t.Fatal("Couldn't save cache to test.rdb:", err)
+	}
+
+	tr, err := NewTypedCache[string, TestStruct](config)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	if err := tr.BackupRecoveryFile("test.rdb"); err != nil {
+		t.Fatal("Couldn't load cache from test.rdb:", err)
+	}
+
+	b, found := tr.Get("b")
+	if !found || b.Num != 2 || len(b.Children) != 1 || b.Children[0].Num != 3 {
+		t.Errorf("b recovered wrong: %+v", b)
+	}
+
+	<-time.After(5 * time.Millisecond)
+	if _, found := tr.Get("expired"); found {
+		t.Error("expired was found")
+	}
+}
@@ -0,0 +1,286 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrWrongType is returned by operations of data types if the key holds
+// a value of another type.
+var ErrWrongType = errors.New("rebis: operation against a key holding the wrong kind of value")
+
+/*
+	collection is a value of the data type like Hash, it is changed in place
+	under the shard lock. Values which leave the lock are cloned.
+*/
+type collection interface {
+	length() int
+	clone() interface{}
+}
+
+/*
+	keyWaits keeps channels of operations waiting for writes of keys like
+	BLPop and XRead, every write of the list or the stream sends to channels
+	of its key without waiting.
+*/
+type keyWaits struct {
+	mu   sync.Mutex
+	keys map[string]map[chan struct{}]struct{}
+}
+
+/*
+	Returns the clone of the collection or x itself for other values.
+*/
+func detach(x interface{}) interface{} {
+	if v, ok := x.(collection); ok {
+		return v.clone()
+	}
+
+	return x
+}
+
+/*
+	Read the value of type T of the key under the shard lock, f is called
+	only if the key is found. Returns ErrWrongType if the key holds a value
+	of another type.
+*/
+func readValue[T collection](c *cache, k string, f func(v T)) error {
+	if c.isClosed() {
+		return ErrClosed
+	}
+
+	s := c.shard(k)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, found := s.items[k]
+	if !found || item.Expired() {
+		atomic.AddUint64(&s.misses, 1)
+
+		return nil
+	}
+
+	v, ok := item.Value.(T)
+	if !ok {
+		return fmt.Errorf("item %s: %w", k, ErrWrongType)
+	}
+
+	atomic.AddUint64(&s.hits, 1)
+	item.meta.touch()
+	f(v)
+
+	return nil
+}
+
+/*
+	Change the value of type T of the key in place under the shard lock. f
+	gets the value, zero T if the key is not found, and returns the changed
+	value. Before the change f must call grow with the count of bytes which
+	the change adds. If there is no memory for them, grow returns false and
+	f must return without changes, then items are evicted and f is called
+	again like in put. The value larger than the cache is rejected at once.
+	The new key gets the default expiration, the existing one keeps
+	expiration and tags. The key is deleted when its value becomes empty.
+	The change is logged and published instead of the value if it is not
+	nil, f can resolve its arguments.
+*/
+func changeValue[T collection](c *cache, k string, change *Change, f func(v T, grow func(n int) bool) (T, error)) error {
+	s := c.shard(k)
+
+	for {
+		s.mu.Lock()
+
+		if c.isClosed() {
+			s.mu.Unlock()
+
+			return ErrClosed
+		}
+
+		var v T
+
+		old, found := s.items[k]
+		live := found && !old.Expired()
+		item := Item{Expiration: c.expiration(DefaultExpiration), size: sizeItem + uintptr(len(k))}
+
+		if live {
+			x, ok := old.Value.(T)
+			if !ok {
+				s.mu.Unlock()
+
+				return fmt.Errorf("item %s: %w", k, ErrWrongType)
+			}
+
+			v, item = x, old
+		}
+
+		reserved, size, changed, full := old.size, item.size, false, false
+		grow := func(n int) bool {
+			want := uintptr(int(size) + n)
+			if want > c.maxSize {
+				atomic.AddUint64(&c.rejected, 1)
+
+				return false
+			}
+
+			if !c.resize(reserved, want) {
+				full = true
+
+				return false
+			}
+
+			reserved, size, changed = want, want, true
+
+			return true
+		}
+
+		v, err := f(v, grow)
+		if full {
+			c.resize(reserved, old.size)
+			s.mu.Unlock()
+
+			if c.evict() {
+				continue
+			}
+
+			atomic.AddUint64(&c.rejected, 1)
+
+			return err
+		}
+
+		if err != nil || !changed {
+			s.mu.Unlock()
+
+			return err
+		}
+
+		if v.length() == 0 {
+			var (
+				ov      interface{}
+				evicted bool
+			)
+
+			if live {
+				item.size = reserved
+				s.items[k] = item
+				atomic.AddUint64(&s.deletes, 1)
+				ov, evicted = c.delete(s, k)
+			} else {
+				c.resize(reserved, old.size)
+			}
+
+			s.mu.Unlock()
+			c.awaitAOF()
+
+			if evicted {
+				c.onEvicted(k, ov)
+			}
+
+			return nil
+		}
+
+		item.Value = v
+		item.size = reserved
+		item.version = 0
+		c.place(s, k, item, old, found, change)
+		atomic.AddUint64(&s.sets, 1)
+		s.mu.Unlock()
+		c.awaitAOF()
+
+		return nil
+	}
+}
+
+/*
+	Call try until it returns true or an error, waiting for writes of the
+	keys between calls until ctx is done. The waiter is registered before
+	the first try, so no write between the try and the wait is missed.
+*/
+func (c *cache) block(ctx context.Context, keys []string, try func() (bool, error)) error {
+	wake := make(chan struct{}, 1)
+
+	c.waits.add(keys, wake)
+	defer c.waits.remove(keys, wake)
+
+	for {
+		if c.isClosed() {
+			return ErrClosed
+		}
+
+		if done, err := try(); done || err != nil {
+			return err
+		}
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (w *keyWaits) add(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.keys == nil {
+		w.keys = make(map[string]map[chan struct{}]struct{})
+	}
+
+	for _, k := range keys {
+		if w.keys[k] == nil {
+			w.keys[k] = make(map[chan struct{}]struct{})
+		}
+
+		w.keys[k][ch] = struct{}{}
+	}
+}
+
+func (w *keyWaits) remove(keys []string, ch chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, k := range keys {
+		delete(w.keys[k], ch)
+
+		if len(w.keys[k]) == 0 {
+			delete(w.keys, k)
+		}
+	}
+}
+
+/*
+	Wake waiters of the key, called under the shard lock by writes of lists
+	and streams.
+*/
+func (w *keyWaits) wake(k string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.keys[k] {
+		notify(ch)
+	}
+}
+
+/*
+	Wake all waiters, called by Close of the cache.
+*/
+func (w *keyWaits) wakeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, chans := range w.keys {
+		for ch := range chans {
+			notify(ch)
+		}
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
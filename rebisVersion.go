@@ -0,0 +1,124 @@
+package rebis
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrVersionMismatch is returned by CompareAndSwap and CompareAndDelete if
+// the item has another version.
+var ErrVersionMismatch = errors.New("rebis: version mismatch")
+
+/*
+	Version returns the version of the item. Every write of the value gives
+	the item a new version greater than versions of all items written before,
+	changes of expiration keep it.
+*/
+func (item Item) Version() uint64 {
+	return item.version
+}
+
+/*
+	GetWithVersion returns an item and its version from the cache. It returns
+	the item or nil, the version and a bool indicating whether the key was
+	found.
+*/
+func (c *cache) GetWithVersion(k string) (interface{}, uint64, bool) {
+	item, found := c.get(k)
+	if !found {
+		return nil, 0, false
+	}
+
+	c.logIf("get with version %s -> %v <- %d", k, item.Value, item.version)
+
+	return item.Value, item.version, true
+}
+
+/*
+	CompareAndSwap replaces the item only if it has the version, so writes of
+	other clients since GetWithVersion are not lost. Returns an error if the
+	item is not found and ErrVersionMismatch if the version is changed. The
+	duration is used like in Set.
+*/
+func (c *cache) CompareAndSwap(k string, version uint64, x interface{}, d time.Duration) error {
+	err := c.put(c.shard(k), k, c.newItem(k, x, d), func(old Item, found bool) error {
+		return checkVersion(k, old, found, version)
+	})
+	if err != nil {
+		return err
+	}
+
+	c.logIf("compare and swap %s -> %v <- %s, version %d", k, x, d, version)
+
+	return nil
+}
+
+/*
+	CompareAndDelete deletes the item only if it has the version. Returns an
+	error if the item is not found and ErrVersionMismatch if the version is
+	changed. The deleted item is passed to the OnEvicted function.
+*/
+func (c *cache) CompareAndDelete(k string, version uint64) error {
+	s := c.shard(k)
+	s.mu.Lock()
+
+	if c.isClosed() {
+		s.mu.Unlock()
+
+		return ErrClosed
+	}
+
+	old, found := s.items[k]
+	if err := checkVersion(k, old, found, version); err != nil {
+		s.mu.Unlock()
+
+		return err
+	}
+
+	atomic.AddUint64(&s.deletes, 1)
+	v, evicted := c.delete(s, k)
+	s.mu.Unlock()
+	c.awaitAOF()
+
+	if evicted {
+		c.onEvicted(k, v)
+	}
+
+	c.logIf("compare and delete %s -> %v, version %d", k, v, version)
+
+	return nil
+}
+
+/*
+	Check that the current item is found and has the version.
+*/
+func checkVersion(k string, old Item, found bool, version uint64) error {
+	if !found || old.Expired() {
+		return fmt.Errorf("item %s not found", k)
+	}
+
+	if old.version != version {
+		return fmt.Errorf("item %s has version %d, not %d: %w", k, old.version, version, ErrVersionMismatch)
+	}
+
+	return nil
+}
+
+func (c *cache) nextVersion() uint64 {
+	return atomic.AddUint64(&c.version, 1)
+}
+
+/*
+	Raise the last version to the version of the recovered item, so new
+	versions are greater than it.
+*/
+func (c *cache) seeVersion(version uint64) {
+	for {
+		last := atomic.LoadUint64(&c.version)
+		if last >= version || atomic.CompareAndSwapUint64(&c.version, last, version) {
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package rebis
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVersion(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	if _, _, found := tc.GetWithVersion("a"); found {
+		t.Error("version of missing key is found")
+	}
+
+	tc.Set("a", 1, DefaultExpiration)
+	_, v1, _ := tc.GetWithVersion("a")
+	tc.Set("b", 1, DefaultExpiration)
+	tc.Increment("a", 1)
+	x, v2, found := tc.GetWithVersion("a")
+	if !found || x != 2 || v2 <= v1 {
+		t.Errorf("version is not changed by increment: %d, %d", v1, v2)
+	}
+
+	tc.Expire("a", time.Hour)
+	if _, v, _ := tc.GetWithVersion("a"); v != v2 {
+		t.Errorf("version is changed by expire: %d, %d", v2, v)
+	}
+
+	tc.Delete("a")
+	tc.Set("a", 2, DefaultExpiration)
+	if _, v, _ := tc.GetWithVersion("a"); v <= v2 {
+		t.Errorf("version of added again item is not greater: %d, %d", v2, v)
+	}
+	if item := tc.Items()["b"]; item.Version() == 0 {
+		t.Error("version of b is 0")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	if err := tc.CompareAndSwap("a", 1, 1, DefaultExpiration); err == nil || errors.Is(err, ErrVersionMismatch) {
+		t.Error("compare and swap of missing key:", err)
+	}
+
+	tc.Set("a", 1, DefaultExpiration)
+	_, v, _ := tc.GetWithVersion("a")
+	if err := tc.CompareAndSwap("a", v, 2, DefaultExpiration); err != nil {
+		t.Fatal("Couldn't compare and swap a:", err)
+	}
+	if err := tc.CompareAndSwap("a", v, 3, DefaultExpiration); !errors.Is(err, ErrVersionMismatch) {
+		t.Error("compare and swap with old version:", err)
+	}
+	if x, _ := tc.Get("a"); x != 2 {
+		t.Errorf("a is %v after compare and swap", x)
+	}
+
+	var evicted []string
+	tc.OnEvicted(func(k string, v interface{}) {
+		evicted = append(evicted, k)
+	})
+	if err := tc.CompareAndDelete("a", v); !errors.Is(err, ErrVersionMismatch) {
+		t.Error("compare and delete with old version:", err)
+	}
+	_, v, _ = tc.GetWithVersion("a")
+	if err := tc.CompareAndDelete("a", v); err != nil {
+		t.Error("Couldn't compare and delete a:", err)
+	}
+	if _, found := tc.Get("a"); found || len(evicted) != 1 {
+		t.Errorf("a is not deleted by compare and delete: %v", evicted)
+	}
+	if err := tc.CompareAndDelete("a", v); err == nil {
+		t.Error("compare and delete of missing key")
+	}
+}
+
+func TestCompareAndSwapConcurrent(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("n", 0, DefaultExpiration)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for {
+					x, v, _ := tc.GetWithVersion("n")
+					if err := tc.CompareAndSwap("n", v, x.(int)+1, DefaultExpiration); err == nil {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if x, _ := tc.Get("n"); x != 800 {
+		t.Errorf("writes are lost by compare and swap: %v", x)
+	}
+}
+
+func TestVersionBackup(t *testing.T) {
+	tc, _ := NewCache(configDefault())
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Set("a", 2, DefaultExpiration)
+	_, v, _ := tc.GetWithVersion("a")
+
+	filename := filepath.Join(t.TempDir(), "test.rdb")
+	if err := tc.BackupSaveFile(filename); err != nil {
+		t.Fatal("Couldn't save backup:", err)
+	}
+
+	tr, _ := NewCache(configDefault())
+	if err := tr.BackupRecoveryFile(filename); err != nil {
+		t.Fatal("Couldn't recover backup:", err)
+	}
+	if err := tr.CompareAndSwap("a", v, 3, DefaultExpiration); err != nil {
+		t.Error("version is not recovered:", err)
+	}
+	tr.Set("b", 1, DefaultExpiration)
+	if _, vb, _ := tr.GetWithVersion("b"); vb <= v {
+		t.Errorf("new version %d is not greater than recovered %d", vb, v)
+	}
+
+	tf, _ := NewCacheFrom(configDefault(), tc.Items())
+	if _, vf, _ := tf.GetWithVersion("a"); vf != v {
+		t.Errorf("version of NewCacheFrom is %d, not %d", vf, v)
+	}
+}
+
+func TestVersionAOF(t *testing.T) {
+	conf := aofConfig(t, FsyncAlways)
+	tc, _ := NewCache(conf)
+	tc.Set("a", 1, DefaultExpiration)
+	tc.Increment("a", 1)
+	tc.Expire("a", time.Hour)
+	_, v, _ := tc.GetWithVersion("a")
+
+	tr := reopenAOF(t, tc, conf)
+	if _, vr, _ := tr.GetWithVersion("a"); vr != v {
+		t.Errorf("version is not replayed: %d, not %d", vr, v)
+	}
+	tr.RewriteAOF()
+
+	tr = reopenAOF(t, tr, conf)
+	if err := tr.CompareAndDelete("a", v); err != nil {
+		t.Error("version is lost after rewrite:", err)
+	}
+	tr.Close(context.Background())
+}
+
+func TestTypedVersion(t *testing.T) {
+	tc, _ := NewTypedCache[string, int](configDefault())
+	tc.Set("a", 1, DefaultExpiration)
+
+	x, v, found := tc.GetWithVersion("a")
+	if !found || x != 1 {
+		t.Fatalf("typed get with version is wrong: %d %v", x, found)
+	}
+	if err := tc.CompareAndSwap("a", v, 2, DefaultExpiration); err != nil {
+		t.Error("Couldn't compare and swap typed a:", err)
+	}
+	if err := tc.CompareAndDelete("a", v); !errors.Is(err, ErrVersionMismatch) {
+		t.Error("typed compare and delete with old version:", err)
+	}
+}
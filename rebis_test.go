@@ -1,6 +1,7 @@
 package rebis
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -122,7 +123,10 @@ func TestCacheTimes(t *testing.T) {
 	tc.Set("a", 1, DefaultExpiration)
 	tc.Set("b", 2, NoExpiration)
 	tc.Set("c", 3, 20*time.Millisecond)
-	tc.set("c", 3, 20*time.Millisecond)
+	s := tc.shard("c")
+	s.mu.Lock()
+	tc.set(s, "c", 3, 20*time.Millisecond)
+	s.mu.Unlock()
 	tc.Set("d", 4, 80*time.Millisecond)
 
 	<-time.After(25 * time.Millisecond)
@@ -304,7 +308,7 @@ func TestItems(t *testing.T) {
 		t.Errorf("Items not expired")
 	}
 
-	stopJanitor(tc)
+	tc.Close(context.Background())
 }
 
 func TestLogger(t *testing.T) {
@@ -411,7 +415,7 @@ func TestRunBackup(t *testing.T) {
 	}
 
 	<-time.After(time.Millisecond * 20)
-	stopBackup(tc)
+	tc.Close(context.Background())
 }
 
 func TestConfig(t *testing.T) {
@@ -453,16 +457,53 @@ func TestBackupEmptySlot(t *testing.T) {
 	for i := 0; i < 100; i++ {
 		tc.Set("foo"+strconv.Itoa(i), i, 0)
 	}
-	tc.BackupSaveFile("test.json")
+	tc.BackupSaveFile("test.rdb")
 
 	conf.Size = 1
 	tc, _ = NewCache(conf)
-	err := tc.BackupRecoveryFile("test.json")
+	err := tc.BackupRecoveryFile("test.rdb")
 	if err.Error() != "no empty slot, for next items" {
 		t.Errorf("no recover empty memmory")
 	}
 }
 
+func TestShards(t *testing.T) {
+	conf := configDefault()
+	conf.Shards = 5
+	tc, err := NewCache(conf)
+	if err != nil {
+		t.Error("err with default config")
+	}
+	if len(tc.shards) != 8 {
+		t.Errorf("shards count is not rounded to 8: %d", len(tc.shards))
+	}
+	for i := 0; i < 1000; i++ {
+		tc.Set(strconv.Itoa(i), i, DefaultExpiration)
+	}
+	empty := 0
+	for _, s := range tc.shards {
+		if len(s.items) == 0 {
+			empty++
+		}
+	}
+	if empty > 0 {
+		t.Errorf("%d shards are empty", empty)
+	}
+	if n := tc.ItemCount(); n != 1000 {
+		t.Errorf("Item count is not 1000: %d", n)
+	}
+	if n := len(tc.Items()); n != 1000 {
+		t.Errorf("Items count is not 1000: %d", n)
+	}
+	tc.Flush()
+	if n := tc.ItemCount(); n != 0 {
+		t.Errorf("Item count after flush is not 0: %d", n)
+	}
+	if tc.size != 0 {
+		t.Errorf("size after flush is not 0: %d", tc.size)
+	}
+}
+
 func TestCacheBackup(t *testing.T) {
 	ts, err := NewCache(config)
 	if err != nil {
@@ -483,17 +524,17 @@ func testBackupSave(t *testing.T, tc *Cache) {
 	tc.Set("c", "c", DefaultExpiration)
 	tc.Set("expired", "foo", 1*time.Millisecond)
 
-	err := tc.BackupSaveFile("test.json")
+	err := tc.BackupSaveFile("test.rdb")
 	if err != nil {
-		t.Fatal("Couldn't save cache to test.json:", err)
+		t.Fatal("Couldn't save cache to test.rdb:", err)
 	}
 
 }
 
 func testBackupRecovery(t *testing.T, tr *Cache) {
-	err := tr.BackupRecoveryFile("test.json")
+	err := tr.BackupRecoveryFile("test.rdb")
 	if err != nil {
-		t.Fatal("Couldn't load cache from test.json:", err)
+		t.Fatal("Couldn't load cache from test.rdb:", err)
 	}
 	a, found := tr.Get("a")
 	if !found {
@@ -770,6 +811,25 @@ func benchmarkCacheSet(b *testing.B, exp time.Duration) {
 		tc.Set("foo", "bar", DefaultExpiration)
 	}
 }
+
+func BenchmarkCacheSetConcurrent(b *testing.B) {
+	b.StopTimer()
+	conf := configDefault()
+	conf.Size = 1 << 20
+	tc, err := NewCache(conf)
+	if err != nil {
+		b.Errorf("err with default config")
+	}
+	b.StartTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		counter := 0
+		for pb.Next() {
+			tc.Set(key(counter%10000), "bar", DefaultExpiration)
+			counter = counter + 1
+		}
+	})
+}
+
 func BenchmarkFreeCacheSet(b *testing.B) {
 	cache := freecache.NewCache(b.N * maxEntrySize)
 	for i := 0; i < b.N; i++ {
@@ -830,12 +890,13 @@ func BenchmarkCacheSetDeleteSingleLock(b *testing.B) {
 	if err != nil {
 		b.Errorf("err with default config")
 	}
+	s := tc.shard("foo")
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		tc.mu.Lock()
-		tc.set("foo", "bar", DefaultExpiration)
-		tc.delete("foo")
-		tc.mu.Unlock()
+		s.mu.Lock()
+		tc.set(s, "foo", "bar", DefaultExpiration)
+		tc.delete(s, "foo")
+		s.mu.Unlock()
 	}
 }
 
@@ -872,11 +933,13 @@ func BenchmarkDeleteExpiredLoop(b *testing.B) {
 	if err != nil {
 		b.Errorf("err with default config")
 	}
-	tc.mu.Lock()
 	for i := 0; i < 100000; i++ {
-		tc.set(strconv.Itoa(i), "bar", DefaultExpiration)
+		k := strconv.Itoa(i)
+		s := tc.shard(k)
+		s.mu.Lock()
+		tc.set(s, k, "bar", DefaultExpiration)
+		s.mu.Unlock()
 	}
-	tc.mu.Unlock()
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		tc.DeleteExpired()
@@ -0,0 +1,463 @@
+/*
+	Package rest exposes rebis cache over HTTP with JSON bodies, so tools
+	that are not written in Go can inspect and seed the cache.
+
+	Routes:
+
+		GET    /keys/{key}       value of the key with its expiration
+		PUT    /keys/{key}       set the key, JSON body is decoded, any other body is stored as string
+		DELETE /keys/{key}       delete the key
+		POST   /keys/{key}/incr  increment the key by ?by= (1 by default), missing key is created
+		GET    /keys?prefix=     sorted keys with the prefix and glob-style ?match= pattern
+		POST   /flush            delete all items
+		POST   /backup           save backup of the cache
+		GET    /stats            items count, memory usage and counters
+
+	TTL for PUT and incr of missing key is taken from ?ttl= query or
+	X-Rebis-TTL header, as Go duration ("1m30s") or integer seconds. Keys
+	with '/' must be escaped as %2F.
+*/
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmpavl/rebis"
+)
+
+const (
+	maxBodySize = 32 * 1024 * 1024
+	ttlHeader   = "X-Rebis-TTL"
+	incrSuffix  = "/incr"
+	incrRetries = 3
+)
+
+/*
+	Handler serves the cache over HTTP.
+*/
+type Handler struct {
+	cache      *rebis.Cache
+	logger     rebis.Logger
+	backupPath string
+}
+
+type itemResponse struct {
+	Key        string      `json:"key"`
+	Value      interface{} `json:"value"`
+	Expiration *time.Time  `json:"expiration,omitempty"`
+}
+
+type keysResponse struct {
+	Keys []string `json:"keys"`
+}
+
+type statsResponse struct {
+	Items          int        `json:"items"`
+	MemoryUsed     uintptr    `json:"memoryUsed"`
+	MemoryLimit    uintptr    `json:"memoryLimit"`
+	Hits           uint64     `json:"hits"`
+	Misses         uint64     `json:"misses"`
+	HitRatio       float64    `json:"hitRatio"`
+	Sets           uint64     `json:"sets"`
+	Deletes        uint64     `json:"deletes"`
+	Expirations    uint64     `json:"expirations"`
+	Evictions      uint64     `json:"evictions"`
+	Rejected       uint64     `json:"rejected"`
+	Backups        uint64     `json:"backups"`
+	BackupFailures uint64     `json:"backupFailures"`
+	BackupDuration string     `json:"backupDuration,omitempty"`
+	LastBackup     *time.Time `json:"lastBackup,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+/*
+	New create handler for the cache with default logger (stdout).
+*/
+func New(c *rebis.Cache) *Handler {
+	return &Handler{
+		cache:  c,
+		logger: rebis.DefaultLogger(),
+	}
+}
+
+/*
+	ChangeLogger override the logger of the handler if it is not nil.
+*/
+func (h *Handler) ChangeLogger(custom rebis.Logger) {
+	if custom != nil {
+		h.logger = custom
+	}
+}
+
+/*
+	ChangeBackupPath set the file for POST /backup, by default the backup
+	path of the cache config is used. The path is never taken from the
+	request.
+*/
+func (h *Handler) ChangeBackupPath(path string) {
+	h.backupPath = path
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+
+	switch {
+	case path == "/keys":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.keys})
+	case strings.HasPrefix(path, "/keys/"):
+		h.routeKey(w, r, strings.TrimPrefix(path, "/keys/"))
+	case path == "/flush":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodPost: h.flush})
+	case path == "/backup":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodPost: h.backup})
+	case path == "/stats":
+		h.route(w, r, map[string]http.HandlerFunc{http.MethodGet: h.stats})
+	default:
+		h.error(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *Handler) route(w http.ResponseWriter, r *http.Request, methods map[string]http.HandlerFunc) {
+	if f, found := methods[r.Method]; found {
+		f(w, r)
+
+		return
+	}
+
+	allowed := make([]string, 0, len(methods))
+	for m := range methods {
+		allowed = append(allowed, m)
+	}
+
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	h.error(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (h *Handler) routeKey(w http.ResponseWriter, r *http.Request, escaped string) {
+	incr := strings.HasSuffix(escaped, incrSuffix)
+	if incr {
+		escaped = strings.TrimSuffix(escaped, incrSuffix)
+	}
+
+	k, err := url.PathUnescape(escaped)
+	if err != nil || k == "" {
+		h.error(w, http.StatusBadRequest, "invalid key")
+
+		return
+	}
+
+	if incr {
+		h.route(w, r, map[string]http.HandlerFunc{
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { h.incr(w, r, k) },
+		})
+
+		return
+	}
+
+	h.route(w, r, map[string]http.HandlerFunc{
+		http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { h.get(w, k) },
+		http.MethodPut:    func(w http.ResponseWriter, r *http.Request) { h.put(w, r, k) },
+		http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { h.delete(w, k) },
+	})
+}
+
+func (h *Handler) get(w http.ResponseWriter, k string) {
+	v, exp, found := h.cache.GetWithExpiration(k)
+	if !found {
+		h.error(w, http.StatusNotFound, fmt.Sprintf("item %s not found", k))
+
+		return
+	}
+
+	h.json(w, http.StatusOK, newItemResponse(k, v, exp))
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, k string) {
+	d, err := ttl(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	v, err := decodeValue(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	if err := h.cache.Set(k, v, d); err != nil {
+		h.writeError(w, err)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, k string) {
+	if h.cache.DeleteMulti([]string{k}) == 0 {
+		h.error(w, http.StatusNotFound, fmt.Sprintf("item %s not found", k))
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+	Increment the key by integer or float from ?by=, the type of the value is
+	kept. Missing key is created with the increment as value.
+*/
+func (h *Handler) incr(w http.ResponseWriter, r *http.Request, k string) {
+	d, err := ttl(r)
+	if err != nil {
+		h.error(w, http.StatusBadRequest, err.Error())
+
+		return
+	}
+
+	by := r.URL.Query().Get("by")
+	if by == "" {
+		by = "1"
+	}
+
+	var (
+		value     interface{}
+		increment func() error
+	)
+
+	if n, err := strconv.ParseInt(by, 10, 64); err == nil {
+		value, increment = n, func() error { return h.cache.Increment(k, n) }
+	} else if f, err := strconv.ParseFloat(by, 64); err == nil {
+		value, increment = f, func() error { return h.cache.IncrementFloat(k, f) }
+	} else {
+		h.error(w, http.StatusBadRequest, "by is not a number")
+
+		return
+	}
+
+	for i := 0; ; i++ {
+		err := increment()
+		if err == nil {
+			break
+		}
+
+		if _, found := h.cache.Get(k); found {
+			h.error(w, http.StatusConflict, err.Error())
+
+			return
+		}
+
+		if err = h.cache.Add(k, value, d); err == nil {
+			break
+		}
+
+		if i == incrRetries {
+			h.writeError(w, err)
+
+			return
+		}
+	}
+
+	h.get(w, k)
+}
+
+func (h *Handler) keys(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	keys := []string{}
+
+	for _, k := range h.cache.Keys(r.URL.Query().Get("match")) {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	h.json(w, http.StatusOK, keysResponse{Keys: keys})
+}
+
+func (h *Handler) flush(w http.ResponseWriter, r *http.Request) {
+	h.cache.Flush()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) backup(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if h.backupPath != "" {
+		err = h.cache.BackupSaveFile(h.backupPath)
+	} else {
+		err = h.cache.BackupSave()
+	}
+
+	if err != nil {
+		h.logger.Printf("rebis rest backup: %s", err)
+		h.error(w, http.StatusInternalServerError, err.Error())
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	st := h.cache.Stats()
+	resp := statsResponse{
+		Items:          st.Items,
+		MemoryUsed:     st.MemoryUsed,
+		MemoryLimit:    st.MemoryLimit,
+		Hits:           st.Hits,
+		Misses:         st.Misses,
+		HitRatio:       st.HitRatio(),
+		Sets:           st.Sets,
+		Deletes:        st.Deletes,
+		Expirations:    st.Expirations,
+		Evictions:      st.Evictions,
+		Rejected:       st.Rejected,
+		Backups:        st.Backups,
+		BackupFailures: st.BackupFailures,
+	}
+
+	if !st.LastBackup.IsZero() {
+		resp.BackupDuration = st.BackupDuration.String()
+		resp.LastBackup = &st.LastBackup
+	}
+
+	h.json(w, http.StatusOK, resp)
+}
+
+func (h *Handler) json(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Printf("rebis rest write response: %s", err)
+	}
+}
+
+func (h *Handler) error(w http.ResponseWriter, code int, msg string) {
+	h.json(w, code, errorResponse{Error: msg})
+}
+
+/*
+	Reply the error of a write: 503 for the closed cache, 400 for the value
+	which can't be stored and 507 for the value which has no memory.
+*/
+func (h *Handler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, rebis.ErrClosed):
+		h.error(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, rebis.ErrNotRegistered):
+		h.error(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, rebis.ErrNoMemory):
+		h.error(w, http.StatusInsufficientStorage, err.Error())
+	default:
+		h.error(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func newItemResponse(k string, v interface{}, exp time.Time) itemResponse {
+	resp := itemResponse{Key: k, Value: v}
+	if exp.UnixNano() > 0 {
+		resp.Expiration = &exp
+	}
+
+	return resp
+}
+
+/*
+	TTL of the request from query or header, DefaultExpiration if not set.
+*/
+func ttl(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("ttl")
+	if s == "" {
+		s = r.Header.Get(ttlHeader)
+	}
+
+	if s == "" {
+		return rebis.DefaultExpiration, nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n > 0 {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+
+	return 0, fmt.Errorf("invalid ttl %s", s)
+}
+
+/*
+	Decode value from body of the request: JSON if content type is JSON,
+	whole numbers become int64 so they can be incremented, other bodies are
+	stored as string.
+*/
+func decodeValue(r *http.Request) (interface{}, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err != nil {
+		return nil, err
+	}
+
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/json" {
+		return string(body), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+
+	if dec.More() {
+		return nil, errors.New("invalid json: more than one value")
+	}
+
+	return number(v), nil
+}
+
+/*
+	Replace json.Number in the decoded value with int64 or float64.
+*/
+func number(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := x.Float64()
+
+		return f
+	case []interface{}:
+		for i := range x {
+			x[i] = number(x[i])
+		}
+	case map[string]interface{}:
+		for k := range x {
+			x[k] = number(x[k])
+		}
+	}
+
+	return v
+}
@@ -0,0 +1,240 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmpavl/rebis"
+)
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Printf(format string, v ...interface{}) {
+	l.t.Logf(format, v...)
+}
+
+func newHandler(t *testing.T) (*Handler, *rebis.Cache) {
+	c, err := rebis.NewCache(&rebis.Config{Size: rebis.DefaultSize})
+	if err != nil {
+		t.Fatal("err with config:", err)
+	}
+
+	h := New(c)
+	h.ChangeLogger(testLogger{t})
+
+	return h, c
+}
+
+func do(h http.Handler, method, target, contentType, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	return w
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatal("err with decode response:", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	h, c := newHandler(t)
+
+	if w := do(h, http.MethodGet, "/keys/a", "", ""); w.Code != http.StatusNotFound {
+		t.Error("GET of missing key:", w.Code)
+	}
+	if w := do(h, http.MethodPut, "/keys/a", "text/plain", "hello"); w.Code != http.StatusNoContent {
+		t.Error("PUT of a:", w.Code, w.Body)
+	}
+	if v, found := c.Get("a"); !found || v != "hello" {
+		t.Error("value of a is wrong:", v)
+	}
+
+	w := do(h, http.MethodGet, "/keys/a", "", "")
+	var item itemResponse
+	decode(t, w, &item)
+	if w.Code != http.StatusOK || item.Key != "a" || item.Value != "hello" || item.Expiration != nil {
+		t.Errorf("GET of a is wrong: %d %+v", w.Code, item)
+	}
+
+	do(h, http.MethodPut, "/keys/user%2F1?ttl=1m", "application/json", `{"name":"bob","age":30}`)
+	v, exp, found := c.GetWithExpiration("user/1")
+	if m, ok := v.(map[string]interface{}); !found || !ok || m["name"] != "bob" || m["age"] != int64(30) {
+		t.Errorf("json value of user/1 is wrong: %#v", v)
+	}
+	if d := time.Until(exp); d <= 0 || d > time.Minute {
+		t.Error("ttl of user/1 is wrong:", d)
+	}
+
+	r := httptest.NewRequest(http.MethodPut, "/keys/n", strings.NewReader("42"))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Header.Set(ttlHeader, "10")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if v, exp, _ := c.GetWithExpiration("n"); v != int64(42) || time.Until(exp) > 10*time.Second {
+		t.Errorf("value of n is wrong: %#v %s", v, exp)
+	}
+
+	if w := do(h, http.MethodPut, "/keys/b?ttl=-1", "", "x"); w.Code != http.StatusBadRequest {
+		t.Error("PUT with invalid ttl:", w.Code)
+	}
+	if w := do(h, http.MethodPut, "/keys/b", "application/json", "{"); w.Code != http.StatusBadRequest {
+		t.Error("PUT with invalid json:", w.Code)
+	}
+	if w := do(h, http.MethodPost, "/keys/a", "", ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") == "" {
+		t.Error("POST of a:", w.Code, w.Header())
+	}
+
+	hits := c.Stats().Hits
+	if w := do(h, http.MethodDelete, "/keys/a", "", ""); w.Code != http.StatusNoContent {
+		t.Error("DELETE of a:", w.Code)
+	}
+	if w := do(h, http.MethodDelete, "/keys/a", "", ""); w.Code != http.StatusNotFound {
+		t.Error("DELETE of missing a:", w.Code)
+	}
+	if st := c.Stats(); st.Hits != hits {
+		t.Errorf("DELETE is counted as %d hits", st.Hits-hits)
+	}
+}
+
+func TestPutErrors(t *testing.T) {
+	h, c := newHandler(t)
+
+	if w := do(h, http.MethodPut, "/keys/big", "text/plain", strings.Repeat("x", 2<<20)); w.Code != http.StatusInsufficientStorage {
+		t.Error("PUT larger than the cache:", w.Code, w.Body)
+	}
+
+	// values of JSON bodies are always registered, so the error of the cache is replied directly
+	type unregistered struct{ A int }
+	ac, err := rebis.NewCache(&rebis.Config{
+		Size:   rebis.DefaultSize,
+		Backup: rebis.Backup{AOF: true, AOFPath: filepath.Join(t.TempDir(), "test.aof")},
+	})
+	if err != nil {
+		t.Fatal("err with aof config:", err)
+	}
+	defer ac.Close(context.Background())
+	w := httptest.NewRecorder()
+	h.writeError(w, ac.Set("u", unregistered{1}, rebis.DefaultExpiration))
+	if w.Code != http.StatusBadRequest {
+		t.Error("value of not registered type:", w.Code, w.Body)
+	}
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal("err with close:", err)
+	}
+	if w := do(h, http.MethodPut, "/keys/a", "text/plain", "x"); w.Code != http.StatusServiceUnavailable {
+		t.Error("PUT to the closed cache:", w.Code, w.Body)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	h, c := newHandler(t)
+
+	w := do(h, http.MethodPost, "/keys/n/incr", "", "")
+	var item itemResponse
+	decode(t, w, &item)
+	if w.Code != http.StatusOK || item.Value != float64(1) {
+		t.Errorf("incr of missing n is wrong: %d %+v", w.Code, item)
+	}
+	do(h, http.MethodPost, "/keys/n/incr?by=-5", "", "")
+	if v, _ := c.Get("n"); v != int64(-4) {
+		t.Errorf("value of n is not -4: %#v", v)
+	}
+
+	c.Set("f", 1.5, rebis.DefaultExpiration)
+	do(h, http.MethodPost, "/keys/f/incr?by=0.25", "", "")
+	if v, _ := c.Get("f"); v != 1.75 {
+		t.Errorf("value of f is not 1.75: %#v", v)
+	}
+
+	c.Set("s", "str", rebis.DefaultExpiration)
+	if w := do(h, http.MethodPost, "/keys/s/incr", "", ""); w.Code != http.StatusConflict {
+		t.Error("incr of string:", w.Code)
+	}
+	if w := do(h, http.MethodPost, "/keys/n/incr?by=x", "", ""); w.Code != http.StatusBadRequest {
+		t.Error("incr by not a number:", w.Code)
+	}
+}
+
+func TestKeysFlushStats(t *testing.T) {
+	h, c := newHandler(t)
+
+	for _, k := range []string{"user:2", "user:1", "post:1"} {
+		c.Set(k, "v", rebis.DefaultExpiration)
+	}
+
+	var keys keysResponse
+	decode(t, do(h, http.MethodGet, "/keys?prefix=user:", "", ""), &keys)
+	if strings.Join(keys.Keys, ",") != "user:1,user:2" {
+		t.Error("keys with prefix are wrong:", keys.Keys)
+	}
+	decode(t, do(h, http.MethodGet, "/keys?match=*:1", "", ""), &keys)
+	if strings.Join(keys.Keys, ",") != "post:1,user:1" {
+		t.Error("keys with match are wrong:", keys.Keys)
+	}
+
+	var stats statsResponse
+	decode(t, do(h, http.MethodGet, "/stats", "", ""), &stats)
+	if stats.Items != 3 || stats.MemoryUsed != c.MemoryUsed() || stats.MemoryLimit != c.MemoryLimit() || stats.Sets != 3 {
+		t.Errorf("stats are wrong: %+v", stats)
+	}
+
+	if w := do(h, http.MethodPost, "/flush", "", ""); w.Code != http.StatusNoContent {
+		t.Error("flush:", w.Code)
+	}
+	decode(t, do(h, http.MethodGet, "/keys", "", ""), &keys)
+	if len(keys.Keys) != 0 {
+		t.Error("keys after flush:", keys.Keys)
+	}
+
+	if w := do(h, http.MethodGet, "/unknown", "", ""); w.Code != http.StatusNotFound {
+		t.Error("unknown path:", w.Code)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	h, c := newHandler(t)
+	c.Set("a", "v", rebis.DefaultExpiration)
+	do(h, http.MethodPut, "/keys/json", "application/json", `{"list":[1,2.5,"x"]}`)
+
+	if w := do(h, http.MethodPost, "/backup", "", ""); w.Code != http.StatusInternalServerError {
+		t.Error("backup without path:", w.Code)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "backup*.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	h.ChangeBackupPath(f.Name())
+	if w := do(h, http.MethodPost, "/backup", "", ""); w.Code != http.StatusNoContent {
+		t.Error("backup:", w.Code, w.Body)
+	}
+
+	tr, _ := newHandler(t)
+	if err := tr.cache.BackupRecoveryFile(f.Name()); err != nil {
+		t.Fatal("Couldn't load backup:", err)
+	}
+	if v, found := tr.cache.Get("a"); !found || v != "v" {
+		t.Error("a is not recovered from backup:", v)
+	}
+	if v, found := tr.cache.Get("json"); !found || v.(map[string]interface{})["list"].([]interface{})[0] != int64(1) {
+		t.Errorf("json is not recovered from backup: %#v", v)
+	}
+}
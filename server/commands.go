@@ -0,0 +1,873 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmpavl/rebis"
+)
+
+const (
+	errSyntax       = "ERR syntax error"
+	errNotInteger   = "ERR value is not an integer or out of range"
+	errNotFloat     = "ERR value is not a valid float"
+	errOverflow     = "ERR increment or decrement would overflow"
+	errExpireTime   = "ERR invalid expire time in '%s' command"
+	errConflict     = "ERR the key is changed by other clients, try again"
+	redisVersion    = "7.0.0" // version of Redis which commands are compatible with
+	protoVersion2   = 2
+	protoVersion3   = 3
+	ttlNotFound     = -2
+	ttlNoExpiration = -1
+	maxRetries      = 100 // of the read and the write of a key changed by other clients
+)
+
+/*
+	command is a handler with arity like in Redis: positive arity is exact
+	count of arguments with the name, negative is the minimum count.
+*/
+type command struct {
+	arity   int
+	handler func(c *conn, args []string)
+}
+
+var commands = map[string]command{
+	"ping":        {-1, cmdPing},
+	"echo":        {2, cmdEcho},
+	"hello":       {-1, cmdHello},
+	"select":      {2, cmdSelect},
+	"client":      {-2, cmdClient},
+	"command":     {-1, cmdCommand},
+	"get":         {2, cmdGet},
+	"set":         {-3, cmdSet},
+	"mget":        {-2, cmdMGet},
+	"mset":        {-3, cmdMSet},
+	"msetnx":      {-3, cmdMSetNX},
+	"del":         {-2, cmdDel},
+	"exists":      {-2, cmdExists},
+	"incr":        {2, cmdIncr},
+	"decr":        {2, cmdDecr},
+	"incrby":      {3, cmdIncrBy},
+	"decrby":      {3, cmdDecrBy},
+	"incrbyfloat": {3, cmdIncrByFloat},
+	"expire":      {3, cmdExpire},
+	"pexpire":     {3, cmdPExpire},
+	"expireat":    {3, cmdExpireAt},
+	"pexpireat":   {3, cmdPExpireAt},
+	"persist":     {2, cmdPersist},
+	"ttl":         {2, cmdTTL},
+	"pttl":        {2, cmdPTTL},
+	"flushall":    {-1, cmdFlush},
+	"flushdb":     {-1, cmdFlush},
+	"dbsize":      {1, cmdDBSize},
+	"keys":        {2, cmdKeys},
+	"scan":        {-2, cmdScan},
+}
+
+func cmdPing(c *conn, args []string) {
+	switch len(args) {
+	case 0:
+		c.w.simple("PONG")
+	case 1:
+		c.w.bulk(args[0])
+	default:
+		c.w.error("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func cmdEcho(c *conn, args []string) {
+	c.w.bulk(args[0])
+}
+
+/*
+	HELLO [protover [AUTH username password] [SETNAME clientname]]
+*/
+func cmdHello(c *conn, args []string) {
+	proto := c.w.proto
+
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil {
+			c.w.error("ERR Protocol version is not an integer or out of range")
+
+			return
+		}
+
+		if v != protoVersion2 && v != protoVersion3 {
+			c.w.error("NOPROTO unsupported protocol version")
+
+			return
+		}
+
+		proto = v
+	}
+
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "auth":
+			i += 2
+		case "setname":
+			if i+1 >= len(args) {
+				c.w.error(errSyntax)
+
+				return
+			}
+
+			i++
+			c.name = args[i]
+		default:
+			c.w.error(errSyntax)
+
+			return
+		}
+	}
+
+	c.w.proto = proto
+	c.w.mapHeader(7)
+	c.w.bulk("server")
+	c.w.bulk("rebis")
+	c.w.bulk("version")
+	c.w.bulk(redisVersion)
+	c.w.bulk("proto")
+	c.w.integer(int64(proto))
+	c.w.bulk("id")
+	c.w.integer(0)
+	c.w.bulk("mode")
+	c.w.bulk("standalone")
+	c.w.bulk("role")
+	c.w.bulk("master")
+	c.w.bulk("modules")
+	c.w.array(0)
+}
+
+func cmdSelect(c *conn, args []string) {
+	if args[0] != "0" {
+		c.w.error("ERR DB index is out of range")
+
+		return
+	}
+
+	c.w.simple("OK")
+}
+
+func cmdClient(c *conn, args []string) {
+	switch strings.ToLower(args[0]) {
+	case "setname":
+		if len(args) != 2 {
+			c.w.error(errSyntax)
+
+			return
+		}
+
+		c.name = args[1]
+		c.w.simple("OK")
+	case "getname":
+		if c.name == "" {
+			c.w.null()
+		} else {
+			c.w.bulk(c.name)
+		}
+	case "setinfo":
+		c.w.simple("OK")
+	default:
+		c.w.error("ERR unknown subcommand '" + args[0] + "'")
+	}
+}
+
+/*
+	COMMAND replies with empty list, clients use it only for optional docs.
+*/
+func cmdCommand(c *conn, args []string) {
+	c.w.array(0)
+}
+
+func cmdGet(c *conn, args []string) {
+	v, found := c.srv.cache.Get(args[0])
+	if !found {
+		c.w.null()
+
+		return
+	}
+
+	c.w.bulk(format(v))
+}
+
+/*
+	SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | KEEPTTL]
+*/
+func cmdSet(c *conn, args []string) {
+	var (
+		k, v              = args[0], args[1]
+		d                 = rebis.DefaultExpiration
+		nx, xx, get, keep bool
+		expire            bool
+	)
+
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); opt {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "get":
+			get = true
+		case "keepttl":
+			keep = true
+		case "ex", "px":
+			if expire || i+1 >= len(args) {
+				c.w.error(errSyntax)
+
+				return
+			}
+
+			i++
+
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				c.w.error(errNotInteger)
+
+				return
+			}
+
+			if n <= 0 || n > math.MaxInt64/int64(time.Second) {
+				c.w.error(fmt.Sprintf(errExpireTime, "set"))
+
+				return
+			}
+
+			expire = true
+			if opt == "ex" {
+				d = time.Duration(n) * time.Second
+			} else {
+				d = time.Duration(n) * time.Millisecond
+			}
+		default:
+			c.w.error(errSyntax)
+
+			return
+		}
+	}
+
+	if (nx && xx) || (keep && expire) {
+		c.w.error(errSyntax)
+
+		return
+	}
+
+	if get || keep {
+		c.setWatched(k, v, d, nx, xx, get, keep)
+
+		return
+	}
+
+	var err error
+
+	switch {
+	case nx:
+		err = c.srv.cache.Add(k, v, d)
+	case xx:
+		err = c.srv.cache.Replace(k, v, d)
+	default:
+		err = c.srv.cache.Set(k, v, d)
+	}
+
+	if err != nil {
+		// Add and Replace fail by the condition or by memory
+		if (nx || xx) && !errors.Is(err, rebis.ErrClosed) && c.exists(k) == nx {
+			c.w.null()
+		} else {
+			c.w.error("ERR " + err.Error())
+		}
+
+		return
+	}
+
+	c.w.simple("OK")
+}
+
+/*
+	SET with GET or KEEPTTL reads the old item first. The write is done by
+	CompareAndSwap of the read version, it is retried if the key is changed
+	after the read.
+*/
+func (c *conn) setWatched(k, v string, d time.Duration, nx, xx, get, keep bool) {
+	c.retry(func() bool {
+		old, version, ttl, found := c.read(k)
+		if (nx && found) || (xx && !found) {
+			c.w.null()
+
+			return true
+		}
+
+		if keep && found {
+			d = ttl
+		}
+
+		done, err := c.swap(k, found, version, v, d)
+		if !done {
+			return false
+		}
+
+		if err != nil {
+			c.w.error("ERR " + err.Error())
+
+			return true
+		}
+
+		switch {
+		case !get:
+			c.w.simple("OK")
+		case found:
+			c.w.bulk(format(old))
+		default:
+			c.w.null()
+		}
+
+		return true
+	})
+}
+
+/*
+	Run the read and the write of the key until try returns true, try
+	returns false if the key is changed after the read. The client gets an
+	error after maxRetries tries.
+*/
+func (c *conn) retry(try func() bool) {
+	for i := 0; i < maxRetries; i++ {
+		if try() {
+			return
+		}
+	}
+
+	c.w.error(errConflict)
+}
+
+/*
+	Read the unexpired key with its version and the duration which keeps its
+	expiration. The duration is read by TTL, so it is the expiration after
+	the slide of the read and not the one before.
+*/
+func (c *conn) read(k string) (interface{}, uint64, time.Duration, bool) {
+	v, version, found := c.srv.cache.GetWithVersion(k)
+	if !found {
+		return nil, 0, rebis.DefaultExpiration, false
+	}
+
+	return v, version, c.srv.cache.TTL(k), true
+}
+
+/*
+	Write x to the key read at the version, the missing key is added.
+	Returns false if the key is changed after the read and the write must
+	be retried.
+*/
+func (c *conn) swap(k string, found bool, version uint64, x interface{}, d time.Duration) (bool, error) {
+	var err error
+	if found {
+		err = c.srv.cache.CompareAndSwap(k, version, x, d)
+	} else {
+		err = c.srv.cache.Add(k, x, d)
+	}
+
+	if err == nil || errors.Is(err, rebis.ErrClosed) {
+		return true, err
+	}
+
+	// CompareAndSwap and Add fail by the change of the key or by memory
+	if errors.Is(err, rebis.ErrVersionMismatch) || c.exists(k) != found {
+		return false, nil
+	}
+
+	return true, err
+}
+
+/*
+	Returns true if the unexpired key is found, the read is not counted in
+	stats of the cache.
+*/
+func (c *conn) exists(k string) bool {
+	return c.srv.cache.TTL(k) != rebis.TTLNotFound
+}
+
+func cmdMGet(c *conn, args []string) {
+	values := c.srv.cache.GetMulti(args)
+
+	c.w.array(len(args))
+
+	for _, k := range args {
+		if v, found := values[k]; found {
+			c.w.bulk(format(v))
+		} else {
+			c.w.null()
+		}
+	}
+}
+
+/*
+	MSET key value [key value ...]
+*/
+func cmdMSet(c *conn, args []string) {
+	_, items, ok := c.pairs(args, "mset")
+	if !ok {
+		return
+	}
+
+	if err := c.srv.cache.SetMulti(items, rebis.DefaultExpiration); err != nil {
+		c.w.error("ERR " + err.Error())
+
+		return
+	}
+
+	c.w.simple("OK")
+}
+
+/*
+	MSETNX key value [key value ...]
+*/
+func cmdMSetNX(c *conn, args []string) {
+	keys, items, ok := c.pairs(args, "msetnx")
+	if !ok {
+		return
+	}
+
+	if err := c.srv.cache.SetMultiNX(items, rebis.DefaultExpiration); err != nil {
+		// SetMultiNX fails if any key exists or by memory
+		if !errors.Is(err, rebis.ErrClosed) && len(c.srv.cache.GetMulti(keys)) > 0 {
+			c.w.integer(0)
+		} else {
+			c.w.error("ERR " + err.Error())
+		}
+
+		return
+	}
+
+	c.w.integer(1)
+}
+
+/*
+	Returns keys and items of key value arguments, the last value wins for
+	repeated keys like in Redis.
+*/
+func (c *conn) pairs(args []string, name string) ([]string, map[string]interface{}, bool) {
+	if len(args)%2 != 0 {
+		c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+
+		return nil, nil, false
+	}
+
+	keys := make([]string, 0, len(args)/2)
+	items := make(map[string]interface{}, len(args)/2)
+
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+		items[args[i]] = args[i+1]
+	}
+
+	return keys, items, true
+}
+
+func cmdDel(c *conn, args []string) {
+	c.w.integer(int64(c.srv.cache.DeleteMulti(args)))
+}
+
+func cmdExists(c *conn, args []string) {
+	var n int64
+
+	for _, k := range args {
+		if _, found := c.srv.cache.Get(k); found {
+			n++
+		}
+	}
+
+	c.w.integer(n)
+}
+
+func cmdIncr(c *conn, args []string) {
+	c.incrBy(args[0], 1)
+}
+
+func cmdDecr(c *conn, args []string) {
+	c.incrBy(args[0], -1)
+}
+
+func cmdIncrBy(c *conn, args []string) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.w.error(errNotInteger)
+
+		return
+	}
+
+	c.incrBy(args[0], n)
+}
+
+func cmdDecrBy(c *conn, args []string) {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n == math.MinInt64 {
+		c.w.error(errNotInteger)
+
+		return
+	}
+
+	c.incrBy(args[0], -n)
+}
+
+/*
+	Increment integer value of the key by IncrementFunc, so increments of
+	other users of the cache are not lost and the sum is checked before the
+	write. A missing key is set to n, integer values and numeric strings are
+	replaced by the sum of int64 type.
+*/
+func (c *conn) incrBy(k string, n int64) {
+	var nv int64
+
+	c.increment(k, int64(0), func(x interface{}) (interface{}, error) {
+		cur, ok := toInt(x)
+		if !ok {
+			return nil, errors.New(errNotInteger)
+		}
+
+		if (n > 0 && cur > math.MaxInt64-n) || (n < 0 && cur < math.MinInt64-n) {
+			return nil, errors.New(errOverflow)
+		}
+
+		nv = cur + n
+
+		return nv, nil
+	}, func() { c.w.integer(nv) })
+}
+
+/*
+	Replace the value of the key by f under the lock of its shard, the
+	missing key is added with f of zero. Errors of f are replied as they are,
+	the value is not changed then. The reply of the new value is written by
+	reply.
+*/
+func (c *conn) increment(k string, zero interface{}, f func(x interface{}) (interface{}, error), reply func()) {
+	c.retry(func() bool {
+		var (
+			called bool
+			ferr   error
+		)
+
+		err := c.srv.cache.IncrementFunc(k, func(x interface{}) (interface{}, error) {
+			called = true
+
+			var v interface{}
+			v, ferr = f(x)
+
+			return v, ferr
+		})
+
+		switch {
+		case err == nil:
+			reply()
+
+			return true
+		case ferr != nil:
+			c.w.error(ferr.Error())
+
+			return true
+		case called || errors.Is(err, rebis.ErrClosed):
+			// the new value has no memory
+			c.w.error("ERR " + err.Error())
+
+			return true
+		}
+
+		x, err := f(zero)
+		if err != nil {
+			c.w.error(err.Error())
+
+			return true
+		}
+
+		if err := c.srv.cache.Add(k, x, rebis.DefaultExpiration); err != nil {
+			// Add fails by the key added after the read or by memory
+			if !errors.Is(err, rebis.ErrClosed) && c.exists(k) {
+				return false
+			}
+
+			c.w.error("ERR " + err.Error())
+
+			return true
+		}
+
+		reply()
+
+		return true
+	})
+}
+
+/*
+	INCRBYFLOAT key increment. The sum is checked and written by
+	IncrementFunc like in incrBy, numbers and numeric strings are replaced by
+	the sum of float64 type.
+*/
+func cmdIncrByFloat(c *conn, args []string) {
+	n, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		c.w.error(errNotFloat)
+
+		return
+	}
+
+	var nv float64
+
+	c.increment(args[0], float64(0), func(x interface{}) (interface{}, error) {
+		cur, ok := toFloat(x)
+		if !ok {
+			return nil, errors.New(errNotFloat)
+		}
+
+		nv = cur + n
+		if math.IsNaN(nv) || math.IsInf(nv, 0) {
+			return nil, errors.New("ERR increment would produce NaN or Infinity")
+		}
+
+		return nv, nil
+	}, func() { c.w.bulk(format(nv)) })
+}
+
+func cmdExpire(c *conn, args []string) {
+	c.expire(args, time.Second, "expire", false)
+}
+
+func cmdPExpire(c *conn, args []string) {
+	c.expire(args, time.Millisecond, "pexpire", false)
+}
+
+func cmdExpireAt(c *conn, args []string) {
+	c.expire(args, time.Second, "expireat", true)
+}
+
+func cmdPExpireAt(c *conn, args []string) {
+	c.expire(args, time.Millisecond, "pexpireat", true)
+}
+
+/*
+	Set expiration of the key, not positive duration or time in the past
+	deletes the key. With at the argument is unix time.
+*/
+func (c *conn) expire(args []string, unit time.Duration, name string, at bool) {
+	k := args[0]
+
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		c.w.error(errNotInteger)
+
+		return
+	}
+
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		c.w.error(fmt.Sprintf(errExpireTime, name))
+
+		return
+	}
+
+	switch {
+	case at:
+		err = c.srv.cache.ExpireAt(k, time.Unix(0, n*int64(unit)))
+	case n <= 0:
+		err = c.srv.cache.ExpireAt(k, time.Now())
+	default:
+		err = c.srv.cache.Expire(k, time.Duration(n)*unit)
+	}
+
+	c.changed(err)
+}
+
+/*
+	PERSIST key
+*/
+func cmdPersist(c *conn, args []string) {
+	k := args[0]
+
+	if c.srv.cache.TTL(k) == rebis.NoExpiration {
+		c.w.integer(0)
+
+		return
+	}
+
+	c.changed(c.srv.cache.Persist(k))
+}
+
+/*
+	Reply 1 if the key is changed, 0 if it is not found.
+*/
+func (c *conn) changed(err error) {
+	switch {
+	case errors.Is(err, rebis.ErrClosed):
+		c.w.error("ERR " + err.Error())
+	case err != nil:
+		c.w.integer(0)
+	default:
+		c.w.integer(1)
+	}
+}
+
+func cmdTTL(c *conn, args []string) {
+	c.ttl(args[0], time.Second)
+}
+
+func cmdPTTL(c *conn, args []string) {
+	c.ttl(args[0], time.Millisecond)
+}
+
+func (c *conn) ttl(k string, unit time.Duration) {
+	switch d := c.srv.cache.TTL(k); d {
+	case rebis.TTLNotFound:
+		c.w.integer(ttlNotFound)
+	case rebis.NoExpiration:
+		c.w.integer(ttlNoExpiration)
+	default:
+		c.w.integer(int64((d + unit - 1) / unit))
+	}
+}
+
+func cmdFlush(c *conn, args []string) {
+	if len(args) > 1 {
+		c.w.error(errSyntax)
+
+		return
+	}
+
+	c.srv.cache.Flush()
+	c.w.simple("OK")
+}
+
+func cmdDBSize(c *conn, args []string) {
+	c.w.integer(int64(c.srv.cache.ItemCount()))
+}
+
+func cmdKeys(c *conn, args []string) {
+	c.w.bulks(c.srv.cache.Keys(args[0]))
+}
+
+/*
+	SCAN cursor [MATCH pattern] [COUNT count]
+*/
+func cmdScan(c *conn, args []string) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		c.w.error("ERR invalid cursor")
+
+		return
+	}
+
+	var (
+		pattern string
+		count   int
+	)
+
+	for i := 1; i < len(args); i++ {
+		if i+1 >= len(args) {
+			c.w.error(errSyntax)
+
+			return
+		}
+
+		switch strings.ToLower(args[i]) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			if count, err = strconv.Atoi(args[i+1]); err != nil {
+				c.w.error(errNotInteger)
+
+				return
+			}
+
+			if count <= 0 {
+				c.w.error(errSyntax)
+
+				return
+			}
+		default:
+			c.w.error(errSyntax)
+
+			return
+		}
+
+		i++
+	}
+
+	keys, next := c.srv.cache.Scan(cursor, pattern, count)
+
+	c.w.array(2)
+	c.w.bulk(strconv.FormatUint(next, 10))
+	c.w.bulks(keys)
+}
+
+/*
+	Format value of the cache as Redis string.
+*/
+func format(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch x := v.(type) {
+	case int64:
+		return x, true
+	case int:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	case uint8:
+		return int64(x), true
+	case uint16:
+		return int64(x), true
+	case uint32:
+		return int64(x), true
+	case uint:
+		return int64(x), x <= math.MaxInt64
+	case uint64:
+		return int64(x), x <= math.MaxInt64
+	case string, []byte:
+		n, err := strconv.ParseInt(format(x), 10, 64)
+
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case string, []byte:
+		f, err := strconv.ParseFloat(format(x), 64)
+
+		return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	default:
+		n, ok := toInt(v)
+
+		return float64(n), ok
+	}
+}
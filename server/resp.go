@@ -0,0 +1,184 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxBulkLen  = 512 * 1024 * 1024 // the same limit as in Redis
+	maxArrayLen = 1024 * 1024
+	maxLineLen  = 64 * 1024 // the limit of inline commands in Redis
+	bulkChunk   = 64 * 1024 // larger bulks grow while they are read
+)
+
+var errProtocol = errors.New("Protocol error")
+
+/*
+	reader parses commands of the Redis serialization protocol, both arrays
+	of bulk strings and inline commands are supported.
+*/
+type reader struct {
+	br *bufio.Reader
+}
+
+/*
+	Read the next command, returns nil args for an empty inline command and
+	for an array of length 0 or less like Redis.
+*/
+func (r *reader) readCommand() ([]string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArrayLen {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+
+	if n <= 0 {
+		return nil, nil
+	}
+
+	args := make([]string, 0, n)
+
+	for i := 0; i < n; i++ {
+		arg, err := r.readBulk()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+func (r *reader) readBulk() (string, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return "", err
+	}
+
+	if len(line) == 0 || line[0] != '$' {
+		return "", fmt.Errorf("%w: expected '$', got '%s'", errProtocol, line)
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxBulkLen {
+		return "", fmt.Errorf("%w: invalid bulk length", errProtocol)
+	}
+
+	// memory is not allocated for the declared length before data is sent
+	var buf bytes.Buffer
+	if n < bulkChunk {
+		buf.Grow(n + 2)
+	}
+
+	if _, err := io.CopyN(&buf, r.br, int64(n)+2); err != nil {
+		return "", err
+	}
+
+	b := buf.Bytes()
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return "", fmt.Errorf("%w: bulk is not terminated by CRLF", errProtocol)
+	}
+
+	return string(b[:n]), nil
+}
+
+/*
+	Read the line without CRLF, lines longer than maxLineLen are a protocol
+	error.
+*/
+func (r *reader) readLine() (string, error) {
+	var line []byte
+
+	for {
+		part, err := r.br.ReadSlice('\n')
+		if len(line)+len(part) > maxLineLen {
+			return "", fmt.Errorf("%w: too big inline request", errProtocol)
+		}
+
+		line = append(line, part...)
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+/*
+	writer writes replies in RESP2 or RESP3, the protocol is switched by HELLO.
+*/
+type writer struct {
+	bw    *bufio.Writer
+	proto int
+}
+
+func (w *writer) simple(s string) {
+	w.bw.WriteString("+" + s + "\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.bw.WriteString("-" + s + "\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.bw.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	w.bw.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *writer) null() {
+	if w.proto == 3 {
+		w.bw.WriteString("_\r\n")
+	} else {
+		w.bw.WriteString("$-1\r\n")
+	}
+}
+
+func (w *writer) array(n int) {
+	w.bw.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
+
+/*
+	Map header, RESP2 has no maps so it is written as flat array.
+*/
+func (w *writer) mapHeader(n int) {
+	if w.proto == 3 {
+		w.bw.WriteString("%" + strconv.Itoa(n) + "\r\n")
+	} else {
+		w.array(n * 2)
+	}
+}
+
+func (w *writer) bulks(values []string) {
+	w.array(len(values))
+
+	for _, v := range values {
+		w.bulk(v)
+	}
+}
@@ -0,0 +1,261 @@
+/*
+	Package server is the network front end of rebis cache, it speaks the
+	Redis serialization protocol (RESP2 and RESP3) over TCP, so standard
+	Redis clients can talk to the cache.
+*/
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmpavl/rebis"
+)
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("rebis: server closed")
+
+/*
+	Server serves the cache for Redis clients.
+*/
+type Server struct {
+	cache     *rebis.Cache
+	logger    rebis.Logger
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+/*
+	conn is a client connection.
+*/
+type conn struct {
+	net.Conn
+	srv  *Server
+	r    reader
+	w    writer
+	name string
+}
+
+/*
+	New create server for the cache with default logger (stdout).
+*/
+func New(c *rebis.Cache) *Server {
+	return &Server{
+		cache:     c,
+		logger:    rebis.DefaultLogger(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*conn]struct{}),
+	}
+}
+
+/*
+	ChangeLogger override the logger of the server if it is not nil.
+*/
+func (srv *Server) ChangeLogger(custom rebis.Logger) {
+	if custom != nil {
+		srv.logger = custom
+	}
+}
+
+/*
+	ListenAndServe listens on the TCP address and serves clients.
+*/
+func (srv *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return srv.Serve(l)
+}
+
+/*
+	Serve accepts connections on the listener and serves each of them in its
+	own goroutine. Serve always returns a non-nil error, after Close it is
+	ErrServerClosed.
+*/
+func (srv *Server) Serve(l net.Listener) error {
+	srv.mu.Lock()
+	if srv.closed {
+		srv.mu.Unlock()
+		l.Close()
+
+		return ErrServerClosed
+	}
+	srv.listeners[l] = struct{}{}
+	srv.mu.Unlock()
+
+	srv.logger.Printf("rebis server listen on %s", l.Addr())
+
+	var delay time.Duration
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			if srv.isClosed() {
+				return ErrServerClosed
+			}
+
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+
+				srv.logger.Printf("rebis server accept error: %s, retrying in %s", err, delay)
+				time.Sleep(delay)
+
+				continue
+			}
+
+			return err
+		}
+
+		delay = 0
+
+		c := &conn{
+			Conn: nc,
+			srv:  srv,
+			r:    reader{br: bufio.NewReader(nc)},
+			w:    writer{bw: bufio.NewWriter(nc), proto: 2},
+		}
+
+		if !srv.track(c) {
+			nc.Close()
+
+			return ErrServerClosed
+		}
+
+		go c.serve()
+	}
+}
+
+/*
+	Close stops listeners, closes all connections and waits for them.
+*/
+func (srv *Server) Close() error {
+	srv.mu.Lock()
+	srv.closed = true
+
+	for l := range srv.listeners {
+		l.Close()
+		delete(srv.listeners, l)
+	}
+
+	for c := range srv.conns {
+		c.Close()
+	}
+	srv.mu.Unlock()
+
+	srv.wg.Wait()
+
+	return nil
+}
+
+func (srv *Server) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return srv.closed
+}
+
+func (srv *Server) track(c *conn) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if srv.closed {
+		return false
+	}
+
+	srv.conns[c] = struct{}{}
+	srv.wg.Add(1)
+
+	return true
+}
+
+func (srv *Server) untrack(c *conn) {
+	srv.mu.Lock()
+	delete(srv.conns, c)
+	srv.mu.Unlock()
+
+	srv.wg.Done()
+}
+
+/*
+	Read commands and write replies until the client quits, pipelined
+	replies are flushed when there are no more buffered commands.
+*/
+func (c *conn) serve() {
+	defer c.srv.untrack(c)
+	defer c.Close()
+
+	for {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.error("ERR " + err.Error())
+				c.w.bw.Flush()
+			} else if !errors.Is(err, io.EOF) && !c.srv.isClosed() {
+				c.srv.logger.Printf("rebis server read from %s: %s", c.RemoteAddr(), err)
+			}
+
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		quit := c.exec(args)
+
+		if c.r.br.Buffered() == 0 || quit {
+			if err := c.w.bw.Flush(); err != nil {
+				return
+			}
+		}
+
+		if quit {
+			return
+		}
+	}
+}
+
+/*
+	Execute the command, returns true if the connection should be closed.
+*/
+func (c *conn) exec(args []string) bool {
+	name := strings.ToLower(args[0])
+
+	if name == "quit" {
+		c.w.simple("OK")
+
+		return true
+	}
+
+	cmd, found := commands[name]
+	if !found {
+		c.w.error("ERR unknown command '" + args[0] + "'")
+
+		return false
+	}
+
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		c.w.error("ERR wrong number of arguments for '" + name + "' command")
+
+		return false
+	}
+
+	cmd.handler(c, args[1:])
+
+	return false
+}
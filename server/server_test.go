@@ -0,0 +1,403 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmpavl/rebis"
+)
+
+type nullReply struct{}
+
+type errReply string
+
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	br *bufio.Reader
+}
+
+func startServer(t *testing.T) (*Server, *rebis.Cache, string) {
+	return startServerConfig(t, &rebis.Config{Size: rebis.DefaultSize})
+}
+
+func startServerConfig(t *testing.T, config *rebis.Config) (*Server, *rebis.Cache, string) {
+	c, err := rebis.NewCache(config)
+	if err != nil {
+		t.Fatal("err with config:", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("err with listen:", err)
+	}
+
+	srv := New(c)
+	srv.ChangeLogger(testLogger{t})
+
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	return srv, c, l.Addr().String()
+}
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Printf(format string, v ...interface{}) {
+	l.t.Logf(format, v...)
+}
+
+func dial(t *testing.T, addr string) *testClient {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal("err with dial:", err)
+	}
+	t.Cleanup(func() { nc.Close() })
+
+	return &testClient{t: t, nc: nc, br: bufio.NewReader(nc)}
+}
+
+func (tc *testClient) do(args ...string) interface{} {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		sb.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	if _, err := tc.nc.Write([]byte(sb.String())); err != nil {
+		tc.t.Fatal("err with write:", err)
+	}
+
+	return tc.read()
+}
+
+func (tc *testClient) read() interface{} {
+	tc.nc.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := tc.br.ReadString('\n')
+	if err != nil {
+		tc.t.Fatal("err with read:", err)
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return errReply(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '_':
+		return nullReply{}
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nullReply{}
+		}
+		buf := make([]byte, n+2)
+		io.ReadFull(tc.br, buf)
+		return string(buf[:n])
+	case '*', '%':
+		n, _ := strconv.Atoi(line[1:])
+		if line[0] == '%' {
+			n *= 2
+		}
+		if n < 0 {
+			return nullReply{}
+		}
+		arr := make([]interface{}, n)
+		for i := range arr {
+			arr[i] = tc.read()
+		}
+		return arr
+	}
+	tc.t.Fatalf("unknown reply %q", line)
+
+	return nil
+}
+
+func (tc *testClient) expect(want interface{}, args ...string) {
+	tc.t.Helper()
+	if got := tc.do(args...); !reflect.DeepEqual(got, want) {
+		tc.t.Errorf("%v: got %#v, want %#v", args, got, want)
+	}
+}
+
+func TestServerStrings(t *testing.T) {
+	_, c, addr := startServer(t)
+	cl := dial(t, addr)
+
+	cl.expect("PONG", "PING")
+	cl.expect("hi", "PING", "hi")
+	cl.expect(nullReply{}, "GET", "a")
+	cl.expect("OK", "SET", "a", "1")
+	cl.expect("1", "GET", "a")
+	cl.expect(nullReply{}, "SET", "a", "2", "NX")
+	cl.expect("OK", "SET", "a", "2", "XX")
+	cl.expect(nullReply{}, "SET", "b", "2", "XX")
+	cl.expect("2", "SET", "a", "3", "GET")
+	cl.expect(errReply(errSyntax), "SET", "a", "3", "NX", "XX")
+	cl.expect(int64(1), "EXISTS", "a")
+	cl.expect(int64(0), "EXISTS", "b")
+	cl.expect(int64(1), "DEL", "a", "b")
+	cl.expect(int64(0), "DBSIZE")
+
+	c.Set("go", "value", rebis.DefaultExpiration)
+	cl.expect("value", "GET", "go")
+	cl.expect(errReply("ERR unknown command 'NOPE'"), "NOPE")
+	cl.expect(errReply("ERR wrong number of arguments for 'get' command"), "GET")
+}
+
+func TestServerMulti(t *testing.T) {
+	_, _, addr := startServer(t)
+	cl := dial(t, addr)
+
+	cl.expect("OK", "MSET", "a", "1", "b", "2", "a", "3")
+	cl.expect([]interface{}{"3", "2", nullReply{}}, "MGET", "a", "b", "c")
+	cl.expect(int64(0), "MSETNX", "c", "1", "a", "1")
+	cl.expect(nullReply{}, "GET", "c")
+	cl.expect(int64(1), "MSETNX", "c", "1", "d", "1")
+	cl.expect(int64(3), "DEL", "a", "b", "c", "x")
+	cl.expect(int64(1), "DBSIZE")
+	cl.expect(errReply("ERR wrong number of arguments for 'mset' command"), "MSET", "a", "1", "b")
+}
+
+func TestServerIncr(t *testing.T) {
+	_, c, addr := startServer(t)
+	cl := dial(t, addr)
+
+	cl.expect(int64(1), "INCR", "n")
+	cl.expect(int64(11), "INCRBY", "n", "10")
+	cl.expect(int64(10), "DECR", "n")
+	cl.expect(int64(5), "DECRBY", "n", "5")
+	cl.expect("5", "GET", "n")
+
+	if n, err := c.IncrementInt64("n", 1); err != nil || n != 6 {
+		t.Error("incremented value is not int64:", n, err)
+	}
+
+	cl.expect("OK", "SET", "s", "10")
+	cl.expect(int64(11), "INCR", "s")
+	cl.expect("OK", "SET", "s", "str")
+	cl.expect(errReply(errNotInteger), "INCR", "s")
+	cl.expect("OK", "SET", "max", "9223372036854775807")
+	cl.expect(errReply(errOverflow), "INCR", "max")
+
+	cl.expect("10.5", "INCRBYFLOAT", "f", "10.5")
+	cl.expect("3.5", "INCRBYFLOAT", "f", "-7")
+	cl.expect(errReply(errNotFloat), "INCRBYFLOAT", "s", "1")
+}
+
+func TestServerIncrShared(t *testing.T) {
+	_, c, addr := startServer(t)
+	cl := dial(t, addr)
+	cl.expect(int64(0), "INCRBY", "n", "0")
+
+	sub := c.Subscribe("n", rebis.EventIncr, 2000)
+	defer sub.Close()
+
+	// increments of the server and of the cache itself are not lost
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			c.IncrementInt64("n", 1)
+		}
+		close(done)
+	}()
+	for i := 0; i < 1000; i++ {
+		cl.do("INCR", "n")
+	}
+	<-done
+
+	cl.expect("2000", "GET", "n")
+	if n := len(sub.C); n != 2000 {
+		t.Errorf("incr events: got %d, want 2000", n)
+	}
+
+	cl.expect("OK", "SET", "k", "1", "EX", "100")
+	cl.expect("1", "SET", "k", "2", "KEEPTTL", "GET")
+	if ttl := c.TTL("k"); ttl <= 0 || ttl > 100*time.Second {
+		t.Error("ttl is not kept:", ttl)
+	}
+}
+
+func TestServerSliding(t *testing.T) {
+	_, c, addr := startServerConfig(t, &rebis.Config{Size: rebis.DefaultSize, SlidingExpiration: true})
+	cl := dial(t, addr)
+
+	// reads of the commands slide the expiration, the writes are not retried
+	cl.expect("OK", "SET", "k", "1", "EX", "100")
+	cl.expect("1", "SET", "k", "2", "KEEPTTL", "GET")
+	cl.expect("OK", "SET", "k", "3", "KEEPTTL")
+	if ttl := c.TTL("k"); ttl <= 0 || ttl > 100*time.Second {
+		t.Error("ttl is not kept:", ttl)
+	}
+	cl.expect("3", "SET", "k", "4", "GET")
+
+	cl.expect("OK", "SET", "n", "1", "EX", "100")
+	cl.expect(int64(2), "INCR", "n")
+	cl.expect(int64(7), "INCRBY", "n", "5")
+	cl.expect("7.5", "INCRBYFLOAT", "n", "0.5")
+	if ttl := c.TTL("n"); ttl <= 0 || ttl > 100*time.Second {
+		t.Error("ttl is not kept:", ttl)
+	}
+}
+
+func TestServerIncrOverflow(t *testing.T) {
+	_, c, addr := startServer(t)
+	cl := dial(t, addr)
+
+	sub := c.Subscribe("n", rebis.EventIncr|rebis.EventSet, 10)
+	defer sub.Close()
+
+	// the sum is checked before the write, so nothing is written
+	if err := c.Set("n", int64(math.MaxInt64), rebis.NoExpiration); err != nil {
+		t.Fatal("err with set:", err)
+	}
+	<-sub.C
+	cl.expect(errReply(errOverflow), "INCR", "n")
+	cl.expect(errReply(errOverflow), "DECRBY", "n", "-1")
+	if n := len(sub.C); n != 0 {
+		t.Errorf("events of the overflow: got %d, want 0", n)
+	}
+	cl.expect("9223372036854775807", "GET", "n")
+}
+
+func TestServerExpire(t *testing.T) {
+	_, _, addr := startServer(t)
+	cl := dial(t, addr)
+
+	cl.expect(int64(ttlNotFound), "TTL", "a")
+	cl.expect("OK", "SET", "a", "1")
+	cl.expect(int64(ttlNoExpiration), "TTL", "a")
+	cl.expect(int64(1), "EXPIRE", "a", "100")
+	cl.expect(int64(100), "TTL", "a")
+	cl.expect(int64(2), "INCR", "a")
+	cl.expect(int64(3), "INCR", "a")
+	cl.expect(int64(100), "TTL", "a")
+	cl.expect(int64(0), "EXPIRE", "b", "100")
+
+	cl.expect("OK", "SET", "b", "1", "PX", "20")
+	if ttl := cl.do("PTTL", "b").(int64); ttl <= 0 || ttl > 20 {
+		t.Error("PTTL of b is wrong:", ttl)
+	}
+	cl.expect("OK", "SET", "b", "2", "KEEPTTL")
+	<-time.After(30 * time.Millisecond)
+	cl.expect(nullReply{}, "GET", "b")
+
+	cl.expect(int64(1), "PERSIST", "a")
+	cl.expect(int64(0), "PERSIST", "a")
+	cl.expect(int64(1), "EXPIREAT", "a", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	if ttl := cl.do("TTL", "a").(int64); ttl < 3590 || ttl > 3600 {
+		t.Error("TTL after EXPIREAT is wrong:", ttl)
+	}
+	cl.expect(int64(1), "PERSIST", "a")
+	cl.expect(int64(ttlNoExpiration), "TTL", "a")
+	cl.expect(int64(0), "PERSIST", "missing")
+
+	cl.expect(int64(1), "EXPIRE", "a", "0")
+	cl.expect(nullReply{}, "GET", "a")
+	cl.expect("OK", "SET", "a", "1")
+	cl.expect(int64(1), "PEXPIREAT", "a", "1")
+	cl.expect(nullReply{}, "GET", "a")
+	cl.expect(int64(0), "EXPIREAT", "a", "1")
+	cl.expect(errReply(fmt.Sprintf(errExpireTime, "set")), "SET", "a", "1", "EX", "0")
+}
+
+func TestServerKeys(t *testing.T) {
+	_, _, addr := startServer(t)
+	cl := dial(t, addr)
+
+	for _, k := range []string{"user:1", "user:2", "user:10", "post:1"} {
+		cl.expect("OK", "SET", k, "v")
+	}
+	cl.expect(int64(4), "DBSIZE")
+
+	keys := cl.do("KEYS", "user:?").([]interface{})
+	if len(keys) != 2 {
+		t.Errorf("KEYS user:? is wrong: %v", keys)
+	}
+	keys = cl.do("KEYS", "*").([]interface{})
+	if len(keys) != 4 {
+		t.Errorf("KEYS * is wrong: %v", keys)
+	}
+
+	var scanned []interface{}
+	for cursor := "0"; ; {
+		reply := cl.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "1").([]interface{})
+		scanned = append(scanned, reply[1].([]interface{})...)
+		if cursor = reply[0].(string); cursor == "0" {
+			break
+		}
+	}
+	if len(scanned) != 3 {
+		t.Errorf("SCAN MATCH user:* is wrong: %v", scanned)
+	}
+	cl.expect(errReply("ERR invalid cursor"), "SCAN", "x")
+	cl.expect(errReply(errSyntax), "SCAN", "0", "COUNT")
+
+	cl.expect("OK", "FLUSHALL")
+	cl.expect([]interface{}{}, "KEYS", "*")
+}
+
+func TestServerProtocol(t *testing.T) {
+	_, _, addr := startServer(t)
+	cl := dial(t, addr)
+
+	hello := cl.do("HELLO", "3").([]interface{})
+	if len(hello) != 14 || hello[0] != "server" || hello[5] != int64(3) {
+		t.Errorf("HELLO 3 is wrong: %v", hello)
+	}
+	cl.expect(nullReply{}, "GET", "a")
+	cl.expect(errReply("NOPROTO unsupported protocol version"), "HELLO", "4")
+
+	// inline and pipelined commands
+	cl.nc.Write([]byte("PING\r\nSET a 1\r\nGET a\r\n"))
+	for _, want := range []interface{}{"PONG", "OK", "1"} {
+		if got := cl.read(); got != want {
+			t.Errorf("pipelined reply: got %#v, want %#v", got, want)
+		}
+	}
+
+	// null and empty arrays are skipped like in Redis
+	cl.nc.Write([]byte("*-1\r\n*0\r\nPING\r\n"))
+	if got := cl.read(); got != "PONG" {
+		t.Errorf("reply after null array: got %#v", got)
+	}
+
+	cl.expect("OK", "QUIT")
+	if _, err := cl.br.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Error("connection is not closed after QUIT:", err)
+	}
+
+	cl = dial(t, addr)
+	cl.nc.Write([]byte(strings.Repeat("a", 2*maxLineLen)))
+	if got, ok := cl.read().(errReply); !ok || !strings.Contains(string(got), "too big inline request") {
+		t.Errorf("reply to too long line: got %#v", got)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	srv, _, addr := startServer(t)
+	cl := dial(t, addr)
+	cl.expect("PONG", "PING")
+
+	srv.Close()
+	if _, err := cl.br.ReadByte(); err == nil {
+		t.Error("connection is not closed after server Close")
+	}
+
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	if err := srv.Serve(l); !errors.Is(err, ErrServerClosed) {
+		t.Error("Serve after Close returned:", err)
+	}
+}